@@ -19,3 +19,17 @@ function toggleWelsh() {
         location.reload()
     }
 }
+
+// Inline onclick handlers are blocked by the Content-Security-Policy
+document.addEventListener("DOMContentLoaded", function() {
+    var toggles = document.querySelectorAll("[data-language-toggle]");
+    for (var i = 0; i < toggles.length; i++) {
+        toggles[i].addEventListener("click", function(event) {
+            if (event.currentTarget.getAttribute("data-language-toggle") === "welsh") {
+                toggleWelsh();
+            } else {
+                toggleEnglish();
+            }
+        });
+    }
+});
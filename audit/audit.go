@@ -0,0 +1,242 @@
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ONSdigital/blaise-cawi-portal/metrics"
+	"go.uber.org/zap"
+)
+
+type EventType string
+
+const (
+	LoginFailed     EventType = "login_failed"
+	LoginSucceeded  EventType = "login_succeeded"
+	CaseSelected    EventType = "case_selected"
+	Logout          EventType = "logout"
+	Timeout         EventType = "timeout"
+	SessionReplaced EventType = "session_replaced"
+	Forbidden       EventType = "forbidden"
+	TokenRefreshed  EventType = "token_refreshed"
+)
+
+// Event is one authentication decision. It never carries an access code,
+// case ID or client IP, only keyed hashes of them, so the audit trail can be
+// shared with the security team without exposing respondents.
+//
+// Events are chained, each one's Hash covering its content and the Hash of
+// the event before it, so that an event being changed, removed or reordered
+// is detected by Verify. Each run of the portal has its own chain, told apart
+// by RunID, as several instances can write to the same sink.
+type Event struct {
+	RunID          string    `json:"run_id"`
+	Sequence       uint64    `json:"sequence"`
+	Time           time.Time `json:"time"`
+	Type           EventType `json:"type"`
+	Reason         string    `json:"reason,omitempty"`
+	UACHash        string    `json:"uac_hash,omitempty"`
+	TokenID        string    `json:"token_id,omitempty"`
+	InstrumentName string    `json:"instrument_name,omitempty"`
+	CaseIDHash     string    `json:"case_id_hash,omitempty"`
+	ClientIPHash   string    `json:"client_ip_hash,omitempty"`
+	PreviousHash   string    `json:"previous_hash"`
+	Hash           string    `json:"hash"`
+}
+
+const (
+	defaultQueueSize    = 1000
+	defaultRetryBackoff = time.Second
+	defaultWriteTimeout = 10 * time.Second
+	maxRetryBackoff     = 30 * time.Second
+)
+
+// Auditor records events to its Sink. Key keys both the hashes of the
+// identifiers in events and the chain, so neither can be forged without it.
+//
+// Events are written in order by a single writer, so that a slow sink never
+// holds up a respondent. Up to QueueSize events wait to be written, further
+// events are dropped before they are chained, so the chain stays whole.
+// Each write is given up on after WriteTimeout, and writes that fail are
+// retried, backing off from RetryBackoff, as dropping a chained event would
+// look like tampering. Dropped events and failed writes are counted in
+// Metrics, when set, so that they can be alerted on.
+type Auditor struct {
+	Sink         Sink
+	Key          []byte
+	Logger       *zap.Logger
+	Metrics      *metrics.Metrics
+	Clock        func() time.Time
+	QueueSize    int
+	RetryBackoff time.Duration
+	WriteTimeout time.Duration
+	// Identifies this run's chain, a random ID when it is not set
+	RunID string
+
+	start    sync.Once
+	queue    chan queuedEvent
+	mutex    sync.Mutex
+	sequence uint64
+	previous string
+}
+
+// queuedEvent is an event to write, or when flushed is set, a marker that
+// every event queued before it has been written
+type queuedEvent struct {
+	event   Event
+	flushed chan struct{}
+}
+
+// Hash returns the keyed hash of an identifier to put in an event
+func (auditor *Auditor) Hash(value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, auditor.Key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Record chains the event onto the ones before it and queues it to be
+// written to the Sink. Failures are logged rather than returned, so that
+// auditing never stops a respondent signing in.
+func (auditor *Auditor) Record(_ context.Context, event Event) {
+	auditor.start.Do(auditor.startWriter)
+	auditor.mutex.Lock()
+	defer auditor.mutex.Unlock()
+
+	event.RunID = auditor.RunID
+	event.Sequence = auditor.sequence + 1
+	event.Time = auditor.now()
+	event.PreviousHash = auditor.previous
+	event.Hash = chainHash(auditor.Key, event)
+
+	select {
+	case auditor.queue <- queuedEvent{event: event}:
+		auditor.sequence = event.Sequence
+		auditor.previous = event.Hash
+	default:
+		auditor.log("Audit queue full, event dropped", event, nil)
+		auditor.Metrics.AuditEventDropped()
+	}
+}
+
+// Flush waits for the events recorded so far to be written, or for ctx to end
+func (auditor *Auditor) Flush(ctx context.Context) error {
+	auditor.start.Do(auditor.startWriter)
+	flushed := make(chan struct{})
+	select {
+	case auditor.queue <- queuedEvent{flushed: flushed}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (auditor *Auditor) startWriter() {
+	if auditor.RunID == "" {
+		runID := make([]byte, 8)
+		_, _ = rand.Read(runID)
+		auditor.RunID = hex.EncodeToString(runID)
+	}
+	queueSize := auditor.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	auditor.queue = make(chan queuedEvent, queueSize)
+	go auditor.write()
+}
+
+func (auditor *Auditor) write() {
+	for queued := range auditor.queue {
+		if queued.flushed != nil {
+			close(queued.flushed)
+			continue
+		}
+		backoff := auditor.RetryBackoff
+		if backoff <= 0 {
+			backoff = defaultRetryBackoff
+		}
+		for {
+			err := auditor.writeOnce(queued.event)
+			if err == nil {
+				break
+			}
+			auditor.log("Failed to write audit event", queued.event, err)
+			auditor.Metrics.AuditWriteFailed()
+			time.Sleep(backoff)
+			backoff = min(backoff*2, maxRetryBackoff)
+		}
+	}
+}
+
+// writeOnce makes one attempt to write the event, bounded by WriteTimeout
+func (auditor *Auditor) writeOnce(event Event) error {
+	writeTimeout := auditor.WriteTimeout
+	if writeTimeout <= 0 {
+		writeTimeout = defaultWriteTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+	return auditor.Sink.Write(ctx, event)
+}
+
+func (auditor *Auditor) log(message string, event Event, err error) {
+	if auditor.Logger == nil {
+		return
+	}
+	auditor.Logger.Error(message,
+		zap.String("EventType", string(event.Type)),
+		zap.Uint64("Sequence", event.Sequence),
+		zap.Error(err),
+	)
+}
+
+func (auditor *Auditor) now() time.Time {
+	if auditor.Clock != nil {
+		return auditor.Clock().UTC()
+	}
+	return time.Now().UTC()
+}
+
+// Verify checks the runs of events recorded with key are complete and
+// unchanged. Events from different runs can be interleaved, as they are when
+// several instances write to one sink.
+func Verify(key []byte, events []Event) error {
+	last := map[string]Event{}
+	for _, event := range events {
+		if previous, ok := last[event.RunID]; ok {
+			if event.Sequence != previous.Sequence+1 {
+				return fmt.Errorf("audit event %d follows %d", event.Sequence, previous.Sequence)
+			}
+			if event.PreviousHash != previous.Hash {
+				return fmt.Errorf("audit event %d does not follow on from %d", event.Sequence, previous.Sequence)
+			}
+		}
+		if !hmac.Equal([]byte(event.Hash), []byte(chainHash(key, event))) {
+			return fmt.Errorf("audit event %d has been changed", event.Sequence)
+		}
+		last[event.RunID] = event
+	}
+	return nil
+}
+
+func chainHash(key []byte, event Event) string {
+	event.Hash = ""
+	content, _ := json.Marshal(event)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(content)
+	return hex.EncodeToString(mac.Sum(nil))
+}
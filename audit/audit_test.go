@@ -0,0 +1,209 @@
+package audit_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/ONSdigital/blaise-cawi-portal/audit"
+	"github.com/ONSdigital/blaise-cawi-portal/metrics"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// failingSink fails its first failures writes
+type failingSink struct {
+	audit.MemorySink
+	failures int
+}
+
+func (failingSink *failingSink) Write(ctx context.Context, event audit.Event) error {
+	if failingSink.failures > 0 {
+		failingSink.failures--
+		return fmt.Errorf("disk full")
+	}
+	return failingSink.MemorySink.Write(ctx, event)
+}
+
+// blockingSink holds up writes until it is released
+type blockingSink struct {
+	audit.MemorySink
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (blockingSink *blockingSink) Write(ctx context.Context, event audit.Event) error {
+	blockingSink.writing <- struct{}{}
+	<-blockingSink.release
+	return blockingSink.MemorySink.Write(ctx, event)
+}
+
+// hangingSink never finishes its first hangs writes, until they are given up on
+type hangingSink struct {
+	audit.MemorySink
+	hangs int
+}
+
+func (hangingSink *hangingSink) Write(ctx context.Context, event audit.Event) error {
+	if hangingSink.hangs > 0 {
+		hangingSink.hangs--
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return hangingSink.MemorySink.Write(ctx, event)
+}
+
+func scrape(portalMetrics *metrics.Metrics) string {
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/metrics", nil)
+	portalMetrics.Handler().ServeHTTP(recorder, request)
+	return recorder.Body.String()
+}
+
+var _ = Describe("Auditor", func() {
+	var (
+		key     = []byte("audit-key")
+		now     = time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC)
+		sink    *audit.MemorySink
+		auditor *audit.Auditor
+	)
+
+	BeforeEach(func() {
+		sink = &audit.MemorySink{}
+		auditor = &audit.Auditor{
+			Sink:  sink,
+			Key:   key,
+			Clock: func() time.Time { return now },
+		}
+	})
+
+	record := func() []audit.Event {
+		auditor.Record(context.Background(), audit.Event{Type: audit.LoginFailed, Reason: "Access code not recognised", UACHash: "abc"})
+		auditor.Record(context.Background(), audit.Event{Type: audit.LoginSucceeded, UACHash: "def", TokenID: "token"})
+		auditor.Record(context.Background(), audit.Event{Type: audit.Logout, UACHash: "def", TokenID: "token"})
+		Expect(auditor.Flush(context.Background())).To(Succeed())
+		return sink.Events()
+	}
+
+	It("chains events in sequence", func() {
+		events := record()
+		Expect(events).To(HaveLen(3))
+		Expect(events[0].Sequence).To(Equal(uint64(1)))
+		Expect(events[0].Time).To(Equal(now))
+		Expect(events[0].PreviousHash).To(Equal(""))
+		Expect(events[1].Sequence).To(Equal(uint64(2)))
+		Expect(events[1].PreviousHash).To(Equal(events[0].Hash))
+		Expect(events[2].PreviousHash).To(Equal(events[1].Hash))
+		Expect(audit.Verify(key, events)).To(Succeed())
+	})
+
+	It("detects a changed event", func() {
+		events := record()
+		events[1].UACHash = "abc"
+		Expect(audit.Verify(key, events)).To(MatchError("audit event 2 has been changed"))
+	})
+
+	It("detects a removed event", func() {
+		events := record()
+		Expect(audit.Verify(key, []audit.Event{events[0], events[2]})).To(MatchError("audit event 3 follows 1"))
+	})
+
+	It("detects an event rehashed without the key", func() {
+		events := record()
+		Expect(audit.Verify([]byte("another-key"), events)).To(MatchError("audit event 1 has been changed"))
+	})
+
+	It("hashes identifiers with the key", func() {
+		Expect(auditor.Hash("100001")).To(HaveLen(64))
+		Expect(auditor.Hash("100001")).ToNot(Equal((&audit.Auditor{Key: []byte("another-key")}).Hash("100001")))
+		Expect(auditor.Hash("")).To(Equal(""))
+	})
+
+	It("retries events that cannot be written, keeping the chain whole", func() {
+		observedZapCore, observedLogs := observer.New(zap.InfoLevel)
+		failing := &failingSink{failures: 2}
+		auditor.Sink = failing
+		auditor.Logger = zap.New(observedZapCore)
+		auditor.RetryBackoff = time.Millisecond
+
+		auditor.Record(context.Background(), audit.Event{Type: audit.Forbidden})
+		auditor.Record(context.Background(), audit.Event{Type: audit.Logout})
+		Expect(auditor.Flush(context.Background())).To(Succeed())
+
+		Expect(observedLogs.Len()).To(Equal(2))
+		Expect(observedLogs.All()[0].Message).To(Equal("Failed to write audit event"))
+		Expect(observedLogs.All()[0].ContextMap()["EventType"]).To(Equal("forbidden"))
+		Expect(observedLogs.All()[0].Level).To(Equal(zap.ErrorLevel))
+		events := failing.Events()
+		Expect(events).To(HaveLen(2))
+		Expect(audit.Verify(key, events)).To(Succeed())
+	})
+
+	It("gives up on a write at the write timeout and retries it", func() {
+		portalMetrics := metrics.New()
+		hanging := &hangingSink{hangs: 1}
+		auditor.Sink = hanging
+		auditor.Metrics = portalMetrics
+		auditor.WriteTimeout = 10 * time.Millisecond
+		auditor.RetryBackoff = time.Millisecond
+
+		auditor.Record(context.Background(), audit.Event{Type: audit.Logout})
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		Expect(auditor.Flush(ctx)).To(Succeed())
+
+		Expect(hanging.Events()).To(HaveLen(1))
+		Expect(scrape(portalMetrics)).To(ContainSubstring("cawi_portal_audit_write_failures_total 1"))
+	})
+
+	It("does not hold up recording while the sink is slow", func() {
+		observedZapCore, observedLogs := observer.New(zap.InfoLevel)
+		blocking := &blockingSink{writing: make(chan struct{}), release: make(chan struct{})}
+		auditor.Sink = blocking
+		auditor.Logger = zap.New(observedZapCore)
+		portalMetrics := metrics.New()
+		auditor.Metrics = portalMetrics
+		auditor.QueueSize = 1
+
+		auditor.Record(context.Background(), audit.Event{Type: audit.LoginFailed})
+		<-blocking.writing
+		auditor.Record(context.Background(), audit.Event{Type: audit.LoginSucceeded})
+		auditor.Record(context.Background(), audit.Event{Type: audit.Logout})
+
+		Expect(observedLogs.FilterMessage("Audit queue full, event dropped").All()).To(HaveLen(1))
+		Expect(scrape(portalMetrics)).To(ContainSubstring("cawi_portal_audit_events_dropped_total 1"))
+		close(blocking.release)
+		go func() {
+			for range blocking.writing {
+			}
+		}()
+		Expect(auditor.Flush(context.Background())).To(Succeed())
+		events := blocking.Events()
+		Expect(events).To(HaveLen(2))
+		Expect(events[1].Type).To(Equal(audit.LoginSucceeded))
+		Expect(audit.Verify(key, events)).To(Succeed())
+	})
+
+	It("verifies the chains of several runs written to one sink", func() {
+		other := &audit.Auditor{Sink: sink, Key: key}
+
+		auditor.Record(context.Background(), audit.Event{Type: audit.LoginSucceeded})
+		Expect(auditor.Flush(context.Background())).To(Succeed())
+		other.Record(context.Background(), audit.Event{Type: audit.LoginSucceeded})
+		Expect(other.Flush(context.Background())).To(Succeed())
+		auditor.Record(context.Background(), audit.Event{Type: audit.Logout})
+		Expect(auditor.Flush(context.Background())).To(Succeed())
+
+		events := sink.Events()
+		Expect(events[0].RunID).ToNot(Equal(""))
+		Expect(events[1].RunID).ToNot(Equal(events[0].RunID))
+		Expect(events[2].Sequence).To(Equal(uint64(2)))
+		Expect(audit.Verify(key, events)).To(Succeed())
+		Expect(audit.Verify(key, []audit.Event{events[0], events[1]})).To(Succeed())
+	})
+})
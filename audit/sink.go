@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Sink is where audit events end up
+type Sink interface {
+	Write(context.Context, Event) error
+}
+
+// NewSink returns the sink for a spec of "stdout", "file:<path>", or the
+// http(s) URL of a webhook to post each event to
+func NewSink(spec string, client *http.Client, token string) (Sink, error) {
+	switch {
+	case spec == "stdout":
+		return &WriterSink{Writer: os.Stdout}, nil
+	case strings.HasPrefix(spec, "file:"):
+		return NewFileSink(strings.TrimPrefix(spec, "file:"))
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return &WebhookSink{URL: spec, Client: client, Token: token}, nil
+	}
+	return nil, fmt.Errorf("unknown audit sink %q", spec)
+}
+
+// WriterSink writes each event as a line of JSON
+type WriterSink struct {
+	Writer io.Writer
+
+	mutex sync.Mutex
+}
+
+// NewFileSink appends events to the file at path, creating it if need be
+func NewFileSink(path string) (*WriterSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("no audit file given")
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterSink{Writer: file}, nil
+}
+
+func (writerSink *WriterSink) Write(_ context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	writerSink.mutex.Lock()
+	defer writerSink.mutex.Unlock()
+	_, err = writerSink.Writer.Write(append(line, '\n'))
+	return err
+}
+
+// WebhookSink posts each event as JSON to URL, with Token as a bearer token
+// when it is set
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+	Token  string
+}
+
+func (webhookSink *WebhookSink) Write(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, "POST", webhookSink.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if webhookSink.Token != "" {
+		request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", webhookSink.Token))
+	}
+
+	response, err := webhookSink.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d from audit webhook", response.StatusCode)
+	}
+	return nil
+}
+
+// MemorySink keeps events in memory, for tests
+type MemorySink struct {
+	mutex  sync.Mutex
+	events []Event
+}
+
+func (memorySink *MemorySink) Write(_ context.Context, event Event) error {
+	memorySink.mutex.Lock()
+	defer memorySink.mutex.Unlock()
+	memorySink.events = append(memorySink.events, event)
+	return nil
+}
+
+// Events returns a copy of the events written so far
+func (memorySink *MemorySink) Events() []Event {
+	memorySink.mutex.Lock()
+	defer memorySink.mutex.Unlock()
+	return append([]Event(nil), memorySink.events...)
+}
@@ -0,0 +1,105 @@
+package audit_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/ONSdigital/blaise-cawi-portal/audit"
+	"github.com/jarcoal/httpmock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sinks", func() {
+	var event = audit.Event{Sequence: 1, Type: audit.LoginSucceeded, TokenID: "token", Hash: "hash"}
+
+	Describe("NewSink", func() {
+		It("writes to stdout", func() {
+			sink, err := audit.NewSink("stdout", nil, "")
+			Expect(err).To(BeNil())
+			Expect(sink).To(Equal(&audit.WriterSink{Writer: os.Stdout}))
+		})
+
+		It("posts to webhooks", func() {
+			sink, err := audit.NewSink("https://audit.example.com/events", http.DefaultClient, "secret")
+			Expect(err).To(BeNil())
+			Expect(sink).To(Equal(&audit.WebhookSink{URL: "https://audit.example.com/events", Client: http.DefaultClient, Token: "secret"}))
+		})
+
+		It("rejects unknown sinks", func() {
+			_, err := audit.NewSink("syslog", nil, "")
+			Expect(err).To(MatchError(`unknown audit sink "syslog"`))
+		})
+	})
+
+	Describe("WriterSink", func() {
+		It("writes each event as a line of JSON", func() {
+			var buffer bytes.Buffer
+			sink := &audit.WriterSink{Writer: &buffer}
+			Expect(sink.Write(context.Background(), event)).To(Succeed())
+			Expect(sink.Write(context.Background(), event)).To(Succeed())
+
+			scanner := bufio.NewScanner(&buffer)
+			lines := 0
+			for scanner.Scan() {
+				var written audit.Event
+				Expect(json.Unmarshal(scanner.Bytes(), &written)).To(Succeed())
+				Expect(written).To(Equal(event))
+				lines++
+			}
+			Expect(lines).To(Equal(2))
+		})
+
+		It("appends to a file", func() {
+			dir, err := os.MkdirTemp("", "audit")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "audit.jsonl")
+			Expect(os.WriteFile(path, []byte("{}\n"), 0600)).To(Succeed())
+
+			sink, err := audit.NewSink("file:"+path, nil, "")
+			Expect(err).To(BeNil())
+			Expect(sink.Write(context.Background(), event)).To(Succeed())
+
+			content, err := os.ReadFile(path)
+			Expect(err).To(BeNil())
+			Expect(string(content)).To(HavePrefix("{}\n{\"run_id\":\"\",\"sequence\":1,"))
+		})
+	})
+
+	Describe("WebhookSink", func() {
+		var sink = &audit.WebhookSink{URL: "https://audit.example.com/events", Client: &http.Client{}, Token: "secret"}
+
+		BeforeEach(func() {
+			httpmock.Activate()
+		})
+
+		AfterEach(func() {
+			httpmock.DeactivateAndReset()
+		})
+
+		It("posts the event as JSON with the token", func() {
+			httpmock.RegisterResponder("POST", sink.URL, func(request *http.Request) (*http.Response, error) {
+				Expect(request.Header.Get("Authorization")).To(Equal("Bearer secret"))
+				Expect(request.Header.Get("Content-Type")).To(Equal("application/json"))
+				var posted audit.Event
+				Expect(json.NewDecoder(request.Body).Decode(&posted)).To(Succeed())
+				Expect(posted).To(Equal(event))
+				return httpmock.NewStringResponse(http.StatusAccepted, ""), nil
+			})
+			Expect(sink.Write(context.Background(), event)).To(Succeed())
+			Expect(httpmock.GetTotalCallCount()).To(Equal(1))
+		})
+
+		It("fails when the webhook does", func() {
+			httpmock.RegisterResponder("POST", sink.URL, httpmock.NewStringResponder(http.StatusInternalServerError, ""))
+			Expect(sink.Write(context.Background(), event)).To(MatchError("unexpected status 500 from audit webhook"))
+		})
+	})
+})
@@ -0,0 +1,71 @@
+package authenticate
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ONSdigital/blaise-cawi-portal/kvstore"
+)
+
+// SessionPolicy decides what happens when an access code that already has an
+// active session is used to sign in again
+type SessionPolicy string
+
+const (
+	// Any number of sessions may use the same access code
+	SessionPolicyAllow SessionPolicy = "allow"
+	// The new sign in is refused until the active session ends
+	SessionPolicyReject SessionPolicy = "reject"
+	// The new sign in ends the active session
+	SessionPolicyReplace SessionPolicy = "replace"
+)
+
+// Decode allows a SessionPolicy to be loaded by envconfig
+func (sessionPolicy *SessionPolicy) Decode(value string) error {
+	switch SessionPolicy(value) {
+	case SessionPolicyAllow, SessionPolicyReject, SessionPolicyReplace:
+		*sessionPolicy = SessionPolicy(value)
+		return nil
+	}
+	return fmt.Errorf("unknown session policy %q", value)
+}
+
+// Generate mocks by running "go generate ./..."
+//
+//go:generate mockery --name ActiveSessionsInterface
+type ActiveSessionsInterface interface {
+	Active(string) (string, bool, error)
+	Register(string, string, time.Duration) error
+	Extend(string, string, time.Duration) (bool, error)
+	Release(string, string) error
+}
+
+// ActiveSessions records the ID of the token of the active session for each
+// access code, by the access code's hash.
+type ActiveSessions struct {
+	Store kvstore.Store
+}
+
+func (activeSessions *ActiveSessions) Active(uacHash string) (string, bool, error) {
+	return activeSessions.Store.Get(activeSessions.key(uacHash))
+}
+
+func (activeSessions *ActiveSessions) Register(uacHash, tokenID string, ttl time.Duration) error {
+	return activeSessions.Store.Set(activeSessions.key(uacHash), tokenID, ttl)
+}
+
+// Extend keeps the session active for another ttl, unless another session has
+// replaced it, reporting whether it is still the active session
+func (activeSessions *ActiveSessions) Extend(uacHash, tokenID string, ttl time.Duration) (bool, error) {
+	return activeSessions.Store.ExpireIfEqual(activeSessions.key(uacHash), tokenID, ttl)
+}
+
+// Release forgets the active session, unless another session has replaced it
+func (activeSessions *ActiveSessions) Release(uacHash, tokenID string) error {
+	_, err := activeSessions.Store.DelIfEqual(activeSessions.key(uacHash), tokenID)
+	return err
+}
+
+func (activeSessions *ActiveSessions) key(uacHash string) string {
+	return fmt.Sprintf("active_session:%s", uacHash)
+}
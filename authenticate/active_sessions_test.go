@@ -0,0 +1,98 @@
+package authenticate_test
+
+import (
+	"time"
+
+	"github.com/ONSdigital/blaise-cawi-portal/authenticate"
+	"github.com/ONSdigital/blaise-cawi-portal/kvstore"
+	kvstoreMocks "github.com/ONSdigital/blaise-cawi-portal/kvstore/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ActiveSessions", func() {
+	var activeSessions *authenticate.ActiveSessions
+
+	BeforeEach(func() {
+		activeSessions = &authenticate.ActiveSessions{Store: &kvstore.MemoryStore{}}
+	})
+
+	It("returns the registered session", func() {
+		Expect(activeSessions.Register("hash", "first", time.Minute)).To(Succeed())
+		Expect(activeSessions.Register("hash", "second", time.Minute)).To(Succeed())
+
+		activeID, found, err := activeSessions.Active("hash")
+		Expect(err).To(BeNil())
+		Expect(found).To(BeTrue())
+		Expect(activeID).To(Equal("second"))
+	})
+
+	It("releases the active session", func() {
+		_ = activeSessions.Register("hash", "first", time.Minute)
+
+		Expect(activeSessions.Release("hash", "first")).To(Succeed())
+		_, found, _ := activeSessions.Active("hash")
+		Expect(found).To(BeFalse())
+	})
+
+	It("does not release a session that has been replaced", func() {
+		_ = activeSessions.Register("hash", "second", time.Minute)
+
+		Expect(activeSessions.Release("hash", "first")).To(Succeed())
+		activeID, _, _ := activeSessions.Active("hash")
+		Expect(activeID).To(Equal("second"))
+	})
+
+	It("compares and releases the session in one step", func() {
+		mockStore := &kvstoreMocks.Store{}
+		mockStore.On("DelIfEqual", "active_session:hash", "first").Return(false, nil)
+		activeSessions.Store = mockStore
+
+		Expect(activeSessions.Release("hash", "first")).To(Succeed())
+		mockStore.AssertNotCalled(GinkgoT(), "Get", mock.Anything)
+		mockStore.AssertNotCalled(GinkgoT(), "Del", mock.Anything)
+	})
+
+	It("extends the active session", func() {
+		_ = activeSessions.Register("hash", "first", time.Minute)
+
+		Expect(activeSessions.Extend("hash", "first", time.Hour)).To(BeTrue())
+		activeID, found, _ := activeSessions.Active("hash")
+		Expect(found).To(BeTrue())
+		Expect(activeID).To(Equal("first"))
+	})
+
+	It("does not extend a session that has been replaced", func() {
+		_ = activeSessions.Register("hash", "second", time.Minute)
+
+		Expect(activeSessions.Extend("hash", "first", time.Hour)).To(BeFalse())
+		activeID, _, _ := activeSessions.Active("hash")
+		Expect(activeID).To(Equal("second"))
+	})
+
+	It("does not extend a session that has been released", func() {
+		Expect(activeSessions.Extend("hash", "first", time.Hour)).To(BeFalse())
+		_, found, _ := activeSessions.Active("hash")
+		Expect(found).To(BeFalse())
+	})
+
+	DescribeTable("SessionPolicy Decode",
+		func(value string, expected authenticate.SessionPolicy, valid bool) {
+			var sessionPolicy authenticate.SessionPolicy
+			err := sessionPolicy.Decode(value)
+			if !valid {
+				Expect(err).To(MatchError(ContainSubstring("unknown session policy")))
+				return
+			}
+			Expect(err).To(BeNil())
+			Expect(sessionPolicy).To(Equal(expected))
+		},
+		Entry("allow", "allow", authenticate.SessionPolicyAllow, true),
+		Entry("reject", "reject", authenticate.SessionPolicyReject, true),
+		Entry("replace", "replace", authenticate.SessionPolicyReplace, true),
+		Entry("unknown", "kick", authenticate.SessionPolicy(""), false),
+	)
+})
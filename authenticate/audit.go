@@ -0,0 +1,78 @@
+package authenticate
+
+import (
+	"github.com/ONSdigital/blaise-cawi-portal/audit"
+	"github.com/ONSdigital/blaise-cawi-portal/busapi"
+	"github.com/ONSdigital/blaise-cawi-portal/metrics"
+	"github.com/ONSdigital/blaise-cawi-portal/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// auditUACHashKey keeps the hash of the access code being signed in with on
+// the request, so every failure on the way can be attributed to it
+const auditUACHashKey = "audit_uac_hash"
+
+// loginFailed audits and counts a failed sign in
+func (auth *Auth) loginFailed(context *gin.Context, reason string, uacInfo busapi.UacInfo) {
+	auth.Metrics.LoginAttempt(metrics.LoginFailure, reason)
+	auth.auditLoginFailed(context, reason, uacInfo)
+}
+
+// auditLoginFailed records a failed sign in, with the reason it is logged with
+func (auth *Auth) auditLoginFailed(context *gin.Context, reason string, uacInfo busapi.UacInfo) {
+	auth.audit(context, audit.Event{
+		Type:           audit.LoginFailed,
+		Reason:         reason,
+		InstrumentName: uacInfo.InstrumentName,
+	}, uacInfo.CaseID)
+}
+
+// auditClaim records an event for the session a token belongs to
+func (auth *Auth) auditClaim(context *gin.Context, eventType audit.EventType, claim *UACClaims) {
+	if claim == nil {
+		return
+	}
+	auth.audit(context, AuditEvent(eventType, claim), claim.UacInfo.CaseID)
+}
+
+// auditToken records an event for the session a signed token belongs to
+func (auth *Auth) auditToken(context *gin.Context, eventType audit.EventType, jwtToken interface{}) {
+	if auth.Auditor == nil {
+		return
+	}
+	claim, err := auth.JWTCrypto.PeekJWT(jwtToken)
+	if err != nil {
+		auth.Logger.Error("Failed to read JWT to audit", append(utils.GetRequestSource(context), zap.Error(err))...)
+		return
+	}
+	auth.auditClaim(context, eventType, claim)
+}
+
+func (auth *Auth) audit(context *gin.Context, event audit.Event, caseID string) {
+	if event.UACHash == "" {
+		event.UACHash = context.GetString(auditUACHashKey)
+	}
+	Audit(auth.Auditor, context, event, caseID)
+}
+
+// AuditEvent is an event about the session the claim belongs to
+func AuditEvent(eventType audit.EventType, claim *UACClaims) audit.Event {
+	return audit.Event{
+		Type:           eventType,
+		UACHash:        claim.UACHash,
+		TokenID:        claim.Id,
+		InstrumentName: claim.UacInfo.InstrumentName,
+	}
+}
+
+// Audit records the event with keyed hashes of the case ID and the client's
+// IP, doing nothing when there is no auditor
+func Audit(auditor *audit.Auditor, context *gin.Context, event audit.Event, caseID string) {
+	if auditor == nil {
+		return
+	}
+	event.CaseIDHash = auditor.Hash(caseID)
+	event.ClientIPHash = auditor.Hash(utils.GetClientIP(context))
+	auditor.Record(context.Request.Context(), event)
+}
@@ -0,0 +1,174 @@
+package authenticate_test
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/ONSdigital/blaise-cawi-portal/audit"
+	"github.com/ONSdigital/blaise-cawi-portal/authenticate"
+	mockauth "github.com/ONSdigital/blaise-cawi-portal/authenticate/mocks"
+	"github.com/ONSdigital/blaise-cawi-portal/blaiserestapi"
+	mockrestapi "github.com/ONSdigital/blaise-cawi-portal/blaiserestapi/mocks"
+	"github.com/ONSdigital/blaise-cawi-portal/busapi"
+	"github.com/ONSdigital/blaise-cawi-portal/busapi/mocks"
+	"github.com/ONSdigital/blaise-cawi-portal/kvstore"
+	languageManagerMocks "github.com/ONSdigital/blaise-cawi-portal/languagemanager/mocks"
+	"github.com/ONSdigital/blaise-cawi-portal/ratelimiter"
+	"github.com/ONSdigital/blaise-cawi-portal/webserver"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	csrf "github.com/srbry/gin-csrf"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Auditing", func() {
+	var (
+		validUAC  = "123456789012"
+		jwtCrypto = &authenticate.JWTCrypto{JWTSecret: "hello"}
+		auditKey  = []byte("audit-key")
+		sink      *audit.MemorySink
+		auditor   *audit.Auditor
+		auth      *authenticate.Auth
+		router    *gin.Engine
+	)
+
+	BeforeEach(func() {
+		sink = &audit.MemorySink{}
+		auditor = &audit.Auditor{Sink: sink, Key: auditKey}
+		languageManagerMock := &languageManagerMocks.LanguageManagerInterface{}
+		languageManagerMock.On("IsWelsh", mock.Anything).Return(false)
+		languageManagerMock.On("LanguageError", mock.Anything, mock.Anything).Return("Access code not recognised. Enter the code again")
+		keyValueStore := &kvstore.MemoryStore{}
+		policy := ratelimiter.Policy{MaxAttempts: 5}
+		auth = &authenticate.Auth{
+			JWTCrypto:       jwtCrypto,
+			Logger:          zap.NewNop(),
+			CSRFManager:     &csrf.DefaultCSRFManager{Secret: "fwibble", SessionName: "session"},
+			LanguageManager: languageManagerMock,
+			UacKinds:        authenticate.UacKinds{authenticate.Uac12},
+			IPLimiter:       &ratelimiter.Limiter{Name: "ip", Store: keyValueStore, Policy: policy},
+			SessionLimiter:  &ratelimiter.Limiter{Name: "session", Store: keyValueStore, Policy: policy},
+			Auditor:         auditor,
+		}
+
+		router = gin.Default()
+		router.SetFuncMap(template.FuncMap{"WrapWelsh": webserver.WrapWelsh})
+		router.LoadHTMLGlob("../templates/*")
+		store := cookie.NewStore([]byte("secret"))
+		router.Use(sessions.SessionsMany([]string{"session", "user_session", "session_validation", "language_session"}, store))
+		router.POST("/login", func(context *gin.Context) {
+			auth.Login(context, sessions.DefaultMany(context, "user_session"))
+		})
+	})
+
+	login := func(uac string) {
+		data := url.Values{"uac": []string{uac}}
+		req, _ := http.NewRequest("POST", "/login", strings.NewReader(data.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = "203.0.113.7:1234"
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	Context("when a respondent signs in", func() {
+		BeforeEach(func() {
+			mockBusApi := &mocks.BusApiInterface{}
+			mockBusApi.On("GetUacInfo", mock.Anything, validUAC).Return(busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}, nil)
+			mockBusApi.On("GetUacInfo", mock.Anything, mock.Anything).Return(busapi.UacInfo{}, busapi.UacNotFoundError)
+			auth.BusApi = mockBusApi
+			mockRestApi := &mockrestapi.BlaiseRestApiInterface{}
+			mockRestApi.On("GetInstrumentSettings", mock.Anything, "foo").Return(blaiserestapi.InstrumentSettings{}, nil)
+			mockRestApi.On("GetQuestionnaireStatus", mock.Anything, "foo").Return(blaiserestapi.QuestionnaireActive, nil)
+			auth.BlaiseRestApi = mockRestApi
+		})
+
+		It("records the success with hashed identifiers", func() {
+			login(validUAC)
+
+			Expect(auditor.Flush(context.Background())).To(Succeed())
+			events := sink.Events()
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].Type).To(Equal(audit.LoginSucceeded))
+			Expect(events[0].UACHash).To(Equal(jwtCrypto.HashUAC(validUAC)))
+			Expect(events[0].TokenID).ToNot(BeEmpty())
+			Expect(events[0].InstrumentName).To(Equal("foo"))
+			Expect(events[0].CaseIDHash).To(Equal(auditor.Hash("bar")))
+			Expect(events[0].ClientIPHash).To(Equal(auditor.Hash("203.0.113.7")))
+		})
+
+		DescribeTable("records each failure with its reason",
+			func(uac, reason string, hashed bool) {
+				login(uac)
+
+				Expect(auditor.Flush(context.Background())).To(Succeed())
+				events := sink.Events()
+				Expect(events).To(HaveLen(1))
+				Expect(events[0].Type).To(Equal(audit.LoginFailed))
+				Expect(events[0].Reason).To(Equal(reason))
+				if hashed {
+					Expect(events[0].UACHash).To(Equal(jwtCrypto.HashUAC(uac)))
+				} else {
+					Expect(events[0].UACHash).To(BeEmpty())
+				}
+			},
+			Entry("a blank access code", " ", "Blank UAC", false),
+			Entry("a short access code", "1234", "Invalid UAC length", false),
+			Entry("an unrecognised access code", "210987654321", "Access code not recognised", true),
+		)
+
+		It("keeps a verifiable chain of events", func() {
+			login("210987654321")
+			login(validUAC)
+			Expect(auditor.Flush(context.Background())).To(Succeed())
+			Expect(audit.Verify(auditKey, sink.Events())).To(Succeed())
+		})
+	})
+
+	Context("when a session ends", func() {
+		var mockJwtCrypto *mockauth.JWTCryptoInterface
+
+		BeforeEach(func() {
+			mockJwtCrypto = &mockauth.JWTCryptoInterface{}
+			mockJwtCrypto.On("RevokeJWT", mock.Anything, mock.Anything).Return(nil)
+			mockJwtCrypto.On("PeekJWT", "signed-token").Return(&authenticate.UACClaims{
+				UACHash:        "uac-hash",
+				UacInfo:        busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"},
+				StandardClaims: jwt.StandardClaims{Id: "token-id"},
+			}, nil)
+			auth.JWTCrypto = mockJwtCrypto
+		})
+
+		DescribeTable("records why",
+			func(sessionEnd authenticate.SessionEnd, eventType audit.EventType) {
+				router.GET("/end", func(context *gin.Context) {
+					session := sessions.DefaultMany(context, "user_session")
+					session.Set(authenticate.JWT_TOKEN_KEY, "signed-token")
+					Expect(auth.EndSession(context, session, sessionEnd)).To(Succeed())
+				})
+				req, _ := http.NewRequest("GET", "/end", nil)
+				router.ServeHTTP(httptest.NewRecorder(), req)
+
+				Expect(auditor.Flush(context.Background())).To(Succeed())
+				events := sink.Events()
+				Expect(events).To(HaveLen(1))
+				Expect(events[0].Type).To(Equal(eventType))
+				Expect(events[0].UACHash).To(Equal("uac-hash"))
+				Expect(events[0].TokenID).To(Equal("token-id"))
+				Expect(events[0].CaseIDHash).To(Equal(auditor.Hash("bar")))
+			},
+			Entry("signing out", authenticate.SessionQuit, audit.Logout),
+			Entry("timing out", authenticate.SessionTimedOut, audit.Timeout),
+			Entry("signing in elsewhere", authenticate.SessionReplaced, audit.SessionReplaced),
+		)
+	})
+})
@@ -1,14 +1,24 @@
 package authenticate
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/ONSdigital/blaise-cawi-portal/audit"
 	"github.com/ONSdigital/blaise-cawi-portal/blaiserestapi"
 	"github.com/ONSdigital/blaise-cawi-portal/busapi"
 	"github.com/ONSdigital/blaise-cawi-portal/languagemanager"
+	"github.com/ONSdigital/blaise-cawi-portal/metrics"
+	"github.com/ONSdigital/blaise-cawi-portal/outbound"
+	"github.com/ONSdigital/blaise-cawi-portal/ratelimiter"
 	"github.com/ONSdigital/blaise-cawi-portal/utils"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -20,7 +30,10 @@ const (
 	SESSION_TIMEOUT_KEY = "session_timeout"
 	JWT_TOKEN_KEY       = "jwt_token"
 	SESSION_VALID_KEY   = "session_valid"
+	LOGIN_ATTEMPT_KEY   = "login_attempt_id"
 	ISSUER              = "social-surveys-web-portal"
+	MAX_LIFETIME_URL    = "/auth/timed-out?reason=max-lifetime"
+	CASE_SELECTION_URL  = "/auth/select-case"
 )
 
 var (
@@ -36,6 +49,26 @@ var (
 		"english": "We were unable to process your request, please try again",
 		"welsh":   "Ni allwn brosesu eich cais, rhowch gynnig arall arni",
 	}
+	CHECK_CHARACTERS_ERR = map[string]string{
+		"english": "Access code not recognised. Check the code on your letter and enter it again",
+		"welsh":   "Nid yw'r cod mynediad yn cael ei gydnabod. Gwiriwch y cod ar eich llythyr a'i roi eto",
+	}
+	TOO_MANY_ATTEMPTS_ERR = map[string]string{
+		"english": "Too many attempts. Wait %s and enter your access code again",
+		"welsh":   "Gormod o ymdrechion. Arhoswch %s a rhowch eich cod mynediad eto",
+	}
+	DISABLED_ERR = map[string]string{
+		"english": "This access code can no longer be used. Contact our Survey Enquiry Line on 0800 085 7376 if you need help",
+		"welsh":   "Ni ellir defnyddio'r cod mynediad hwn mwyach. Cysylltwch â'n Llinell Ymholiadau Arolwg ar 0800 085 7376 os oes angen help arnoch",
+	}
+	SELECT_CASE_ERR = map[string]string{
+		"english": "Select which study to open",
+		"welsh":   "Dewiswch pa astudiaeth i'w hagor",
+	}
+	IN_USE_ERR = map[string]string{
+		"english": "This access code is being used on another device. Sign out on that device and enter your access code again",
+		"welsh":   "Mae'r cod mynediad hwn yn cael ei ddefnyddio ar ddyfais arall. Allgofnodwch ar y ddyfais honno a rhowch eich cod mynediad eto",
+	}
 )
 
 // Generate mocks by running "go generate ./..."
@@ -45,19 +78,56 @@ type AuthInterface interface {
 	AuthenticatedWithUac(*gin.Context)
 	Login(*gin.Context, sessions.Session)
 	Logout(*gin.Context, sessions.Session)
+	EndSession(*gin.Context, sessions.Session, SessionEnd) error
 	HasSession(*gin.Context) (bool, *UACClaims)
+	SignedInElsewhere(*gin.Context) bool
 	NotAuthWithError(*gin.Context, string)
 	RefreshToken(*gin.Context, sessions.Session, *UACClaims)
+	CaseSelection(*gin.Context)
+	SelectCase(*gin.Context, sessions.Session)
 }
 
 type Auth struct {
-	BusApi          busapi.BusApiInterface
-	JWTCrypto       JWTCryptoInterface
-	BlaiseRestApi   blaiserestapi.BlaiseRestApiInterface
-	Logger          *zap.Logger
-	UacKind         string
-	CSRFManager     csrf.CSRFManager
-	LanguageManager languagemanager.LanguageManagerInterface
+	BusApi              busapi.BusApiInterface
+	JWTCrypto           JWTCryptoInterface
+	BlaiseRestApi       blaiserestapi.BlaiseRestApiInterface
+	Logger              *zap.Logger
+	UacKinds            UacKinds
+	CheckUacCharacters  bool
+	CSRFManager         csrf.CSRFManager
+	LanguageManager     languagemanager.LanguageManagerInterface
+	IPLimiter           ratelimiter.LimiterInterface
+	SessionLimiter      ratelimiter.LimiterInterface
+	ActiveSessions      ActiveSessionsInterface
+	SessionPolicy       SessionPolicy
+	AvailabilityWindows AvailabilityWindows
+	RequireSurveyDay    bool
+	// Records every authentication decision, when set
+	Auditor *audit.Auditor
+	Metrics *metrics.Metrics
+}
+
+// SessionEnd is why a session ended, which is audited
+type SessionEnd int
+
+const (
+	// The respondent signed out
+	SessionQuit SessionEnd = iota
+	// The respondent was inactive or reached the maximum session lifetime
+	SessionTimedOut
+	// The respondent signed in on another device, which carries on the interview
+	SessionReplaced
+)
+
+var sessionEndEvents = map[SessionEnd]audit.EventType{
+	SessionQuit:     audit.Logout,
+	SessionTimedOut: audit.Timeout,
+	SessionReplaced: audit.SessionReplaced,
+}
+
+type loginLimit struct {
+	limiter ratelimiter.LimiterInterface
+	key     string
 }
 
 func (auth *Auth) AuthenticatedWithUac(context *gin.Context) {
@@ -69,12 +139,26 @@ func (auth *Auth) AuthenticatedWithUac(context *gin.Context) {
 		return
 	}
 
-	_, err := auth.JWTCrypto.DecryptJWT(jwtToken)
+	claim, err := auth.JWTCrypto.DecryptJWT(context.Request.Context(), jwtToken)
+	if errors.Is(err, ErrSessionLifetimeExceeded) {
+		context.Redirect(http.StatusFound, MAX_LIFETIME_URL)
+		context.Abort()
+		return
+	}
 	if err != nil {
 		log.Println(err)
 		auth.notAuth(context)
 		return
 	}
+	if auth.replaced(context, claim) {
+		auth.Logger.Info("Session replaced by a sign in on another device",
+			append(utils.GetRequestSource(context), claim.LogFields()...)...)
+		if err := auth.EndSession(context, session, SessionReplaced); err != nil {
+			auth.Logger.Error("Failed to end replaced session", zap.Error(err))
+		}
+		auth.SignedInElsewhereError(context)
+		return
+	}
 	context.Next()
 }
 
@@ -86,37 +170,92 @@ func (auth *Auth) HasSession(context *gin.Context) (bool, *UACClaims) {
 		return false, nil
 	}
 
-	claim, err := auth.JWTCrypto.DecryptJWT(jwtToken)
-	if err != nil || claim == nil {
+	claim, err := auth.JWTCrypto.DecryptJWT(context.Request.Context(), jwtToken)
+	if err != nil || claim == nil || auth.replaced(context, claim) {
 		return false, nil
 	}
 	return true, claim
 }
 
+// SignedInElsewhere reports whether the session has been replaced by a sign in
+// with the same access code on another device
+func (auth *Auth) SignedInElsewhere(context *gin.Context) bool {
+	session := sessions.DefaultMany(context, "user_session")
+	jwtToken := session.Get(JWT_TOKEN_KEY)
+	if jwtToken == nil || jwtToken.(string) == "" {
+		return false
+	}
+
+	claim, err := auth.JWTCrypto.DecryptJWT(context.Request.Context(), jwtToken)
+	if err != nil {
+		return false
+	}
+	return auth.replaced(context, claim)
+}
+
 func (auth *Auth) Login(context *gin.Context, session sessions.Session) {
-	var uacLength = 12
-	uac := context.PostForm("uac")
-	uac = strings.ReplaceAll(uac, " ", "")
+	loginLimits := auth.loginLimits(context)
+	if auth.lockedOut(context, loginLimits) {
+		return
+	}
+
+	input := context.PostForm("uac")
 
-	if uac == "" {
+	if strings.TrimSpace(input) == "" {
 		auth.Logger.Info("Failed auth", append(utils.GetRequestSource(context),
 			zap.String("Reason", "Blank UAC"))...)
+		auth.loginFailed(context, "Blank UAC", busapi.UacInfo{})
+		auth.NotAuthWithError(context, auth.uacError(context))
+		return
+	}
+
+	uacKind, uac, validUac := auth.UacKinds.Detect(input)
+	if !validUac {
+		reason := "Invalid UAC length"
+		if auth.UacKinds.MatchesLength(input) {
+			reason = "Invalid UAC format"
+		}
+		auth.Logger.Info("Failed auth", append(utils.GetRequestSource(context),
+			zap.String("Reason", reason), auth.UacKinds.lengthField())...)
+		auth.loginFailed(context, reason, busapi.UacInfo{})
 		auth.NotAuthWithError(context, auth.uacError(context))
 		return
 	}
 
-	if auth.isUac16() {
-		uacLength = 16
+	if auth.Auditor != nil {
+		context.Set(auditUACHashKey, auth.JWTCrypto.HashUAC(uac))
 	}
 
-	if len(uac) != uacLength {
+	// Only enabled for deployments whose access codes are generated with the
+	// check character scheme declared by their kind
+	if auth.CheckUacCharacters && !uacKind.ValidCheckCharacters(uac) {
 		auth.Logger.Info("Failed auth", append(utils.GetRequestSource(context),
-			zap.String("Reason", "Invalid UAC length"), zap.Int("UACLength", uacLength))...)
-		auth.NotAuthWithError(context, auth.uacError(context))
+			zap.String("Reason", "Invalid UAC check characters"),
+			zap.String("UacKind", uacKind.Name()))...)
+		auth.loginFailed(context, "Invalid UAC check characters", busapi.UacInfo{})
+		auth.NotAuthWithError(context, auth.LanguageManager.LanguageError(CHECK_CHARACTERS_ERR, context))
 		return
 	}
 
-	uacInfo, err := auth.BusApi.GetUacInfo(uac)
+	uacInfo, err := auth.BusApi.GetUacInfo(context.Request.Context(), uac)
+	if auth.busFailed(context, err) {
+		return
+	}
+
+	if errors.Is(err, busapi.UacDisabledError) {
+		auth.Logger.Info("Failed auth", append(utils.GetRequestSource(context),
+			zap.String("Reason", "Access code disabled"),
+			zap.String("InstrumentName", uacInfo.InstrumentName),
+			zap.String("CaseID", uacInfo.CaseID),
+		)...)
+		auth.loginFailed(context, "Access code disabled", uacInfo)
+
+		if auth.failedAttempt(context, loginLimits) {
+			return
+		}
+		auth.NotAuthWithError(context, auth.LanguageManager.LanguageError(DISABLED_ERR, context))
+		return
+	}
 
 	if err != nil || uacInfo.InvalidCase() {
 		auth.Logger.Info("Failed auth", append(utils.GetRequestSource(context),
@@ -125,41 +264,41 @@ func (auth *Auth) Login(context *gin.Context, session sessions.Session) {
 			zap.String("CaseID", uacInfo.CaseID),
 			zap.Error(err),
 		)...)
+		auth.loginFailed(context, "Access code not recognised", uacInfo)
 
+		if auth.failedAttempt(context, loginLimits) {
+			return
+		}
 		auth.NotAuthWithError(context, auth.LanguageManager.LanguageError(NOT_RECOGNISED_ERR, context))
 		return
 	}
 
-	instrumentSettings, err := auth.BlaiseRestApi.GetInstrumentSettings(uacInfo.InstrumentName)
-	if err != nil {
-		if err == blaiserestapi.InstrumentNotFoundError {
-			auth.Logger.Warn("Failed auth", append(utils.GetRequestSource(context),
-				zap.String("Reason", "Instrument not installed"),
-				zap.String("Notes", "This can happen if a UAC for a non-Blaise 5 survey has been entered"),
-				zap.String("InstrumentName", uacInfo.InstrumentName),
-				zap.String("CaseID", uacInfo.CaseID),
-				zap.Error(err),
-			)...)
-			auth.InstrumentNotInstalledError(context)
+	// A household's instruments are checked once the respondent has chosen
+	// which case to open
+	sessionTimeout := DefaultAuthTimeout
+	if uacInfo.Household() {
+		uacInfo = busapi.UacInfo{Cases: uacInfo.Cases}
+	} else {
+		var open bool
+		if sessionTimeout, open = auth.instrumentOpen(context, uacInfo); !open {
 			return
 		}
-		auth.Logger.Error("Failed auth", append(utils.GetRequestSource(context),
-			zap.String("Reason", "Could not get instrument settings"),
+	}
+	if auth.inUse(context, uac) {
+		auth.Logger.Info("Failed auth", append(utils.GetRequestSource(context),
+			zap.String("Reason", "Access code in use"),
 			zap.String("InstrumentName", uacInfo.InstrumentName),
 			zap.String("CaseID", uacInfo.CaseID),
-			zap.Error(err),
 		)...)
-		auth.NotAuthWithError(context, auth.LanguageManager.LanguageError(INTERNAL_SERVER_ERR, context))
+		auth.loginFailed(context, "Access code in use", uacInfo)
+		auth.NotAuthWithError(context, auth.LanguageManager.LanguageError(IN_USE_ERR, context))
 		return
 	}
 
-	sessionTimeout := instrumentSettings.StrictInterviewing().SessionTimeout
-	if sessionTimeout == 0 {
-		sessionTimeout = DefaultAuthTimeout
-	}
 	signedToken, err := auth.JWTCrypto.EncryptJWT(uac, &uacInfo, sessionTimeout)
 	if err != nil {
 		auth.Logger.Error("Failed to Encrypt JWT", zap.Error(err))
+		auth.loginFailed(context, "Could not create session", uacInfo)
 		auth.NotAuthWithError(context, auth.LanguageManager.LanguageError(INTERNAL_SERVER_ERR, context))
 		return
 	}
@@ -168,6 +307,7 @@ func (auth *Auth) Login(context *gin.Context, session sessions.Session) {
 	session.Set(SESSION_TIMEOUT_KEY, sessionTimeout)
 	if err := session.Save(); err != nil {
 		auth.Logger.Error("Failed to save JWT to session", zap.Error(err))
+		auth.loginFailed(context, "Could not create session", uacInfo)
 		auth.NotAuthWithError(context, auth.LanguageManager.LanguageError(INTERNAL_SERVER_ERR, context))
 		return
 	}
@@ -176,10 +316,27 @@ func (auth *Auth) Login(context *gin.Context, session sessions.Session) {
 	validationSession.Set(SESSION_VALID_KEY, true)
 	if err := validationSession.Save(); err != nil {
 		auth.Logger.Error("Failed to save validationSession", zap.Error(err))
+		auth.loginFailed(context, "Could not create session", uacInfo)
 		auth.NotAuthWithError(context, auth.LanguageManager.LanguageError(INTERNAL_SERVER_ERR, context))
 		return
 	}
 
+	auth.resetAttempts(context)
+	auth.registerSession(context, signedToken)
+	auth.auditToken(context, audit.LoginSucceeded, signedToken)
+	auth.Metrics.LoginAttempt(metrics.LoginSuccess, "")
+
+	if uacInfo.Household() {
+		auth.Logger.Info("Successful auth for household",
+			append(utils.GetRequestSource(context),
+				zap.Int("Cases", len(uacInfo.Cases)),
+				zap.String("UacKind", uacKind.Name()),
+			)...)
+		context.Redirect(http.StatusFound, CASE_SELECTION_URL)
+		context.Abort()
+		return
+	}
+
 	instrumentName := strings.ReplaceAll(uacInfo.InstrumentName, "\n", "")
 	instrumentName = strings.ReplaceAll(instrumentName, "\r", "")
 
@@ -190,29 +347,255 @@ func (auth *Auth) Login(context *gin.Context, session sessions.Session) {
 		append(utils.GetRequestSource(context),
 			zap.String("InstrumentName", instrumentName),
 			zap.String("CaseID", caseID),
+			zap.String("UacKind", uacKind.Name()),
 		)...)
 
 	context.Redirect(http.StatusFound, fmt.Sprintf("/%s/", uacInfo.InstrumentName))
 	context.Abort()
 }
 
+// CaseSelection shows a household respondent the cases their access code
+// covers, so they can choose which to open
+func (auth *Auth) CaseSelection(context *gin.Context) {
+	claim, err := auth.JWTCrypto.DecryptJWT(context.Request.Context(), sessions.DefaultMany(context, "user_session").Get(JWT_TOKEN_KEY))
+	if err != nil {
+		auth.notAuth(context)
+		return
+	}
+	if !claim.UacInfo.Household() {
+		context.Redirect(http.StatusFound, fmt.Sprintf("/%s/", claim.UacInfo.InstrumentName))
+		context.Abort()
+		return
+	}
+	auth.caseSelectionPage(context, http.StatusOK, claim, "")
+}
+
+// SelectCase opens the case a household respondent chose, once its
+// instrument has passed the same checks as signing in to it directly. The
+// session token is re-issued with the chosen case, so only that case's
+// instrument can be accessed until another is chosen.
+func (auth *Auth) SelectCase(context *gin.Context, session sessions.Session) {
+	claim, err := auth.JWTCrypto.DecryptJWT(context.Request.Context(), session.Get(JWT_TOKEN_KEY))
+	if err != nil {
+		auth.notAuth(context)
+		return
+	}
+	if !claim.UacInfo.Household() {
+		context.Redirect(http.StatusFound, fmt.Sprintf("/%s/", claim.UacInfo.InstrumentName))
+		context.Abort()
+		return
+	}
+
+	context.Set(auditUACHashKey, claim.UACHash)
+	caseIndex, err := strconv.Atoi(context.PostForm("case"))
+	if err != nil || caseIndex < 0 || caseIndex >= len(claim.UacInfo.Cases) {
+		auth.Logger.Info("Invalid case selection", append(utils.GetRequestSource(context), claim.LogFields()...)...)
+		auth.loginFailed(context, "Invalid case selection", busapi.UacInfo{})
+		auth.caseSelectionPage(context, http.StatusBadRequest, claim, auth.LanguageManager.LanguageError(SELECT_CASE_ERR, context))
+		return
+	}
+	uacCase := claim.UacInfo.Cases[caseIndex]
+	uacInfo := busapi.UacInfo{
+		InstrumentName: uacCase.InstrumentName,
+		CaseID:         uacCase.CaseID,
+		Cases:          claim.UacInfo.Cases,
+	}
+	sessionTimeout, open := auth.instrumentOpen(context, uacInfo)
+	if !open {
+		return
+	}
+
+	selectedClaim := *claim
+	selectedClaim.UacInfo = uacInfo
+	selectedClaim.AuthTimeout = sessionTimeout
+	signedToken, err := auth.JWTCrypto.RefreshJWT(&selectedClaim)
+	if err != nil {
+		auth.Logger.Error("Failed to Encrypt JWT", zap.Error(err))
+		auth.loginFailed(context, "Could not create session", uacInfo)
+		auth.NotAuthWithError(context, auth.LanguageManager.LanguageError(INTERNAL_SERVER_ERR, context))
+		return
+	}
+	session.Set(JWT_TOKEN_KEY, signedToken)
+	session.Set(SESSION_TIMEOUT_KEY, sessionTimeout)
+	if err := session.Save(); err != nil {
+		auth.Logger.Error("Failed to save JWT to session", zap.Error(err))
+		auth.loginFailed(context, "Could not create session", uacInfo)
+		auth.NotAuthWithError(context, auth.LanguageManager.LanguageError(INTERNAL_SERVER_ERR, context))
+		return
+	}
+	auth.registerSession(context, signedToken)
+
+	auth.Logger.Info("Household case selected", append(utils.GetRequestSource(context), selectedClaim.LogFields()...)...)
+	auth.auditClaim(context, audit.CaseSelected, &selectedClaim)
+	context.Redirect(http.StatusFound, fmt.Sprintf("/%s/", uacInfo.InstrumentName))
+	context.Abort()
+}
+
+func (auth *Auth) caseSelectionPage(context *gin.Context, status int, claim *UACClaims, errorMessage string) {
+	context.HTML(status, "select_case.tmpl", gin.H{
+		"error":      errorMessage,
+		"cases":      claim.UacInfo.Cases,
+		"csrf_token": auth.CSRFManager.GetToken(context),
+		"welsh":      auth.LanguageManager.IsWelsh(context),
+	})
+	context.Abort()
+}
+
 func (auth *Auth) Logout(context *gin.Context, session sessions.Session) {
+	if auth.EndSession(context, session, SessionQuit) != nil {
+		auth.notAuth(context)
+		return
+	}
+	context.HTML(http.StatusOK, "logout.tmpl", gin.H{
+		"uac_kinds": auth.UacKinds,
+		"welsh":     auth.LanguageManager.IsWelsh(context),
+	})
+}
+
+// EndSession revokes the session's token, so that no copy of it can be used
+// again, and clears the session
+func (auth *Auth) EndSession(context *gin.Context, session sessions.Session, sessionEnd SessionEnd) error {
+	jwtToken := session.Get(JWT_TOKEN_KEY)
+	if jwtToken != nil && jwtToken.(string) != "" {
+		auth.auditToken(context, sessionEndEvents[sessionEnd], jwtToken)
+		auth.releaseSession(context, jwtToken)
+		if err := auth.JWTCrypto.RevokeJWT(context.Request.Context(), jwtToken); err != nil {
+			auth.Logger.Error("Failed to revoke JWT", append(utils.GetRequestSource(context), zap.Error(err))...)
+		}
+	}
+
 	session.Set(JWT_TOKEN_KEY, "")
 	session.Clear()
 	session.Options(sessions.Options{MaxAge: -1})
-	err := session.Save()
-	if err != nil || auth.clearSessionValidation(context) != nil {
-		auth.notAuth(context)
+	if err := session.Save(); err != nil {
+		return err
+	}
+	return auth.clearSessionValidation(context)
+}
+
+func (auth *Auth) SignedInElsewhereError(context *gin.Context) {
+	context.HTML(http.StatusUnauthorized, "signed_in_elsewhere.tmpl", gin.H{"welsh": auth.LanguageManager.IsWelsh(context)})
+	context.Abort()
+}
+
+// busFailed shows the service unavailable page when BUS could not say
+// whether the access code is valid, so that an outage is neither reported
+// to the respondent nor counted against them as a wrong code
+func (auth *Auth) busFailed(context *gin.Context, err error) bool {
+	var unavailableError *busapi.UnavailableError
+	var malformedResponseError *busapi.MalformedResponseError
+	reason := "BUS unavailable"
+	switch {
+	case errors.Is(err, outbound.ErrCircuitOpen):
+		auth.Logger.Warn("Failed auth", append(utils.GetRequestSource(context),
+			zap.String("Reason", reason),
+			zap.Error(err),
+		)...)
+	case errors.As(err, &unavailableError):
+		auth.Logger.Error("Failed auth", append(utils.GetRequestSource(context),
+			zap.String("Reason", reason),
+			zap.Int("RespStatusCode", unavailableError.StatusCode),
+			zap.Error(err),
+		)...)
+	case errors.As(err, &malformedResponseError):
+		reason = "Malformed BUS response"
+		auth.Logger.Error("Failed auth", append(utils.GetRequestSource(context),
+			zap.String("Reason", reason),
+			zap.Error(err),
+		)...)
+	default:
+		return false
+	}
+	auth.loginFailed(context, reason, busapi.UacInfo{})
+	ServiceUnavailable(context, auth.LanguageManager.IsWelsh(context))
+	return true
+}
+
+// inUse reports whether the access code has an active session that a new sign
+// in must not replace
+func (auth *Auth) inUse(context *gin.Context, uac string) bool {
+	if auth.ActiveSessions == nil || auth.SessionPolicy != SessionPolicyReject {
+		return false
+	}
+	_, found, err := auth.ActiveSessions.Active(auth.JWTCrypto.HashUAC(uac))
+	if err != nil {
+		auth.Logger.Error("Failed to check for an active session", append(utils.GetRequestSource(context), zap.Error(err))...)
+		return false
+	}
+	return found
+}
+
+// replaced reports whether a later sign in with the same access code has
+// taken over from the claim's session. Tokens issued before sessions were
+// registered have no ID, so cannot have been replaced.
+func (auth *Auth) replaced(context *gin.Context, claim *UACClaims) bool {
+	if auth.ActiveSessions == nil || claim == nil || claim.Id == "" {
+		return false
+	}
+	activeID, found, err := auth.ActiveSessions.Active(claim.UACHash)
+	if err != nil {
+		auth.Logger.Error("Failed to check for an active session", append(utils.GetRequestSource(context), zap.Error(err))...)
+		return false
+	}
+	return found && activeID != claim.Id
+}
+
+// registerSession makes the token the active session for its access code
+// until it times out, ending any other session
+func (auth *Auth) registerSession(context *gin.Context, signedToken string) {
+	if auth.ActiveSessions == nil {
+		return
+	}
+	claim, err := auth.JWTCrypto.DecryptJWT(context.Request.Context(), signedToken)
+	if err != nil {
+		auth.Logger.Error("Failed to register active session", append(utils.GetRequestSource(context), zap.Error(err))...)
+		return
+	}
+	if err := auth.ActiveSessions.Register(claim.UACHash, claim.Id, sessionTTL(claim)); err != nil {
+		auth.Logger.Error("Failed to register active session", append(utils.GetRequestSource(context), zap.Error(err))...)
+	}
+}
+
+// extendSession keeps a refreshed session active until it times out, unless
+// a later sign in has replaced it or it has been released, as it must not
+// take over from another session
+func (auth *Auth) extendSession(context *gin.Context, claim *UACClaims) {
+	if auth.ActiveSessions == nil || claim.Id == "" {
+		return
+	}
+	if _, err := auth.ActiveSessions.Extend(claim.UACHash, claim.Id, sessionTTL(claim)); err != nil {
+		auth.Logger.Error("Failed to extend active session", append(utils.GetRequestSource(context), zap.Error(err))...)
+	}
+}
+
+func sessionTTL(claim *UACClaims) time.Duration {
+	authTimeout := claim.AuthTimeout
+	if authTimeout == 0 {
+		authTimeout = DefaultAuthTimeout
+	}
+	return time.Duration(authTimeout) * time.Minute
+}
+
+func (auth *Auth) releaseSession(context *gin.Context, jwtToken interface{}) {
+	if auth.ActiveSessions == nil {
+		return
+	}
+	// Timed out sessions are released too, so the token's expiry is not checked
+	claim, err := auth.JWTCrypto.PeekJWT(jwtToken)
+	if err != nil {
 		return
 	}
-	context.HTML(http.StatusOK, "logout.tmpl", gin.H{"welsh": auth.LanguageManager.IsWelsh(context)})
+	if err := auth.ActiveSessions.Release(claim.UACHash, claim.Id); err != nil {
+		auth.Logger.Error("Failed to release active session", append(utils.GetRequestSource(context), zap.Error(err))...)
+	}
 }
 
 func (auth *Auth) notAuth(context *gin.Context) {
 	context.HTML(http.StatusUnauthorized, "login.tmpl", gin.H{
-		"uac16":      auth.isUac16(),
+		"uac_kinds":  auth.UacKinds,
 		"csrf_token": auth.CSRFManager.GetToken(context),
 		"welsh":      auth.LanguageManager.IsWelsh(context),
+		"csp_nonce":  utils.CSPNonce(context),
 	})
 	context.Abort()
 }
@@ -220,13 +603,169 @@ func (auth *Auth) notAuth(context *gin.Context) {
 func (auth *Auth) NotAuthWithError(context *gin.Context, errorMessage string) {
 	context.HTML(http.StatusUnauthorized, "login.tmpl", gin.H{
 		"error":      errorMessage,
-		"uac16":      auth.isUac16(),
+		"uac_kinds":  auth.UacKinds,
+		"csrf_token": auth.CSRFManager.GetToken(context),
+		"welsh":      auth.LanguageManager.IsWelsh(context),
+		"csp_nonce":  utils.CSPNonce(context),
+	})
+	context.Abort()
+}
+
+func (auth *Auth) TooManyAttempts(context *gin.Context, lockout time.Duration) {
+	context.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockout.Seconds()))))
+	context.HTML(http.StatusTooManyRequests, "login.tmpl", gin.H{
+		"error":      auth.tooManyAttemptsError(context, lockout),
+		"uac_kinds":  auth.UacKinds,
 		"csrf_token": auth.CSRFManager.GetToken(context),
 		"welsh":      auth.LanguageManager.IsWelsh(context),
+		"csp_nonce":  utils.CSPNonce(context),
 	})
 	context.Abort()
 }
 
+// restApiFailed shows the not live page when the instrument is not
+// installed, and otherwise reports that the instrument could not be checked
+func (auth *Auth) restApiFailed(context *gin.Context, uacInfo busapi.UacInfo, reason string, err error) {
+	if err == blaiserestapi.InstrumentNotFoundError {
+		auth.Logger.Warn("Failed auth", append(utils.GetRequestSource(context),
+			zap.String("Reason", "Instrument not installed"),
+			zap.String("Notes", "This can happen if a UAC for a non-Blaise 5 survey has been entered"),
+			zap.String("InstrumentName", uacInfo.InstrumentName),
+			zap.String("CaseID", uacInfo.CaseID),
+			zap.Error(err),
+		)...)
+		auth.loginFailed(context, "Instrument not installed", uacInfo)
+		auth.InstrumentNotInstalledError(context)
+		return
+	}
+	if errors.Is(err, outbound.ErrCircuitOpen) {
+		auth.Logger.Warn("Failed auth", append(utils.GetRequestSource(context),
+			zap.String("Reason", "Blaise REST API unavailable"),
+			zap.String("InstrumentName", uacInfo.InstrumentName),
+			zap.String("CaseID", uacInfo.CaseID),
+			zap.Error(err),
+		)...)
+		auth.loginFailed(context, "Blaise REST API unavailable", uacInfo)
+		ServiceUnavailable(context, auth.LanguageManager.IsWelsh(context))
+		return
+	}
+	auth.Logger.Error("Failed auth", append(utils.GetRequestSource(context),
+		zap.String("Reason", reason),
+		zap.String("InstrumentName", uacInfo.InstrumentName),
+		zap.String("CaseID", uacInfo.CaseID),
+		zap.Error(err),
+	)...)
+	auth.loginFailed(context, reason, uacInfo)
+	auth.NotAuthWithError(context, auth.LanguageManager.LanguageError(INTERNAL_SERVER_ERR, context))
+}
+
+// notLive shows the not live page when the questionnaire is installed but
+// cannot be interviewed on, rather than leaving Blaise to show an error once
+// the case is opened. Survey days are only checked when RequireSurveyDay is set.
+func (auth *Auth) notLive(context *gin.Context, uacInfo busapi.UacInfo) bool {
+	questionnaireStatus, err := auth.BlaiseRestApi.GetQuestionnaireStatus(context.Request.Context(), uacInfo.InstrumentName)
+	if err != nil {
+		auth.restApiFailed(context, uacInfo, "Could not get questionnaire status", err)
+		return true
+	}
+	if !questionnaireStatus.Live() {
+		auth.Logger.Warn("Failed auth", append(utils.GetRequestSource(context),
+			zap.String("Reason", "Questionnaire not live"),
+			zap.String("InstrumentName", uacInfo.InstrumentName),
+			zap.String("CaseID", uacInfo.CaseID),
+			zap.String("QuestionnaireStatus", string(questionnaireStatus)),
+		)...)
+		auth.loginFailed(context, "Questionnaire not live", uacInfo)
+		auth.InstrumentNotInstalledError(context)
+		return true
+	}
+	if !auth.RequireSurveyDay {
+		return false
+	}
+
+	surveyDays, err := auth.BlaiseRestApi.GetSurveyDays(context.Request.Context(), uacInfo.InstrumentName)
+	if err != nil {
+		auth.restApiFailed(context, uacInfo, "Could not get survey days", err)
+		return true
+	}
+	if !surveyDays.Includes(time.Now().In(surveyLocation)) {
+		auth.Logger.Info("Failed auth", append(utils.GetRequestSource(context),
+			zap.String("Reason", "Not a survey day"),
+			zap.String("InstrumentName", uacInfo.InstrumentName),
+			zap.String("CaseID", uacInfo.CaseID),
+		)...)
+		auth.loginFailed(context, "Not a survey day", uacInfo)
+		auth.InstrumentNotInstalledError(context)
+		return true
+	}
+	return false
+}
+
+// instrumentOpen checks the UAC's instrument can be signed in to now, and
+// returns the session timeout its settings ask for
+func (auth *Auth) instrumentOpen(context *gin.Context, uacInfo busapi.UacInfo) (int, bool) {
+	if auth.unavailable(context, uacInfo) {
+		return 0, false
+	}
+
+	instrumentSettings, err := auth.BlaiseRestApi.GetInstrumentSettings(context.Request.Context(), uacInfo.InstrumentName)
+	if err != nil {
+		auth.restApiFailed(context, uacInfo, "Could not get instrument settings", err)
+		return 0, false
+	}
+
+	if auth.notLive(context, uacInfo) {
+		return 0, false
+	}
+
+	sessionTimeout := instrumentSettings.StrictInterviewing().SessionTimeout
+	if sessionTimeout == 0 {
+		sessionTimeout = DefaultAuthTimeout
+	}
+	return sessionTimeout, true
+}
+
+// unavailable shows the not yet open or closed page when the instrument's
+// availability window does not include now
+func (auth *Auth) unavailable(context *gin.Context, uacInfo busapi.UacInfo) bool {
+	window, found := auth.AvailabilityWindows.Window(uacInfo.InstrumentName)
+	if !found {
+		return false
+	}
+	now := time.Now()
+	welsh := auth.LanguageManager.IsWelsh(context)
+	switch {
+	case window.NotYetOpen(now):
+		auth.Logger.Info("Failed auth", append(utils.GetRequestSource(context),
+			zap.String("Reason", "Instrument not yet open"),
+			zap.String("InstrumentName", uacInfo.InstrumentName),
+			zap.String("CaseID", uacInfo.CaseID),
+			zap.Time("Opens", window.Opens),
+		)...)
+		auth.loginFailed(context, "Instrument not yet open", uacInfo)
+		context.HTML(http.StatusOK, "not_yet_open.tmpl", gin.H{
+			"welsh": welsh,
+			"opens": formatAvailabilityTime(window.Opens, welsh),
+		})
+	case window.Closed(now):
+		auth.Logger.Info("Failed auth", append(utils.GetRequestSource(context),
+			zap.String("Reason", "Instrument closed"),
+			zap.String("InstrumentName", uacInfo.InstrumentName),
+			zap.String("CaseID", uacInfo.CaseID),
+			zap.Time("Closes", window.Closes),
+		)...)
+		auth.loginFailed(context, "Instrument closed", uacInfo)
+		context.HTML(http.StatusOK, "closed.tmpl", gin.H{
+			"welsh":  welsh,
+			"closes": formatAvailabilityTime(window.Closes, welsh),
+		})
+	default:
+		return false
+	}
+	context.Abort()
+	return true
+}
+
 func (auth *Auth) InstrumentNotInstalledError(context *gin.Context) {
 	context.HTML(http.StatusOK, "not_live.tmpl", gin.H{"welsh": auth.LanguageManager.IsWelsh(context)})
 	context.Abort()
@@ -244,7 +783,7 @@ func (auth *Auth) RefreshToken(context *gin.Context, session sessions.Session, c
 		return
 	}
 
-	signedToken, err := auth.JWTCrypto.EncryptJWT(claim.UAC, &claim.UacInfo, claim.AuthTimeout)
+	signedToken, err := auth.JWTCrypto.RefreshJWT(claim)
 	if err != nil {
 		auth.Logger.Error("Failed to Encrypt JWT", zap.Error(err))
 		return
@@ -255,6 +794,9 @@ func (auth *Auth) RefreshToken(context *gin.Context, session sessions.Session, c
 		auth.Logger.Error("Failed to save JWT to session", zap.Error(err))
 		return
 	}
+	auth.extendSession(context, claim)
+	auth.auditClaim(context, audit.TokenRefreshed, claim)
+	auth.Metrics.SessionRefreshed()
 }
 
 func (auth *Auth) SessionValid(context *gin.Context) bool {
@@ -274,24 +816,120 @@ func (auth *Auth) clearSessionValidation(context *gin.Context) error {
 	return validationSession.Save()
 }
 
-func (auth *Auth) isUac16() bool {
-	return auth.UacKind == "uac16"
+func (auth *Auth) uacError(context *gin.Context) string {
+	if auth.LanguageManager.IsWelsh(context) {
+		return auth.UacKinds.InvalidError()["welsh"]
+	}
+	return auth.UacKinds.InvalidError()["english"]
 }
 
-func (auth *Auth) uacError(context *gin.Context) string {
+func (auth *Auth) tooManyAttemptsError(context *gin.Context, lockout time.Duration) string {
+	minutes := int(math.Ceil(lockout.Minutes()))
 	if auth.LanguageManager.IsWelsh(context) {
-		if auth.isUac16() {
-			return fmt.Sprintf(INVALID_LENGTH_ERR["welsh"], "16 o nodau")
+		return fmt.Sprintf(TOO_MANY_ATTEMPTS_ERR["welsh"], fmt.Sprintf("%d munud", minutes))
+	}
+	if minutes == 1 {
+		return fmt.Sprintf(TOO_MANY_ATTEMPTS_ERR["english"], "1 minute")
+	}
+	return fmt.Sprintf(TOO_MANY_ATTEMPTS_ERR["english"], fmt.Sprintf("%d minutes", minutes))
+}
+
+// loginLimits rate limits logins by client IP, and by an ID kept in the
+// CSRF session so that respondents sharing an IP are also limited individually
+func (auth *Auth) loginLimits(context *gin.Context) []loginLimit {
+	return []loginLimit{
+		{limiter: auth.IPLimiter, key: utils.GetClientIP(context)},
+		{limiter: auth.SessionLimiter, key: auth.loginAttemptID(context)},
+	}
+}
+
+func (auth *Auth) loginAttemptID(context *gin.Context) string {
+	session := sessions.DefaultMany(context, "session")
+	if attemptID, ok := session.Get(LOGIN_ATTEMPT_KEY).(string); ok && attemptID != "" {
+		return attemptID
+	}
+	randomBytes := make([]byte, 16)
+	if _, err := rand.Read(randomBytes); err != nil {
+		auth.Logger.Error("Failed to generate login attempt ID", zap.Error(err))
+		return ""
+	}
+	attemptID := hex.EncodeToString(randomBytes)
+	session.Set(LOGIN_ATTEMPT_KEY, attemptID)
+	if err := session.Save(); err != nil {
+		auth.Logger.Error("Failed to save login attempt ID", zap.Error(err))
+	}
+	return attemptID
+}
+
+func (auth *Auth) lockedOut(context *gin.Context, loginLimits []loginLimit) bool {
+	var lockout time.Duration
+	for _, loginLimit := range loginLimits {
+		if loginLimit.key == "" {
+			continue
+		}
+		remaining, err := loginLimit.limiter.LockedOut(loginLimit.key)
+		if err != nil {
+			auth.Logger.Error("Failed to check login rate limit", zap.Error(err))
+			continue
+		}
+		if remaining > lockout {
+			lockout = remaining
 		}
-		return fmt.Sprintf(INVALID_LENGTH_ERR["welsh"], "12 o nodau")
 	}
-	if auth.isUac16() {
-		return fmt.Sprintf(INVALID_LENGTH_ERR["english"], "16-character")
+	if lockout == 0 {
+		return false
+	}
+	auth.Logger.Info("Failed auth", append(utils.GetRequestSource(context),
+		zap.String("Reason", "Too many attempts"), zap.Duration("Lockout", lockout))...)
+	auth.loginFailed(context, "Too many attempts", busapi.UacInfo{})
+	auth.TooManyAttempts(context, lockout)
+	return true
+}
+
+func (auth *Auth) failedAttempt(context *gin.Context, loginLimits []loginLimit) bool {
+	var lockout time.Duration
+	for _, loginLimit := range loginLimits {
+		if loginLimit.key == "" {
+			continue
+		}
+		incurred, err := loginLimit.limiter.Fail(loginLimit.key)
+		if err != nil {
+			auth.Logger.Error("Failed to record failed login attempt", zap.Error(err))
+			continue
+		}
+		if incurred > lockout {
+			lockout = incurred
+		}
+	}
+	if lockout == 0 {
+		return false
+	}
+	auth.Logger.Warn("Login locked out", append(utils.GetRequestSource(context),
+		zap.String("Reason", "Too many attempts"), zap.Duration("Lockout", lockout))...)
+	auth.TooManyAttempts(context, lockout)
+	return true
+}
+
+// resetAttempts only clears the session's failures, otherwise one valid access
+// code could be used to lift the lockout for everyone guessing from the same IP
+func (auth *Auth) resetAttempts(context *gin.Context) {
+	attemptID := auth.loginAttemptID(context)
+	if attemptID == "" {
+		return
+	}
+	if err := auth.SessionLimiter.Reset(attemptID); err != nil {
+		auth.Logger.Error("Failed to reset login attempts", zap.Error(err))
 	}
-	return fmt.Sprintf(INVALID_LENGTH_ERR["english"], "12-digit")
 }
 
 func Forbidden(context *gin.Context, welsh bool) {
 	context.HTML(http.StatusForbidden, "access_denied.tmpl", gin.H{"welsh": welsh})
 	context.Abort()
 }
+
+// ServiceUnavailable tells the respondent to come back later while a service
+// the portal depends on is failing
+func ServiceUnavailable(context *gin.Context, welsh bool) {
+	context.HTML(http.StatusServiceUnavailable, "service_unavailable.tmpl", gin.H{"welsh": welsh})
+	context.Abort()
+}
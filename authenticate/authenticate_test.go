@@ -1,12 +1,14 @@
 package authenticate_test
 
 import (
+	"context"
 	"fmt"
 	"html/template"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/ONSdigital/blaise-cawi-portal/authenticate"
 	mockauth "github.com/ONSdigital/blaise-cawi-portal/authenticate/mocks"
@@ -14,11 +16,16 @@ import (
 	mockrestapi "github.com/ONSdigital/blaise-cawi-portal/blaiserestapi/mocks"
 	"github.com/ONSdigital/blaise-cawi-portal/busapi"
 	"github.com/ONSdigital/blaise-cawi-portal/busapi/mocks"
+	"github.com/ONSdigital/blaise-cawi-portal/kvstore"
 	languageManagerMocks "github.com/ONSdigital/blaise-cawi-portal/languagemanager/mocks"
+	"github.com/ONSdigital/blaise-cawi-portal/metrics"
+	"github.com/ONSdigital/blaise-cawi-portal/outbound"
+	"github.com/ONSdigital/blaise-cawi-portal/ratelimiter"
 	"github.com/ONSdigital/blaise-cawi-portal/webserver"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
 	csrf "github.com/srbry/gin-csrf"
 	"github.com/stretchr/testify/mock"
 	"go.uber.org/zap"
@@ -29,6 +36,13 @@ import (
 	. "github.com/onsi/gomega"
 )
 
+func scrapeMetrics(portalMetrics *metrics.Metrics) string {
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/metrics", nil)
+	portalMetrics.Handler().ServeHTTP(recorder, request)
+	return recorder.Body.String()
+}
+
 var _ = Describe("Login", func() {
 	var (
 		shortUAC    = "22222"
@@ -51,6 +65,12 @@ var _ = Describe("Login", func() {
 			Secret:      "fwibble",
 			SessionName: "session",
 		}
+		loginPolicy = ratelimiter.Policy{
+			MaxAttempts: 5,
+			Window:      time.Hour,
+			BaseLockout: 30 * time.Second,
+			MaxLockout:  15 * time.Minute,
+		}
 	)
 
 	BeforeEach(func() {
@@ -59,11 +79,14 @@ var _ = Describe("Login", func() {
 		languageManagerMock = &languageManagerMocks.LanguageManagerInterface{}
 		languageManagerMock.On("IsWelsh", mock.Anything).Return(false)
 		languageManagerMock.On("LanguageError", mock.Anything, mock.Anything).Return("Access code not recognised. Enter the code again")
+		keyValueStore := &kvstore.MemoryStore{}
 		auth = &authenticate.Auth{
 			JWTCrypto:       jwtCrypto,
 			Logger:          observedLogger,
 			CSRFManager:     csrfManager,
 			LanguageManager: languageManagerMock,
+			IPLimiter:       &ratelimiter.Limiter{Name: "ip", Store: keyValueStore, Policy: loginPolicy},
+			SessionLimiter:  &ratelimiter.Limiter{Name: "session", Store: keyValueStore, Policy: loginPolicy},
 		}
 		httpRouter = gin.Default()
 		httpRouter.SetFuncMap(template.FuncMap{
@@ -93,15 +116,15 @@ var _ = Describe("Login", func() {
 
 		BeforeEach(func() {
 			uacValue = validUAC
-			auth.UacKind = "uac"
+			auth.UacKinds = authenticate.UacKinds{authenticate.Uac12}
 			mockBusApi := &mocks.BusApiInterface{}
 			auth.BusApi = mockBusApi
 
-			mockBusApi.On("GetUacInfo", validUAC).Once().Return(busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}, nil)
+			mockBusApi.On("GetUacInfo", mock.Anything, validUAC).Once().Return(busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}, nil)
 
 			mockRestApi := &mockrestapi.BlaiseRestApiInterface{}
 			auth.BlaiseRestApi = mockRestApi
-			mockRestApi.On("GetInstrumentSettings", mock.Anything).Return(blaiserestapi.InstrumentSettings{}, blaiserestapi.InstrumentNotFoundError)
+			mockRestApi.On("GetInstrumentSettings", mock.Anything, mock.Anything).Return(blaiserestapi.InstrumentSettings{}, blaiserestapi.InstrumentNotFoundError)
 		})
 
 		It("returns the not live page", func() {
@@ -123,11 +146,403 @@ var _ = Describe("Login", func() {
 		})
 	})
 
+	Context("When a questionnaire is installed", func() {
+		var (
+			mockRestApi         *mockrestapi.BlaiseRestApiInterface
+			questionnaireStatus blaiserestapi.QuestionnaireStatus
+		)
+
+		JustBeforeEach(func() {
+			mockRestApi.On("GetQuestionnaireStatus", mock.Anything, "foo").Return(questionnaireStatus, nil)
+			httpRecorder = httptest.NewRecorder()
+			data := url.Values{
+				"uac": []string{validUAC},
+			}
+			req, _ := http.NewRequest("POST", "/login", strings.NewReader(data.Encode()))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			httpRouter.ServeHTTP(httpRecorder, req)
+		})
+
+		BeforeEach(func() {
+			auth.UacKinds = authenticate.UacKinds{authenticate.Uac12}
+			mockBusApi := &mocks.BusApiInterface{}
+			auth.BusApi = mockBusApi
+			mockBusApi.On("GetUacInfo", mock.Anything, validUAC).Return(busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}, nil)
+
+			mockRestApi = &mockrestapi.BlaiseRestApiInterface{}
+			auth.BlaiseRestApi = mockRestApi
+			mockRestApi.On("GetInstrumentSettings", mock.Anything, "foo").Return(blaiserestapi.InstrumentSettings{}, nil)
+			questionnaireStatus = blaiserestapi.QuestionnaireActive
+		})
+
+		Context("but is not active", func() {
+			BeforeEach(func() {
+				questionnaireStatus = blaiserestapi.QuestionnaireErroneous
+			})
+
+			It("returns the not live page", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusOK))
+				Expect(httpRecorder.Body.String()).To(ContainSubstring(`The study is currently unavailable`))
+				Expect(session.Get(authenticate.JWT_TOKEN_KEY)).To(BeNil())
+
+				Expect(observedLogs.All()[0].Message).To(Equal("Failed auth"))
+				Expect(observedLogs.All()[0].ContextMap()["Reason"]).To(Equal("Questionnaire not live"))
+				Expect(observedLogs.All()[0].ContextMap()["QuestionnaireStatus"]).To(Equal("Erroneous"))
+				Expect(observedLogs.All()[0].Level).To(Equal(zap.WarnLevel))
+			})
+		})
+
+		Context("and survey days are required", func() {
+			BeforeEach(func() {
+				auth.RequireSurveyDay = true
+			})
+
+			Context("but today is not a survey day", func() {
+				BeforeEach(func() {
+					mockRestApi.On("GetSurveyDays", mock.Anything, "foo").Return(blaiserestapi.SurveyDays{
+						time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC),
+					}, nil)
+				})
+
+				It("returns the not live page", func() {
+					Expect(httpRecorder.Code).To(Equal(http.StatusOK))
+					Expect(httpRecorder.Body.String()).To(ContainSubstring(`The study is currently unavailable`))
+					Expect(observedLogs.All()[0].ContextMap()["Reason"]).To(Equal("Not a survey day"))
+				})
+			})
+
+			Context("and today is a survey day", func() {
+				BeforeEach(func() {
+					// Survey days are dates in London, which can differ from the date here
+					london, err := time.LoadLocation("Europe/London")
+					Expect(err).To(BeNil())
+					today := time.Now().In(london)
+					mockRestApi.On("GetSurveyDays", mock.Anything, "foo").Return(blaiserestapi.SurveyDays{
+						time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC),
+					}, nil)
+				})
+
+				It("signs the respondent in", func() {
+					Expect(httpRecorder.Code).To(Equal(http.StatusFound))
+				})
+			})
+		})
+
+		Context("and survey days are not required", func() {
+			It("does not check them", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusFound))
+				mockRestApi.AssertNotCalled(GinkgoT(), "GetSurveyDays", mock.Anything, mock.Anything)
+			})
+		})
+	})
+
+	Context("When the instrument has an availability window", func() {
+		var mockRestApi *mockrestapi.BlaiseRestApiInterface
+
+		JustBeforeEach(func() {
+			httpRecorder = httptest.NewRecorder()
+			data := url.Values{
+				"uac": []string{validUAC},
+			}
+			req, _ := http.NewRequest("POST", "/login", strings.NewReader(data.Encode()))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			httpRouter.ServeHTTP(httpRecorder, req)
+		})
+
+		BeforeEach(func() {
+			auth.UacKinds = authenticate.UacKinds{authenticate.Uac12}
+			mockBusApi := &mocks.BusApiInterface{}
+			auth.BusApi = mockBusApi
+			mockBusApi.On("GetUacInfo", mock.Anything, validUAC).Return(busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}, nil)
+
+			mockRestApi = &mockrestapi.BlaiseRestApiInterface{}
+			auth.BlaiseRestApi = mockRestApi
+			mockRestApi.On("GetInstrumentSettings", mock.Anything, "foo").Return(blaiserestapi.InstrumentSettings{}, nil)
+			mockRestApi.On("GetQuestionnaireStatus", mock.Anything, "foo").Return(blaiserestapi.QuestionnaireActive, nil)
+		})
+
+		Context("that has not opened yet", func() {
+			BeforeEach(func() {
+				auth.AvailabilityWindows = authenticate.AvailabilityWindows{
+					{Instrument: "f*", Opens: time.Date(2999, 1, 4, 9, 0, 0, 0, time.UTC)},
+				}
+			})
+
+			It("returns the not yet open page with the opening date", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusOK))
+				Expect(httpRecorder.Body.String()).To(ContainSubstring(`This study is not open yet`))
+				Expect(httpRecorder.Body.String()).To(ContainSubstring(`You can start the study from 4 January 2999 at 09:00.`))
+				Expect(session.Get(authenticate.JWT_TOKEN_KEY)).To(BeNil())
+				mockRestApi.AssertNotCalled(GinkgoT(), "GetInstrumentSettings", mock.Anything, mock.Anything)
+
+				Expect(observedLogs.All()[0].Message).To(Equal("Failed auth"))
+				Expect(observedLogs.All()[0].ContextMap()["Reason"]).To(Equal("Instrument not yet open"))
+				Expect(observedLogs.All()[0].ContextMap()["InstrumentName"]).To(Equal("foo"))
+			})
+		})
+
+		Context("that has closed", func() {
+			BeforeEach(func() {
+				auth.AvailabilityWindows = authenticate.AvailabilityWindows{
+					{Instrument: "foo", Closes: time.Date(2021, 7, 1, 12, 30, 0, 0, time.UTC)},
+				}
+			})
+
+			It("returns the closed page with the closing date in UK time", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusOK))
+				Expect(httpRecorder.Body.String()).To(ContainSubstring(`This study has now closed`))
+				Expect(httpRecorder.Body.String()).To(ContainSubstring(`The study closed on 1 July 2021 at 13:30.`))
+				Expect(session.Get(authenticate.JWT_TOKEN_KEY)).To(BeNil())
+				Expect(observedLogs.All()[0].ContextMap()["Reason"]).To(Equal("Instrument closed"))
+			})
+
+			Context("in Welsh", func() {
+				BeforeEach(func() {
+					languageManagerMock.ExpectedCalls = nil
+					languageManagerMock.On("IsWelsh", mock.Anything).Return(true)
+				})
+
+				It("returns the Welsh closed page", func() {
+					Expect(httpRecorder.Body.String()).To(ContainSubstring(`Mae'r astudiaeth hon wedi cau`))
+					Expect(httpRecorder.Body.String()).To(ContainSubstring(`Caeodd yr astudiaeth ar 1 Gorffennaf 2021 am 13:30.`))
+				})
+			})
+		})
+
+		Context("that is open", func() {
+			BeforeEach(func() {
+				auth.AvailabilityWindows = authenticate.AvailabilityWindows{
+					{Instrument: "foo", Opens: time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC), Closes: time.Date(2999, 1, 1, 0, 0, 0, 0, time.UTC)},
+				}
+			})
+
+			It("signs the respondent in", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusFound))
+				Expect(httpRecorder.Header().Get("Location")).To(Equal("/foo/"))
+			})
+		})
+	})
+
+	Context("When the UAC covers a household", func() {
+		var (
+			mockRestApi *mockrestapi.BlaiseRestApiInterface
+			cookies     []*http.Cookie
+			cases       = []busapi.UacCase{
+				{InstrumentName: "lms2101a", CaseID: "100001", Label: "Alex"},
+				{InstrumentName: "lms2101b", CaseID: "100002", Label: "Sam"},
+			}
+		)
+
+		serve := func(method, path string, data url.Values) *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest(method, path, strings.NewReader(data.Encode()))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			for _, cookie := range cookies {
+				req.AddCookie(cookie)
+			}
+			httpRouter.ServeHTTP(recorder, req)
+			cookies = append(cookies, recorder.Result().Cookies()...)
+			return recorder
+		}
+
+		sessionClaim := func() *authenticate.UACClaims {
+			claim, err := jwtCrypto.DecryptJWT(context.Background(), session.Get(authenticate.JWT_TOKEN_KEY))
+			Expect(err).To(BeNil())
+			return claim
+		}
+
+		BeforeEach(func() {
+			cookies = nil
+			auth.UacKinds = authenticate.UacKinds{authenticate.Uac12}
+			mockBusApi := &mocks.BusApiInterface{}
+			auth.BusApi = mockBusApi
+			mockBusApi.On("GetUacInfo", mock.Anything, validUAC).Return(busapi.UacInfo{Cases: cases}, nil)
+			mockRestApi = &mockrestapi.BlaiseRestApiInterface{}
+			auth.BlaiseRestApi = mockRestApi
+
+			httpRouter.GET("/select-case", func(context *gin.Context) {
+				session = sessions.DefaultMany(context, "user_session")
+				auth.CaseSelection(context)
+			})
+			httpRouter.POST("/select-case", func(context *gin.Context) {
+				session = sessions.DefaultMany(context, "user_session")
+				auth.SelectCase(context, session)
+			})
+		})
+
+		It("signs in and asks which case to open", func() {
+			recorder := serve("POST", "/login", url.Values{"uac": []string{validUAC}})
+			Expect(recorder.Code).To(Equal(http.StatusFound))
+			Expect(recorder.Header().Get("Location")).To(Equal(authenticate.CASE_SELECTION_URL))
+			mockRestApi.AssertNotCalled(GinkgoT(), "GetInstrumentSettings", mock.Anything, mock.Anything)
+
+			claim := sessionClaim()
+			Expect(claim.CaseSelectionRequired()).To(BeTrue())
+			Expect(claim.UacInfo.Cases).To(Equal(cases))
+			Expect(observedLogs.All()[0].Message).To(Equal("Successful auth for household"))
+			Expect(observedLogs.All()[0].ContextMap()["Cases"]).To(Equal(int64(2)))
+		})
+
+		It("lists the cases to choose from", func() {
+			serve("POST", "/login", url.Values{"uac": []string{validUAC}})
+			recorder := serve("GET", "/select-case", nil)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(ContainSubstring(`Choose which study to open`))
+			Expect(recorder.Body.String()).To(ContainSubstring(`Alex`))
+			Expect(recorder.Body.String()).To(ContainSubstring(`Sam`))
+		})
+
+		Context("and a case is chosen", func() {
+			BeforeEach(func() {
+				mockRestApi.On("GetInstrumentSettings", mock.Anything, "lms2101b").Return(blaiserestapi.InstrumentSettings{
+					{Type: "StrictInterviewing", SessionTimeout: 30},
+				}, nil)
+			})
+
+			It("opens the chosen case", func() {
+				mockRestApi.On("GetQuestionnaireStatus", mock.Anything, "lms2101b").Return(blaiserestapi.QuestionnaireActive, nil)
+				serve("POST", "/login", url.Values{"uac": []string{validUAC}})
+				recorder := serve("POST", "/select-case", url.Values{"case": []string{"1"}})
+				Expect(recorder.Code).To(Equal(http.StatusFound))
+				Expect(recorder.Header().Get("Location")).To(Equal("/lms2101b/"))
+
+				claim := sessionClaim()
+				Expect(claim.CaseSelectionRequired()).To(BeFalse())
+				Expect(claim.UacInfo.InstrumentName).To(Equal("lms2101b"))
+				Expect(claim.UacInfo.CaseID).To(Equal("100002"))
+				Expect(claim.AuthTimeout).To(Equal(30))
+				Expect(claim.AuthenticatedForCase("100002")).To(BeTrue())
+				Expect(claim.AuthenticatedForCase("100001")).To(BeFalse())
+				Expect(session.Get(authenticate.SESSION_TIMEOUT_KEY)).To(Equal(30))
+				Expect(observedLogs.FilterMessage("Household case selected").Len()).To(Equal(1))
+			})
+
+			It("does not open a case whose questionnaire is not live", func() {
+				mockRestApi.On("GetQuestionnaireStatus", mock.Anything, "lms2101b").Return(blaiserestapi.QuestionnaireInactive, nil)
+				serve("POST", "/login", url.Values{"uac": []string{validUAC}})
+				recorder := serve("POST", "/select-case", url.Values{"case": []string{"1"}})
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				Expect(recorder.Body.String()).To(ContainSubstring(`The study is currently unavailable`))
+				Expect(sessionClaim().CaseSelectionRequired()).To(BeTrue())
+			})
+		})
+
+		It("asks again when no case is chosen", func() {
+			serve("POST", "/login", url.Values{"uac": []string{validUAC}})
+			recorder := serve("POST", "/select-case", url.Values{"case": []string{"2"}})
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(recorder.Body.String()).To(ContainSubstring(`Choose which study to open`))
+			Expect(recorder.Body.String()).To(ContainSubstring(`There is a problem with this page`))
+			Expect(observedLogs.FilterMessage("Invalid case selection").Len()).To(Equal(1))
+		})
+
+		It("shows the login page without a session", func() {
+			recorder := serve("POST", "/select-case", url.Values{"case": []string{"1"}})
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Context("When a service the portal depends on is unavailable", func() {
+		var (
+			mockBusApi  *mocks.BusApiInterface
+			mockRestApi *mockrestapi.BlaiseRestApiInterface
+		)
+
+		postLogin := func() *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+			data := url.Values{
+				"uac": []string{validUAC},
+			}
+			req, _ := http.NewRequest("POST", "/login", strings.NewReader(data.Encode()))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			httpRouter.ServeHTTP(recorder, req)
+			return recorder
+		}
+
+		BeforeEach(func() {
+			auth.UacKinds = authenticate.UacKinds{authenticate.Uac12}
+			mockBusApi = &mocks.BusApiInterface{}
+			auth.BusApi = mockBusApi
+			mockRestApi = &mockrestapi.BlaiseRestApiInterface{}
+			auth.BlaiseRestApi = mockRestApi
+		})
+
+		Context("and the BUS circuit breaker is open", func() {
+			BeforeEach(func() {
+				mockBusApi.On("GetUacInfo", mock.Anything, validUAC).Return(busapi.UacInfo{}, fmt.Errorf("bus: %w", outbound.ErrCircuitOpen))
+			})
+
+			It("returns the service unavailable page", func() {
+				recorder := postLogin()
+				Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(recorder.Body.String()).To(ContainSubstring(`Sorry, the service is unavailable at the moment`))
+				Expect(observedLogs.All()[0].ContextMap()["Reason"]).To(Equal("BUS unavailable"))
+				Expect(observedLogs.All()[0].Level).To(Equal(zap.WarnLevel))
+			})
+
+			It("does not count as a failed attempt", func() {
+				for i := 0; i < 6; i++ {
+					Expect(postLogin().Code).To(Equal(http.StatusServiceUnavailable))
+				}
+			})
+		})
+
+		Context("and BUS is failing", func() {
+			BeforeEach(func() {
+				mockBusApi.On("GetUacInfo", mock.Anything, validUAC).Return(busapi.UacInfo{}, &busapi.UnavailableError{StatusCode: 500})
+			})
+
+			It("returns the service unavailable page", func() {
+				recorder := postLogin()
+				Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(recorder.Body.String()).To(ContainSubstring(`Sorry, the service is unavailable at the moment`))
+				Expect(recorder.Body.String()).ToNot(ContainSubstring(`Access code not recognised`))
+				Expect(observedLogs.All()[0].ContextMap()["Reason"]).To(Equal("BUS unavailable"))
+				Expect(observedLogs.All()[0].ContextMap()["RespStatusCode"]).To(Equal(int64(500)))
+				Expect(observedLogs.All()[0].Level).To(Equal(zap.ErrorLevel))
+			})
+
+			It("does not count as a failed attempt", func() {
+				for i := 0; i < 6; i++ {
+					Expect(postLogin().Code).To(Equal(http.StatusServiceUnavailable))
+				}
+			})
+		})
+
+		Context("and BUS responds with something other than UAC info", func() {
+			BeforeEach(func() {
+				mockBusApi.On("GetUacInfo", mock.Anything, validUAC).Return(busapi.UacInfo{}, &busapi.MalformedResponseError{Err: fmt.Errorf("invalid character '<'")})
+			})
+
+			It("returns the service unavailable page", func() {
+				recorder := postLogin()
+				Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(observedLogs.All()[0].ContextMap()["Reason"]).To(Equal("Malformed BUS response"))
+			})
+		})
+
+		Context("and the Blaise REST API circuit breaker is open", func() {
+			BeforeEach(func() {
+				mockBusApi.On("GetUacInfo", mock.Anything, validUAC).Return(busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}, nil)
+				mockRestApi.On("GetInstrumentSettings", mock.Anything, "foo").Return(nil, fmt.Errorf("blaise-rest-api: %w", outbound.ErrCircuitOpen))
+			})
+
+			It("returns the service unavailable page", func() {
+				recorder := postLogin()
+				Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(recorder.Body.String()).To(ContainSubstring(`Sorry, the service is unavailable at the moment`))
+				Expect(observedLogs.All()[0].ContextMap()["Reason"]).To(Equal("Blaise REST API unavailable"))
+				Expect(session.Get(authenticate.JWT_TOKEN_KEY)).To(BeNil())
+			})
+		})
+	})
+
 	Context("When instrument settings does not error", func() {
 		BeforeEach(func() {
 			mockRestApi := &mockrestapi.BlaiseRestApiInterface{}
 			auth.BlaiseRestApi = mockRestApi
-			mockRestApi.On("GetInstrumentSettings", mock.Anything).Return(blaiserestapi.InstrumentSettings{}, nil)
+			mockRestApi.On("GetInstrumentSettings", mock.Anything, mock.Anything).Return(blaiserestapi.InstrumentSettings{}, nil)
+			mockRestApi.On("GetQuestionnaireStatus", mock.Anything, mock.Anything).Return(blaiserestapi.QuestionnaireActive, nil)
 		})
 
 		Context("Login with a correct length, invalid UAC Code", func() {
@@ -146,11 +561,11 @@ var _ = Describe("Login", func() {
 
 			BeforeEach(func() {
 				uacValue = validUAC
-				auth.UacKind = "uac"
+				auth.UacKinds = authenticate.UacKinds{authenticate.Uac12}
 				mockBusApi := &mocks.BusApiInterface{}
 				auth.BusApi = mockBusApi
 
-				mockBusApi.On("GetUacInfo", validUAC).Once().Return(busapi.UacInfo{InstrumentName: "", CaseID: "bar"}, nil)
+				mockBusApi.On("GetUacInfo", mock.Anything, validUAC).Once().Return(busapi.UacInfo{InstrumentName: "", CaseID: "bar"}, nil)
 			})
 
 			It("returns a status unauthorised with an error", func() {
@@ -169,6 +584,104 @@ var _ = Describe("Login", func() {
 				Expect(observedLogs.All()[0].ContextMap()["error"]).To(BeNil())
 				Expect(observedLogs.All()[0].Level).To(Equal(zap.InfoLevel))
 			})
+
+			Context("when measured", func() {
+				BeforeEach(func() {
+					auth.Metrics = metrics.New()
+				})
+
+				It("counts the failed attempt with its reason", func() {
+					Expect(scrapeMetrics(auth.Metrics)).To(ContainSubstring(
+						`cawi_portal_login_attempts_total{outcome="failure",reason="Access code not recognised"} 1`,
+					))
+				})
+			})
+		})
+
+		Context("Login with a disabled UAC Code", func() {
+			BeforeEach(func() {
+				auth.UacKinds = authenticate.UacKinds{authenticate.Uac12}
+				mockBusApi := &mocks.BusApiInterface{}
+				auth.BusApi = mockBusApi
+				mockBusApi.On("GetUacInfo", mock.Anything, validUAC).Return(busapi.UacInfo{InstrumentName: "foo", CaseID: "bar", Disabled: true}, busapi.UacDisabledError)
+				languageManagerMock.ExpectedCalls = nil
+				languageManagerMock.On("IsWelsh", mock.Anything).Return(false)
+				languageManagerMock.On("LanguageError", authenticate.DISABLED_ERR, mock.Anything).Return(authenticate.DISABLED_ERR["english"])
+
+				httpRecorder = httptest.NewRecorder()
+				data := url.Values{
+					"uac": []string{validUAC},
+				}
+				req, _ := http.NewRequest("POST", "/login", strings.NewReader(data.Encode()))
+				req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+				httpRouter.ServeHTTP(httpRecorder, req)
+			})
+
+			It("tells the respondent the code can no longer be used", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusUnauthorized))
+				Expect(httpRecorder.Body.String()).To(ContainSubstring(`This access code can no longer be used`))
+				Expect(session.Get(authenticate.JWT_TOKEN_KEY)).To(BeNil())
+
+				Expect(observedLogs.All()[0].ContextMap()["Reason"]).To(Equal("Access code disabled"))
+				Expect(observedLogs.All()[0].ContextMap()["InstrumentName"]).To(Equal("foo"))
+				Expect(observedLogs.All()[0].ContextMap()["CaseID"]).To(Equal("bar"))
+			})
+		})
+
+		Context("Login with too many invalid UAC Codes from the same IP", func() {
+			var mockBusApi *mocks.BusApiInterface
+
+			postLogin := func() *httptest.ResponseRecorder {
+				recorder := httptest.NewRecorder()
+				data := url.Values{
+					"uac": []string{validUAC},
+				}
+				req, _ := http.NewRequest("POST", "/login", strings.NewReader(data.Encode()))
+				req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+				req.RemoteAddr = "1.1.1.1"
+				httpRouter.ServeHTTP(recorder, req)
+				return recorder
+			}
+
+			BeforeEach(func() {
+				auth.UacKinds = authenticate.UacKinds{authenticate.Uac12}
+				mockBusApi = &mocks.BusApiInterface{}
+				auth.BusApi = mockBusApi
+				auth.IPLimiter = &ratelimiter.Limiter{
+					Name:  "ip",
+					Store: &kvstore.MemoryStore{},
+					Policy: ratelimiter.Policy{
+						MaxAttempts: 1,
+						Window:      time.Hour,
+						BaseLockout: 30 * time.Second,
+						MaxLockout:  15 * time.Minute,
+					},
+				}
+
+				mockBusApi.On("GetUacInfo", mock.Anything, validUAC).Return(busapi.UacInfo{}, nil)
+			})
+
+			It("locks out the IP once the maximum attempts are used up", func() {
+				Expect(postLogin().Code).To(Equal(http.StatusUnauthorized))
+
+				lockedOut := postLogin()
+				Expect(lockedOut.Code).To(Equal(http.StatusTooManyRequests))
+				Expect(lockedOut.Header().Get("Retry-After")).To(Equal("30"))
+				Expect(lockedOut.Body.String()).To(ContainSubstring(`Too many attempts. Wait 1 minute and enter your access code again`))
+				mockBusApi.AssertNumberOfCalls(GinkgoT(), "GetUacInfo", 2)
+			})
+
+			It("does not call BUS while locked out", func() {
+				_ = postLogin()
+				_ = postLogin()
+
+				stillLockedOut := postLogin()
+				Expect(stillLockedOut.Code).To(Equal(http.StatusTooManyRequests))
+				mockBusApi.AssertNumberOfCalls(GinkgoT(), "GetUacInfo", 2)
+
+				Expect(observedLogs.All()[observedLogs.Len()-1].Message).To(Equal("Failed auth"))
+				Expect(observedLogs.All()[observedLogs.Len()-1].ContextMap()["Reason"]).To(Equal("Too many attempts"))
+			})
 		})
 
 		Context("Login with a valid UAC Code", func() {
@@ -187,41 +700,55 @@ var _ = Describe("Login", func() {
 			Context("Login with a 12 digit UAC kind", func() {
 				BeforeEach(func() {
 					uacValue = validUAC
-					auth.UacKind = "uac"
+					auth.UacKinds = authenticate.UacKinds{authenticate.Uac12}
 					mockBusApi := &mocks.BusApiInterface{}
 					auth.BusApi = mockBusApi
 
-					mockBusApi.On("GetUacInfo", validUAC).Once().Return(busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}, nil)
+					mockBusApi.On("GetUacInfo", mock.Anything, validUAC).Once().Return(busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}, nil)
 				})
 
 				It("redirects to /:instrumentName/", func() {
 					Expect(httpRecorder.Code).To(Equal(http.StatusFound))
 					Expect(httpRecorder.Header()["Location"]).To(Equal([]string{"/foo/"}))
 					Expect(httpRecorder.Result().Cookies()).ToNot(BeEmpty())
-					decryptedToken, _ := auth.JWTCrypto.DecryptJWT(session.Get(authenticate.JWT_TOKEN_KEY))
-					Expect(decryptedToken.UAC).To(Equal(validUAC))
+					decryptedToken, _ := auth.JWTCrypto.DecryptJWT(context.Background(), session.Get(authenticate.JWT_TOKEN_KEY))
+					Expect(decryptedToken.UACHash).To(Equal(jwtCrypto.HashUAC(validUAC)))
+					Expect(session.Get(authenticate.JWT_TOKEN_KEY)).ToNot(ContainSubstring(validUAC))
 					Expect(decryptedToken.UacInfo.InstrumentName).To(Equal("foo"))
 					Expect(decryptedToken.UacInfo.CaseID).To(Equal("bar"))
 					Expect(session.Get(authenticate.SESSION_TIMEOUT_KEY).(int)).To(Equal(15))
 				})
+
+				Context("when measured", func() {
+					BeforeEach(func() {
+						auth.Metrics = metrics.New()
+					})
+
+					It("counts the successful attempt", func() {
+						Expect(scrapeMetrics(auth.Metrics)).To(ContainSubstring(
+							`cawi_portal_login_attempts_total{outcome="success",reason=""} 1`,
+						))
+					})
+				})
 			})
 
 			Context("Login with a 16 character UAC kind", func() {
 				BeforeEach(func() {
 					uacValue = validUAC16
-					auth.UacKind = "uac16"
+					auth.UacKinds = authenticate.UacKinds{authenticate.Uac16}
 					mockBusApi := &mocks.BusApiInterface{}
 					auth.BusApi = mockBusApi
 
-					mockBusApi.On("GetUacInfo", validUAC16).Once().Return(busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}, nil)
+					mockBusApi.On("GetUacInfo", mock.Anything, validUAC16).Once().Return(busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}, nil)
 				})
 
 				It("redirects to /:instrumentName/", func() {
 					Expect(httpRecorder.Code).To(Equal(http.StatusFound))
 					Expect(httpRecorder.Header()["Location"]).To(Equal([]string{"/foo/"}))
 					Expect(httpRecorder.Result().Cookies()).ToNot(BeEmpty())
-					decryptedToken, _ := auth.JWTCrypto.DecryptJWT(session.Get(authenticate.JWT_TOKEN_KEY))
-					Expect(decryptedToken.UAC).To(Equal(validUAC16))
+					decryptedToken, _ := auth.JWTCrypto.DecryptJWT(context.Background(), session.Get(authenticate.JWT_TOKEN_KEY))
+					Expect(decryptedToken.UACHash).To(Equal(jwtCrypto.HashUAC(validUAC16)))
+					Expect(session.Get(authenticate.JWT_TOKEN_KEY)).ToNot(ContainSubstring(validUAC16))
 					Expect(decryptedToken.UacInfo.InstrumentName).To(Equal("foo"))
 					Expect(decryptedToken.UacInfo.CaseID).To(Equal("bar"))
 					Expect(session.Get(authenticate.SESSION_TIMEOUT_KEY).(int)).To(Equal(15))
@@ -230,6 +757,192 @@ var _ = Describe("Login", func() {
 
 		})
 
+		Context("Login when several UAC kinds are accepted", func() {
+			var (
+				uacValue   string
+				mockBusApi *mocks.BusApiInterface
+			)
+
+			JustBeforeEach(func() {
+				httpRecorder = httptest.NewRecorder()
+				data := url.Values{
+					"uac": []string{uacValue},
+				}
+				req, _ := http.NewRequest("POST", "/login", strings.NewReader(data.Encode()))
+				req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+				req.RemoteAddr = "1.1.1.1"
+				httpRouter.ServeHTTP(httpRecorder, req)
+			})
+
+			BeforeEach(func() {
+				auth.UacKinds = authenticate.UacKinds{authenticate.Uac12, authenticate.Uac16}
+				mockBusApi = &mocks.BusApiInterface{}
+				auth.BusApi = mockBusApi
+				mockBusApi.On("GetUacInfo", mock.Anything, validUAC16).Once().Return(busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}, nil)
+			})
+
+			Context("with a 16 character UAC", func() {
+				BeforeEach(func() {
+					uacValue = spacedUAC16
+				})
+
+				It("detects the kind and redirects to /:instrumentName/", func() {
+					Expect(httpRecorder.Code).To(Equal(http.StatusFound))
+					Expect(httpRecorder.Header()["Location"]).To(Equal([]string{"/foo/"}))
+					Expect(observedLogs.All()[0].ContextMap()["UacKind"]).To(Equal("uac16"))
+				})
+			})
+
+			Context("with a UAC that is the right length but the wrong format", func() {
+				BeforeEach(func() {
+					uacValue = "12345678901a"
+				})
+
+				It("returns a status unauthorised with an error for every kind", func() {
+					Expect(httpRecorder.Code).To(Equal(http.StatusUnauthorized))
+					Expect(httpRecorder.Body.String()).To(ContainSubstring(`Enter your 12-digit or 16-character access code`))
+					mockBusApi.AssertNotCalled(GinkgoT(), "GetUacInfo", mock.Anything, mock.Anything)
+
+					Expect(observedLogs.Len()).To(Equal(1))
+					Expect(observedLogs.All()[0].ContextMap()["Reason"]).To(Equal("Invalid UAC format"))
+					Expect(observedLogs.All()[0].ContextMap()["UACLengths"]).To(Equal([]interface{}{12, 16}))
+				})
+			})
+		})
+
+		Context("Login with check character validation enabled", func() {
+			var (
+				uacValue   string
+				mockBusApi *mocks.BusApiInterface
+			)
+
+			JustBeforeEach(func() {
+				httpRecorder = httptest.NewRecorder()
+				data := url.Values{
+					"uac": []string{uacValue},
+				}
+				req, _ := http.NewRequest("POST", "/login", strings.NewReader(data.Encode()))
+				req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+				httpRouter.ServeHTTP(httpRecorder, req)
+			})
+
+			BeforeEach(func() {
+				auth.UacKinds = authenticate.UacKinds{authenticate.Uac12}
+				auth.CheckUacCharacters = true
+				mockBusApi = &mocks.BusApiInterface{}
+				auth.BusApi = mockBusApi
+				mockBusApi.On("GetUacInfo", mock.Anything, "123456789015").Once().Return(busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}, nil)
+			})
+
+			Context("with a UAC that has valid check characters", func() {
+				BeforeEach(func() {
+					uacValue = "1234 5678 9015"
+				})
+
+				It("redirects to /:instrumentName/", func() {
+					Expect(httpRecorder.Code).To(Equal(http.StatusFound))
+					mockBusApi.AssertNumberOfCalls(GinkgoT(), "GetUacInfo", 1)
+				})
+			})
+
+			Context("with a mistyped UAC", func() {
+				BeforeEach(func() {
+					uacValue = "1234 5678 9051"
+				})
+
+				It("returns a status unauthorised without calling BUS", func() {
+					Expect(httpRecorder.Code).To(Equal(http.StatusUnauthorized))
+					mockBusApi.AssertNotCalled(GinkgoT(), "GetUacInfo", mock.Anything, mock.Anything)
+					languageManagerMock.AssertCalled(GinkgoT(), "LanguageError", authenticate.CHECK_CHARACTERS_ERR, mock.Anything)
+
+					Expect(observedLogs.Len()).To(Equal(1))
+					Expect(observedLogs.All()[0].ContextMap()["Reason"]).To(Equal("Invalid UAC check characters"))
+				})
+			})
+		})
+
+		Context("Login when the access code already has an active session", func() {
+			var (
+				activeSessions *authenticate.ActiveSessions
+				uacValue       string
+			)
+
+			JustBeforeEach(func() {
+				httpRecorder = httptest.NewRecorder()
+				data := url.Values{
+					"uac": []string{uacValue},
+				}
+				req, _ := http.NewRequest("POST", "/login", strings.NewReader(data.Encode()))
+				req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+				httpRouter.ServeHTTP(httpRecorder, req)
+			})
+
+			BeforeEach(func() {
+				uacValue = validUAC
+				auth.UacKinds = authenticate.UacKinds{authenticate.Uac12}
+				mockBusApi := &mocks.BusApiInterface{}
+				auth.BusApi = mockBusApi
+				mockBusApi.On("GetUacInfo", mock.Anything, validUAC).Once().Return(busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}, nil)
+
+				activeSessions = &authenticate.ActiveSessions{Store: &kvstore.MemoryStore{}}
+				auth.ActiveSessions = activeSessions
+				_ = activeSessions.Register(jwtCrypto.HashUAC(validUAC), "other-session", time.Hour)
+			})
+
+			Context("and the policy is to replace it", func() {
+				BeforeEach(func() {
+					auth.SessionPolicy = authenticate.SessionPolicyReplace
+				})
+
+				It("signs in and becomes the active session", func() {
+					Expect(httpRecorder.Code).To(Equal(http.StatusFound))
+
+					decryptedToken, _ := jwtCrypto.DecryptJWT(context.Background(), session.Get(authenticate.JWT_TOKEN_KEY))
+					activeID, found, _ := activeSessions.Active(jwtCrypto.HashUAC(validUAC))
+					Expect(found).To(BeTrue())
+					Expect(activeID).To(Equal(decryptedToken.Id))
+				})
+			})
+
+			Context("and the policy is to reject the new sign in", func() {
+				BeforeEach(func() {
+					auth.SessionPolicy = authenticate.SessionPolicyReject
+				})
+
+				It("returns a status unauthorised and keeps the active session", func() {
+					Expect(httpRecorder.Code).To(Equal(http.StatusUnauthorized))
+					languageManagerMock.AssertCalled(GinkgoT(), "LanguageError", authenticate.IN_USE_ERR, mock.Anything)
+					Expect(session.Get(authenticate.JWT_TOKEN_KEY)).To(BeNil())
+
+					activeID, _, _ := activeSessions.Active(jwtCrypto.HashUAC(validUAC))
+					Expect(activeID).To(Equal("other-session"))
+
+					Expect(observedLogs.Len()).To(Equal(1))
+					Expect(observedLogs.All()[0].ContextMap()["Reason"]).To(Equal("Access code in use"))
+				})
+			})
+
+			Context("and the policy is to reject a sign in with the code typed in another case", func() {
+				BeforeEach(func() {
+					auth.SessionPolicy = authenticate.SessionPolicyReject
+					uacValue = strings.ToUpper(validUAC16)
+					auth.UacKinds = authenticate.UacKinds{authenticate.Uac16}
+					mockBusApi := &mocks.BusApiInterface{}
+					auth.BusApi = mockBusApi
+					mockBusApi.On("GetUacInfo", mock.Anything, uacValue).Once().Return(busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}, nil)
+					_ = activeSessions.Register(jwtCrypto.HashUAC(validUAC16), "other-session", time.Hour)
+				})
+
+				It("returns a status unauthorised and keeps the active session", func() {
+					Expect(httpRecorder.Code).To(Equal(http.StatusUnauthorized))
+					languageManagerMock.AssertCalled(GinkgoT(), "LanguageError", authenticate.IN_USE_ERR, mock.Anything)
+
+					activeID, _, _ := activeSessions.Active(jwtCrypto.HashUAC(validUAC16))
+					Expect(activeID).To(Equal("other-session"))
+				})
+			})
+		})
+
 		Context("Login with a valid UAC Code containing whitespace", func() {
 			var uacValue string
 
@@ -246,19 +959,20 @@ var _ = Describe("Login", func() {
 			Context("Login with a 12 digit UAC kind", func() {
 				BeforeEach(func() {
 					uacValue = spacedUAC
-					auth.UacKind = "uac"
+					auth.UacKinds = authenticate.UacKinds{authenticate.Uac12}
 					mockBusApi := &mocks.BusApiInterface{}
 					auth.BusApi = mockBusApi
 
-					mockBusApi.On("GetUacInfo", validUAC).Once().Return(busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}, nil)
+					mockBusApi.On("GetUacInfo", mock.Anything, validUAC).Once().Return(busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}, nil)
 				})
 
 				It("redirects to /:instrumentName/", func() {
 					Expect(httpRecorder.Code).To(Equal(http.StatusFound))
 					Expect(httpRecorder.Header()["Location"]).To(Equal([]string{"/foo/"}))
 					Expect(httpRecorder.Result().Cookies()).ToNot(BeEmpty())
-					decryptedToken, _ := auth.JWTCrypto.DecryptJWT(session.Get(authenticate.JWT_TOKEN_KEY))
-					Expect(decryptedToken.UAC).To(Equal(validUAC))
+					decryptedToken, _ := auth.JWTCrypto.DecryptJWT(context.Background(), session.Get(authenticate.JWT_TOKEN_KEY))
+					Expect(decryptedToken.UACHash).To(Equal(jwtCrypto.HashUAC(validUAC)))
+					Expect(session.Get(authenticate.JWT_TOKEN_KEY)).ToNot(ContainSubstring(validUAC))
 					Expect(decryptedToken.UacInfo.InstrumentName).To(Equal("foo"))
 					Expect(decryptedToken.UacInfo.CaseID).To(Equal("bar"))
 
@@ -270,19 +984,20 @@ var _ = Describe("Login", func() {
 			Context("Login with a 16 character UAC kind", func() {
 				BeforeEach(func() {
 					uacValue = spacedUAC16
-					auth.UacKind = "uac16"
+					auth.UacKinds = authenticate.UacKinds{authenticate.Uac16}
 					mockBusApi := &mocks.BusApiInterface{}
 					auth.BusApi = mockBusApi
 
-					mockBusApi.On("GetUacInfo", validUAC16).Once().Return(busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}, nil)
+					mockBusApi.On("GetUacInfo", mock.Anything, validUAC16).Once().Return(busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}, nil)
 				})
 
 				It("redirects to /:instrumentName/", func() {
 					Expect(httpRecorder.Code).To(Equal(http.StatusFound))
 					Expect(httpRecorder.Header()["Location"]).To(Equal([]string{"/foo/"}))
 					Expect(httpRecorder.Result().Cookies()).ToNot(BeEmpty())
-					decryptedToken, _ := auth.JWTCrypto.DecryptJWT(session.Get(authenticate.JWT_TOKEN_KEY))
-					Expect(decryptedToken.UAC).To(Equal(validUAC16))
+					decryptedToken, _ := auth.JWTCrypto.DecryptJWT(context.Background(), session.Get(authenticate.JWT_TOKEN_KEY))
+					Expect(decryptedToken.UACHash).To(Equal(jwtCrypto.HashUAC(validUAC16)))
+					Expect(session.Get(authenticate.JWT_TOKEN_KEY)).ToNot(ContainSubstring(validUAC16))
 					Expect(decryptedToken.UacInfo.InstrumentName).To(Equal("foo"))
 					Expect(decryptedToken.UacInfo.CaseID).To(Equal("bar"))
 				})
@@ -302,7 +1017,7 @@ var _ = Describe("Login", func() {
 
 			Context("Login with a 12 digit UAC kind", func() {
 				BeforeEach(func() {
-					auth.UacKind = "uac"
+					auth.UacKinds = authenticate.UacKinds{authenticate.Uac12}
 				})
 
 				It("returns a status unauthorised with an error", func() {
@@ -316,7 +1031,7 @@ var _ = Describe("Login", func() {
 
 			Context("Login with a 16 character UAC kind", func() {
 				BeforeEach(func() {
-					auth.UacKind = "uac16"
+					auth.UacKinds = authenticate.UacKinds{authenticate.Uac16}
 				})
 
 				It("returns a status unauthorised with an error", func() {
@@ -343,7 +1058,7 @@ var _ = Describe("Login", func() {
 
 			Context("Login with a 12 digit UAC kind", func() {
 				BeforeEach(func() {
-					auth.UacKind = "uac"
+					auth.UacKinds = authenticate.UacKinds{authenticate.Uac12}
 				})
 
 				It("returns a status unauthorised with an error", func() {
@@ -364,7 +1079,7 @@ var _ = Describe("Login", func() {
 
 			Context("Login with a 16 character UAC kind", func() {
 				BeforeEach(func() {
-					auth.UacKind = "uac16"
+					auth.UacKinds = authenticate.UacKinds{authenticate.Uac16}
 				})
 
 				It("returns a status unauthorised with an error", func() {
@@ -398,7 +1113,7 @@ var _ = Describe("Login", func() {
 
 			Context("Login with a 12 digit UAC kind", func() {
 				BeforeEach(func() {
-					auth.UacKind = "uac"
+					auth.UacKinds = authenticate.UacKinds{authenticate.Uac12}
 				})
 
 				It("returns a status unauthorised with an error", func() {
@@ -418,7 +1133,7 @@ var _ = Describe("Login", func() {
 
 			Context("Login with a 16 character UAC kind", func() {
 				BeforeEach(func() {
-					auth.UacKind = "uac16"
+					auth.UacKinds = authenticate.UacKinds{authenticate.Uac16}
 				})
 
 				It("returns a status unauthorised with an error", func() {
@@ -483,6 +1198,40 @@ var _ = Describe("Login", func() {
 				Expect(strings.Contains(string(body), `<h1>Your progress has been saved</h1>`)).To(BeTrue())
 			})
 		})
+
+		Context("Logout of a session with a token", func() {
+			var mockJwtCrypto *mockauth.JWTCryptoInterface
+
+			BeforeEach(func() {
+				mockJwtCrypto = &mockauth.JWTCryptoInterface{}
+				mockJwtCrypto.On("RevokeJWT", mock.Anything, "signed-token").Return(nil)
+				mockJwtCrypto.On("PeekJWT", "signed-token").Return(&authenticate.UACClaims{
+					UacInfo: busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"},
+				}, nil)
+				auth.JWTCrypto = mockJwtCrypto
+
+				httpRouter.GET("/logout-token", func(context *gin.Context) {
+					session = sessions.DefaultMany(context, "user_session")
+					session.Set(authenticate.JWT_TOKEN_KEY, "signed-token")
+					_ = session.Save()
+					auth.Logout(context, session)
+				})
+
+				httpRecorder = httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", "/logout-token", nil)
+				httpRouter.ServeHTTP(httpRecorder, req)
+			})
+
+			AfterEach(func() {
+				auth.JWTCrypto = nil
+			})
+
+			It("revokes the token and clears the session", func() {
+				mockJwtCrypto.AssertCalled(GinkgoT(), "RevokeJWT", mock.Anything, "signed-token")
+				Expect(session.Get(authenticate.JWT_TOKEN_KEY)).To(BeNil())
+				Expect(httpRecorder.Code).To(Equal(http.StatusOK))
+			})
+		})
 	})
 })
 
@@ -552,7 +1301,7 @@ var _ = Describe("AuthenticatedWithUac", func() {
 
 		Context("When a token can be decrypted", func() {
 			BeforeEach(func() {
-				mockJwtCrypto.On("DecryptJWT", mock.Anything).Return(nil, nil)
+				mockJwtCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(nil, nil)
 			})
 
 			Context("and the session is valid", func() {
@@ -580,9 +1329,66 @@ var _ = Describe("AuthenticatedWithUac", func() {
 			})
 		})
 
+		Context("When the session has been replaced by a sign in on another device", func() {
+			var mockActiveSessions *mockauth.ActiveSessionsInterface
+
+			BeforeEach(func() {
+				sessionValid = true
+				claim := &authenticate.UACClaims{
+					UACHash:        "hash",
+					StandardClaims: jwt.StandardClaims{Id: "this-session"},
+				}
+				mockJwtCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(claim, nil)
+				mockJwtCrypto.On("PeekJWT", mock.Anything).Return(claim, nil)
+				mockJwtCrypto.On("RevokeJWT", mock.Anything, mock.Anything).Return(nil)
+				mockActiveSessions = &mockauth.ActiveSessionsInterface{}
+				mockActiveSessions.On("Active", "hash").Return("other-session", true, nil)
+				mockActiveSessions.On("Release", "hash", "this-session").Return(nil)
+				auth.ActiveSessions = mockActiveSessions
+				auth.Logger = zap.NewNop()
+			})
+
+			AfterEach(func() {
+				auth.ActiveSessions = nil
+			})
+
+			It("ends the session and returns the signed in elsewhere page", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusUnauthorized))
+				body := httpRecorder.Body.String()
+				Expect(body).To(ContainSubstring(`You have signed in on another device`))
+				mockJwtCrypto.AssertCalled(GinkgoT(), "RevokeJWT", mock.Anything, "foobar")
+				mockActiveSessions.AssertCalled(GinkgoT(), "Release", "hash", "this-session")
+			})
+		})
+
+		Context("When the session has outlived its maximum lifetime", func() {
+			BeforeEach(func() {
+				sessionValid = true
+				mockJwtCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(nil, authenticate.ErrSessionLifetimeExceeded)
+			})
+
+			It("redirects to the timed out page", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusFound))
+				Expect(httpRecorder.Header().Get("Location")).To(Equal("/auth/timed-out?reason=max-lifetime"))
+			})
+		})
+
+		Context("When a token has been revoked", func() {
+			BeforeEach(func() {
+				sessionValid = true
+				mockJwtCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(nil, authenticate.ErrTokenRevoked)
+			})
+
+			It("returns unauthorized", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusUnauthorized))
+				body := httpRecorder.Body.Bytes()
+				Expect(string(body)).To(ContainSubstring(`Access study`))
+			})
+		})
+
 		Context("When a token cannot be decrypted", func() {
 			BeforeEach(func() {
-				mockJwtCrypto.On("DecryptJWT", mock.Anything).Return(nil, fmt.Errorf("Explosions"))
+				mockJwtCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("Explosions"))
 			})
 
 			It("returns unauthorized", func() {
@@ -669,7 +1475,7 @@ var _ = Describe("Has Session", func() {
 
 	Context("When someone has a session", func() {
 		BeforeEach(func() {
-			mockJwtCrypto.On("DecryptJWT", mock.Anything).Return(&authenticate.UACClaims{
+			mockJwtCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(&authenticate.UACClaims{
 				UacInfo: busapi.UacInfo{
 					InstrumentName: instrumentName,
 					CaseID:         caseID,
@@ -682,14 +1488,14 @@ var _ = Describe("Has Session", func() {
 			Expect(httpRecorder.Code).To(Equal(http.StatusOK))
 			body := httpRecorder.Body.Bytes()
 			Expect(string(body)).To(Equal(
-				`{"HasSession":true,"Claim":{"uac":"","auth_timeout":0,"instrument_name":"foobar","case_id":"fizzbuzz","disabled":false}}`,
+				`{"HasSession":true,"Claim":{"uac_hash":"","auth_timeout":0,"login_time":0,"max_lifetime":0,"instrument_name":"foobar","case_id":"fizzbuzz","disabled":false}}`,
 			))
 		})
 	})
 
 	Context("When a UAC is disabled", func() {
 		BeforeEach(func() {
-			mockJwtCrypto.On("DecryptJWT", mock.Anything).Return(&authenticate.UACClaims{
+			mockJwtCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(&authenticate.UACClaims{
 				UacInfo: busapi.UacInfo{
 					InstrumentName: instrumentName,
 					CaseID:         caseID,
@@ -702,14 +1508,14 @@ var _ = Describe("Has Session", func() {
 			Expect(httpRecorder.Code).To(Equal(http.StatusOK))
 			body := httpRecorder.Body.Bytes()
 			Expect(string(body)).To(Equal(
-				`{"HasSession":true,"Claim":{"uac":"","auth_timeout":0,"instrument_name":"foobar","case_id":"fizzbuzz","disabled":true}}`,
+				`{"HasSession":true,"Claim":{"uac_hash":"","auth_timeout":0,"login_time":0,"max_lifetime":0,"instrument_name":"foobar","case_id":"fizzbuzz","disabled":true}}`,
 			))
 		})
 	})
 
 	Context("When a UAC is enabled", func() {
 		BeforeEach(func() {
-			mockJwtCrypto.On("DecryptJWT", mock.Anything).Return(&authenticate.UACClaims{
+			mockJwtCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(&authenticate.UACClaims{
 				UacInfo: busapi.UacInfo{
 					InstrumentName: instrumentName,
 					CaseID:         caseID,
@@ -722,14 +1528,14 @@ var _ = Describe("Has Session", func() {
 			Expect(httpRecorder.Code).To(Equal(http.StatusOK))
 			body := httpRecorder.Body.Bytes()
 			Expect(string(body)).To(Equal(
-				`{"HasSession":true,"Claim":{"uac":"","auth_timeout":0,"instrument_name":"foobar","case_id":"fizzbuzz","disabled":false}}`,
+				`{"HasSession":true,"Claim":{"uac_hash":"","auth_timeout":0,"login_time":0,"max_lifetime":0,"instrument_name":"foobar","case_id":"fizzbuzz","disabled":false}}`,
 			))
 		})
 	})
 
 	Context("When a UAC Disabled field is unset", func() {
 		BeforeEach(func() {
-			mockJwtCrypto.On("DecryptJWT", mock.Anything).Return(&authenticate.UACClaims{
+			mockJwtCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(&authenticate.UACClaims{
 				UacInfo: busapi.UacInfo{
 					InstrumentName: instrumentName,
 					CaseID:         caseID,
@@ -741,14 +1547,14 @@ var _ = Describe("Has Session", func() {
 			Expect(httpRecorder.Code).To(Equal(http.StatusOK))
 			body := httpRecorder.Body.Bytes()
 			Expect(string(body)).To(Equal(
-				`{"HasSession":true,"Claim":{"uac":"","auth_timeout":0,"instrument_name":"foobar","case_id":"fizzbuzz","disabled":false}}`,
+				`{"HasSession":true,"Claim":{"uac_hash":"","auth_timeout":0,"login_time":0,"max_lifetime":0,"instrument_name":"foobar","case_id":"fizzbuzz","disabled":false}}`,
 			))
 		})
 	})
 
 	Context("When someone doesn't have a session", func() {
 		BeforeEach(func() {
-			mockJwtCrypto.On("DecryptJWT", mock.Anything).Return(nil, fmt.Errorf("Explosions"))
+			mockJwtCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("Explosions"))
 		})
 
 		It("returns false and an empty claim", func() {
@@ -758,3 +1564,75 @@ var _ = Describe("Has Session", func() {
 		})
 	})
 })
+
+var _ = Describe("RefreshToken", func() {
+	var (
+		activeSessions *authenticate.ActiveSessions
+		store          *kvstore.MemoryStore
+		auth           *authenticate.Auth
+		httpRouter     *gin.Engine
+		claim          *authenticate.UACClaims
+	)
+
+	BeforeEach(func() {
+		store = &kvstore.MemoryStore{}
+		activeSessions = &authenticate.ActiveSessions{Store: store}
+		auth = &authenticate.Auth{
+			JWTCrypto:      &authenticate.JWTCrypto{JWTSecret: "secret"},
+			ActiveSessions: activeSessions,
+			Logger:         zap.NewNop(),
+		}
+		claim = &authenticate.UACClaims{
+			UACHash:        "hash",
+			AuthTimeout:    15,
+			StandardClaims: jwt.StandardClaims{Id: "this-session"},
+		}
+
+		httpRouter = gin.Default()
+		cookieStore := cookie.NewStore([]byte("secret"))
+		httpRouter.Use(sessions.SessionsMany([]string{"user_session", "session_validation"}, cookieStore))
+		httpRouter.GET("/refresh", func(context *gin.Context) {
+			session := sessions.DefaultMany(context, "user_session")
+			session.Set(authenticate.JWT_TOKEN_KEY, "signed-token")
+			validationSession := sessions.DefaultMany(context, "session_validation")
+			validationSession.Set(authenticate.SESSION_VALID_KEY, true)
+			auth.RefreshToken(context, session, claim)
+		})
+	})
+
+	JustBeforeEach(func() {
+		req, _ := http.NewRequest("GET", "/refresh", nil)
+		httpRouter.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	Context("when the session is active", func() {
+		BeforeEach(func() {
+			_ = activeSessions.Register("hash", "this-session", time.Minute)
+		})
+
+		It("keeps it active until the refreshed token times out", func() {
+			activeID, _, _ := activeSessions.Active("hash")
+			Expect(activeID).To(Equal("this-session"))
+			Expect(store.TTL("active_session:hash")).To(BeNumerically(">", 14*time.Minute))
+		})
+	})
+
+	Context("when a later sign in has replaced the session", func() {
+		BeforeEach(func() {
+			_ = activeSessions.Register("hash", "other-session", time.Minute)
+		})
+
+		It("does not take over from the later sign in", func() {
+			activeID, _, _ := activeSessions.Active("hash")
+			Expect(activeID).To(Equal("other-session"))
+			Expect(store.TTL("active_session:hash")).To(BeNumerically("<=", time.Minute))
+		})
+	})
+
+	Context("when the session has been released", func() {
+		It("does not make it active again", func() {
+			_, found, _ := activeSessions.Active("hash")
+			Expect(found).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,85 @@
+package authenticate
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// AvailabilityWindow limits when respondents can sign in to an instrument.
+// Instrument is a case insensitive pattern, as matched by path.Match, so
+// "dst2101a" or "dst21*". Either end of the window can be left open.
+type AvailabilityWindow struct {
+	Instrument string    `json:"instrument"`
+	Opens      time.Time `json:"opens"`
+	Closes     time.Time `json:"closes"`
+}
+
+// NotYetOpen reports whether the window has yet to open at now
+func (availabilityWindow AvailabilityWindow) NotYetOpen(now time.Time) bool {
+	return !availabilityWindow.Opens.IsZero() && now.Before(availabilityWindow.Opens)
+}
+
+// Closed reports whether the window has closed by now
+func (availabilityWindow AvailabilityWindow) Closed(now time.Time) bool {
+	return !availabilityWindow.Closes.IsZero() && !now.Before(availabilityWindow.Closes)
+}
+
+type AvailabilityWindows []AvailabilityWindow
+
+// Decode reads the windows from a JSON list, so they can be configured by
+// envconfig, e.g.
+// [{"instrument":"dst21*","opens":"2021-01-04T09:00:00Z","closes":"2021-02-01T00:00:00Z"}]
+func (availabilityWindows *AvailabilityWindows) Decode(value string) error {
+	var windows AvailabilityWindows
+	if err := json.Unmarshal([]byte(value), &windows); err != nil {
+		return fmt.Errorf("invalid availability windows: %w", err)
+	}
+	for _, window := range windows {
+		if _, err := path.Match(window.Instrument, ""); err != nil || window.Instrument == "" {
+			return fmt.Errorf("invalid availability window instrument pattern %q", window.Instrument)
+		}
+		if !window.Opens.IsZero() && !window.Closes.IsZero() && !window.Closes.After(window.Opens) {
+			return fmt.Errorf("availability window for %q closes before it opens", window.Instrument)
+		}
+	}
+	*availabilityWindows = windows
+	return nil
+}
+
+// Window returns the first window whose pattern matches the instrument
+func (availabilityWindows AvailabilityWindows) Window(instrumentName string) (AvailabilityWindow, bool) {
+	for _, window := range availabilityWindows {
+		if matched, _ := path.Match(strings.ToLower(window.Instrument), strings.ToLower(instrumentName)); matched {
+			return window, true
+		}
+	}
+	return AvailabilityWindow{}, false
+}
+
+var (
+	surveyLocation = loadSurveyLocation()
+	welshMonths    = []string{"Ionawr", "Chwefror", "Mawrth", "Ebrill", "Mai", "Mehefin",
+		"Gorffennaf", "Awst", "Medi", "Hydref", "Tachwedd", "Rhagfyr"}
+)
+
+func loadSurveyLocation() *time.Location {
+	location, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// formatAvailabilityTime shows respondents a window's opening or closing time
+// in UK time, e.g. "4 January 2021 at 09:00"
+func formatAvailabilityTime(availabilityTime time.Time, welsh bool) string {
+	availabilityTime = availabilityTime.In(surveyLocation)
+	if welsh {
+		return fmt.Sprintf("%d %s %d am %s", availabilityTime.Day(), welshMonths[availabilityTime.Month()-1],
+			availabilityTime.Year(), availabilityTime.Format("15:04"))
+	}
+	return availabilityTime.Format("2 January 2006 at 15:04")
+}
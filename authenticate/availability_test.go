@@ -0,0 +1,86 @@
+package authenticate_test
+
+import (
+	"time"
+
+	"github.com/ONSdigital/blaise-cawi-portal/authenticate"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AvailabilityWindows", func() {
+	var (
+		opens  = time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC)
+		closes = time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	Describe("Decode", func() {
+		It("reads a JSON list of windows", func() {
+			var windows authenticate.AvailabilityWindows
+			Expect(windows.Decode(`[{"instrument":"dst21*","opens":"2021-01-04T09:00:00Z","closes":"2021-02-01T00:00:00Z"},{"instrument":"lms2101a","closes":"2021-02-01T00:00:00Z"}]`)).To(Succeed())
+			Expect(windows).To(Equal(authenticate.AvailabilityWindows{
+				{Instrument: "dst21*", Opens: opens, Closes: closes},
+				{Instrument: "lms2101a", Closes: closes},
+			}))
+		})
+
+		It("rejects invalid JSON", func() {
+			var windows authenticate.AvailabilityWindows
+			Expect(windows.Decode(`dst21*:2021-01-04`)).To(MatchError(ContainSubstring("invalid availability windows")))
+		})
+
+		It("rejects invalid patterns", func() {
+			var windows authenticate.AvailabilityWindows
+			Expect(windows.Decode(`[{"instrument":"dst[21"}]`)).To(MatchError(`invalid availability window instrument pattern "dst[21"`))
+			Expect(windows.Decode(`[{"opens":"2021-01-04T09:00:00Z"}]`)).To(MatchError(`invalid availability window instrument pattern ""`))
+		})
+
+		It("rejects windows that close before they open", func() {
+			var windows authenticate.AvailabilityWindows
+			Expect(windows.Decode(`[{"instrument":"dst2101a","opens":"2021-02-01T00:00:00Z","closes":"2021-01-04T09:00:00Z"}]`)).To(
+				MatchError(`availability window for "dst2101a" closes before it opens`))
+		})
+	})
+
+	Describe("Window", func() {
+		windows := authenticate.AvailabilityWindows{
+			{Instrument: "dst2101a", Closes: opens},
+			{Instrument: "DST21*", Opens: opens, Closes: closes},
+		}
+
+		It("returns the first window that matches, ignoring case", func() {
+			window, found := windows.Window("DST2101A")
+			Expect(found).To(BeTrue())
+			Expect(window.Closes).To(Equal(opens))
+
+			window, found = windows.Window("dst2102a")
+			Expect(found).To(BeTrue())
+			Expect(window.Instrument).To(Equal("DST21*"))
+		})
+
+		It("does not match other instruments", func() {
+			_, found := windows.Window("lms2101a")
+			Expect(found).To(BeFalse())
+		})
+	})
+
+	Describe("AvailabilityWindow", func() {
+		window := authenticate.AvailabilityWindow{Instrument: "dst2101a", Opens: opens, Closes: closes}
+
+		It("is not yet open before it opens", func() {
+			Expect(window.NotYetOpen(opens.Add(-time.Second))).To(BeTrue())
+			Expect(window.NotYetOpen(opens)).To(BeFalse())
+		})
+
+		It("is closed from when it closes", func() {
+			Expect(window.Closed(closes.Add(-time.Second))).To(BeFalse())
+			Expect(window.Closed(closes)).To(BeTrue())
+		})
+
+		It("is always open at an end that is not set", func() {
+			openEnded := authenticate.AvailabilityWindow{Instrument: "dst2101a"}
+			Expect(openEnded.NotYetOpen(opens)).To(BeFalse())
+			Expect(openEnded.Closed(closes)).To(BeFalse())
+		})
+	})
+})
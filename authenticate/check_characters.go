@@ -0,0 +1,38 @@
+package authenticate
+
+import "strings"
+
+const base36Alphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// LuhnMod10 validates a numeric access code whose last digit is a Luhn check digit
+func LuhnMod10(uac string) bool {
+	return luhnModN(uac, base36Alphabet[:10])
+}
+
+// LuhnMod36 validates an alphanumeric access code whose last character is a
+// Luhn mod N check character over the digits and case insensitive letters
+func LuhnMod36(uac string) bool {
+	return luhnModN(strings.ToLower(uac), base36Alphabet)
+}
+
+func luhnModN(uac, alphabet string) bool {
+	if uac == "" {
+		return false
+	}
+	var (
+		base   = len(alphabet)
+		factor = 1
+		sum    = 0
+	)
+	// Work from the check character leftwards, doubling every second character
+	for i := len(uac) - 1; i >= 0; i-- {
+		codePoint := strings.IndexByte(alphabet, uac[i])
+		if codePoint < 0 {
+			return false
+		}
+		addend := factor * codePoint
+		sum += addend/base + addend%base
+		factor = 3 - factor
+	}
+	return sum%base == 0
+}
@@ -1,57 +1,68 @@
 package authenticate
 
 import (
-	"fmt"
-	"regexp"
 	"strings"
+	"time"
 
 	"github.com/ONSdigital/blaise-cawi-portal/busapi"
 	"github.com/golang-jwt/jwt"
 	"go.uber.org/zap"
 )
 
+// UACClaims never carries the access code itself, only a keyed hash of it, so
+// the code cannot be read from a session token.
 type UACClaims struct {
-	UAC         string `json:"uac"`
+	UACHash     string `json:"uac_hash"`
 	AuthTimeout int    `json:"auth_timeout"`
+	// When the respondent signed in, which refreshing the token never changes
+	LoginTime int64 `json:"login_time"`
+	// Minutes after LoginTime the session ends however active it is, or zero
+	// for no limit
+	MaxLifetime int `json:"max_lifetime"`
 	busapi.UacInfo
 	jwt.StandardClaims
 }
 
-func (uacClaims *UACClaims) AuthenticatedForInstrument(instrumentName string) bool {
+// AuthenticatedForInstrument reports whether the UAC was for the instrument,
+// or for one the linked instrument rules let it access
+func (uacClaims *UACClaims) AuthenticatedForInstrument(instrumentName string, linkedInstruments LinkedInstrumentRules) bool {
 	if strings.EqualFold(uacClaims.UacInfo.InstrumentName, instrumentName) {
 		return true
 	}
-	return uacClaims.CheckDiaInstrument(uacClaims.UacInfo.InstrumentName, instrumentName)
-}
-
-func (uacClaims *UACClaims) CheckDiaInstrument(instrumentName1, instrumentName2 string) bool {
-	diaA, diaAErr := regexp.MatchString(`^dia\d{4}a$`, instrumentName1)
-	if diaAErr != nil {
-		fmt.Print(diaAErr)
-	}
-
-	diaB, diaBErr := regexp.MatchString(`^dia\d{4}b$`, instrumentName2)
-	if diaBErr != nil {
-		fmt.Print(diaBErr)
-	}
-
-	if diaA && diaB {
-		return true
-	}
-	return false
+	return linkedInstruments.Allows(uacClaims.UacInfo.InstrumentName, instrumentName)
 }
 
+// AuthenticatedForCase reports whether the UAC covers the case of the
+// instrument it is signed in to, which a household UAC can have several of
 func (uacClaims *UACClaims) AuthenticatedForCase(caseID string) bool {
 	if !uacClaims.UacInfo.Disabled  {
-        return strings.EqualFold(uacClaims.UacInfo.CaseID, caseID)
+        return uacClaims.UacInfo.HasCase(uacClaims.UacInfo.InstrumentName, caseID)
     }
     return false
 }
 
+// CaseSelectionRequired reports whether a household UAC has yet to choose
+// which of its cases to open
+func (uacClaims *UACClaims) CaseSelectionRequired() bool {
+	return uacClaims.UacInfo.Household() && uacClaims.UacInfo.CaseID == ""
+}
+
+// LifetimeExceeded reports whether the session has outlived its MaxLifetime
+func (uacClaims *UACClaims) LifetimeExceeded(now time.Time) bool {
+	if uacClaims.MaxLifetime == 0 {
+		return false
+	}
+	return now.Unix() >= uacClaims.LoginTime+expirationSeconds(uacClaims.MaxLifetime)
+}
+
 func (uacClaims *UACClaims) LogFields() []zap.Field {
 	var fields []zap.Field
 	fields = append(fields, zap.String("AuthedInstrumentName", uacClaims.UacInfo.InstrumentName))
 	fields = append(fields, zap.String("AuthedCaseID", uacClaims.UacInfo.CaseID))
+	if uacClaims.UacInfo.Household() {
+		fields = append(fields, zap.Int("AuthedCases", len(uacClaims.UacInfo.Cases)))
+	}
 	fields = append(fields, zap.Int("AuthTimeout", uacClaims.AuthTimeout))
+	fields = append(fields, zap.String("TokenID", uacClaims.Id))
 	return fields
 }
@@ -2,6 +2,7 @@ package authenticate_test
 
 import (
 	"strings"
+	"time"
 
 	"github.com/ONSdigital/blaise-cawi-portal/authenticate"
 	"github.com/ONSdigital/blaise-cawi-portal/busapi"
@@ -17,7 +18,7 @@ var _ = Describe("Claims", func() {
 		caseID         = "bar"
 		disabled       = false
 		claim          = &authenticate.UACClaims{
-			UAC:         "0008901",
+			UACHash:     "0008901",
 			AuthTimeout: 15,
 			UacInfo: busapi.UacInfo{
 				InstrumentName: instrumentName,
@@ -27,27 +28,25 @@ var _ = Describe("Claims", func() {
 		}
 	)
 
-	DescribeTable("CheckDiaInstrument",
-		func(instrumentName1, instrumentName2 string, expected bool) {
-			// Use the checkDiaInstrument function from the imported package
-			Expect(claim.CheckDiaInstrument(instrumentName1, instrumentName2)).To(Equal(expected))
-		},
-		Entry("both diaA and diaB", "dia1234a", "dia1234b", true),
-		Entry("only diaA", "dia1234a", "notdia5678b", false),
-		Entry("only diaB", "notdia1234a", "dia5678b", false),
-		Entry("neither diaA nor diaB", "notdia1234a", "notdia5678b", false),
-		Entry("different case for diaA", "Dia1234a", "dia5678b", false),
-		Entry("different case for diaB", "dia1234a", "DIA5678B", false),
-		Entry("both in different case", "DIA1234A", "DIA5678B", false),
-		Entry("invalid names", "bacon", "ham", false),
-	)
-
 	DescribeTable("AuthenticateForInstrument",
 		func(testInstrumentName string, expected bool) {
-			Expect(claim.AuthenticatedForInstrument(testInstrumentName)).To(Equal(expected))
+			Expect(claim.AuthenticatedForInstrument(testInstrumentName, nil)).To(Equal(expected))
 		},
 		Entry("same case", instrumentName, true),
 		Entry("different case", strings.ToUpper(instrumentName), true),
+		Entry("different instrument", "bacon", false),
+	)
+
+	DescribeTable("AuthenticateForInstrument with linked instruments",
+		func(testInstrumentName string, expected bool) {
+			linkedInstruments := authenticate.MustLinkedInstrumentRules(
+				authenticate.LinkedInstrumentRule{From: "^foo$", To: "^foo2$"},
+			)
+			Expect(claim.AuthenticatedForInstrument(testInstrumentName, linkedInstruments)).To(Equal(expected))
+		},
+		Entry("same instrument", instrumentName, true),
+		Entry("linked instrument", "foo2", true),
+		Entry("unlinked instrument", "foo3", false),
 	)
 
 	DescribeTable("AuthenticateForCase",
@@ -61,6 +60,53 @@ var _ = Describe("Claims", func() {
 		Entry("is not authenticated when UAC is disabled", caseID, true, false),
 	)
 
+	Describe("a household", func() {
+		var household = &authenticate.UACClaims{
+			UacInfo: busapi.UacInfo{
+				InstrumentName: "lms2101a",
+				CaseID:         "100001",
+				Cases: []busapi.UacCase{
+					{InstrumentName: "lms2101a", CaseID: "100001"},
+					{InstrumentName: "lms2101a", CaseID: "100002"},
+					{InstrumentName: "lms2101b", CaseID: "100003"},
+				},
+			},
+		}
+
+		DescribeTable("AuthenticateForCase",
+			func(testCaseID string, expected bool) {
+				Expect(household.AuthenticatedForCase(testCaseID)).To(Equal(expected))
+			},
+			Entry("the chosen case", "100001", true),
+			Entry("another case of the same instrument", "100002", true),
+			Entry("a case of another instrument", "100003", false),
+			Entry("not matching", "bacon", false),
+		)
+
+		It("requires a case to be chosen first", func() {
+			Expect(household.CaseSelectionRequired()).To(BeFalse())
+			unselected := &authenticate.UACClaims{UacInfo: busapi.UacInfo{Cases: household.UacInfo.Cases}}
+			Expect(unselected.CaseSelectionRequired()).To(BeTrue())
+			Expect(unselected.AuthenticatedForCase("100001")).To(BeFalse())
+			Expect(claim.CaseSelectionRequired()).To(BeFalse())
+		})
+	})
+
+	DescribeTable("LifetimeExceeded",
+		func(maxLifetime int, signedInFor time.Duration, expected bool) {
+			now := time.Now()
+			lifetimeClaim := &authenticate.UACClaims{
+				LoginTime:   now.Add(-signedInFor).Unix(),
+				MaxLifetime: maxLifetime,
+			}
+			Expect(lifetimeClaim.LifetimeExceeded(now)).To(Equal(expected))
+		},
+		Entry("within the lifetime", 60, 59*time.Minute, false),
+		Entry("at the end of the lifetime", 60, 60*time.Minute, true),
+		Entry("after the lifetime", 60, 61*time.Minute, true),
+		Entry("with no lifetime", 0, 48*time.Hour, false),
+	)
+
 	Describe("LogFields", func() {
 		It("Returns the instrument name and case ID as log fields", func() {
 			fields := claim.LogFields()
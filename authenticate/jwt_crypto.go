@@ -1,7 +1,14 @@
 package authenticate
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/ONSdigital/blaise-cawi-portal/busapi"
@@ -12,44 +19,131 @@ import (
 //go:generate mockery --name JWTCryptoInterface
 type JWTCryptoInterface interface {
 	EncryptJWT(string, *busapi.UacInfo, int) (string, error)
-	DecryptJWT(interface{}) (*UACClaims, error)
+	RefreshJWT(*UACClaims) (string, error)
+	DecryptJWT(context.Context, interface{}) (*UACClaims, error)
+	PeekJWT(interface{}) (*UACClaims, error)
+	RevokeJWT(context.Context, interface{}) error
+	RevokeTokenID(context.Context, string) error
+	HashUAC(string) string
+	PublicKeySet() JSONWebKeySet
 }
 
+// JWTCrypto signs tokens with JWTSecret, identifying it with KeyID in the
+// token's kid header. Secrets that have been rotated out can be kept in
+// VerificationKeys, by key ID, so sessions signed with them stay valid.
+//
+// When SigningKey is set tokens are signed with it instead, so that other
+// services can verify them using the published PublicKeySet. PublicKeys are
+// asymmetric keys that are only used for verification.
+//
+// The access code is stored as an HMAC keyed with UACHashSecret, falling back
+// to JWTSecret when it is not set.
+//
+// Every token carries a jti, which is checked against Revocations when it is
+// set. RevocationTTL is how long a token revoked by its ID alone is denied for.
+//
+// Sessions end MaxLifetime after sign in however often they are refreshed.
+// InstrumentMaxLifetimes overrides it for instruments whose names start with
+// a key, the longest matching key winning.
 type JWTCrypto struct {
-	JWTSecret string
+	JWTSecret              string
+	KeyID                  string
+	VerificationKeys       map[string]string
+	SigningKey             *JWTKey
+	PublicKeys             []*JWTKey
+	UACHashSecret          string
+	Revocations            RevocationListInterface
+	RevocationTTL          time.Duration
+	MaxLifetime            time.Duration
+	InstrumentMaxLifetimes map[string]time.Duration
 }
 
-var DefaultAuthTimeout = 15
+// legacyUACClaims reads tokens issued before the access code was hashed
+type legacyUACClaims struct {
+	UACClaims
+	UAC string `json:"uac"`
+}
+
+var (
+	DefaultAuthTimeout = 15
+
+	ErrSessionLifetimeExceeded = errors.New("session has exceeded its maximum lifetime")
+)
 
 func (jwtCrypto *JWTCrypto) EncryptJWT(uac string, uacInfo *busapi.UacInfo, authTimeout int) (string, error) {
 	if authTimeout == 0 {
 		authTimeout = DefaultAuthTimeout
 	}
+	tokenID, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
 
+	now := time.Now()
 	claims := UACClaims{
-		UAC:         uac,
+		UACHash:     jwtCrypto.HashUAC(uac),
 		AuthTimeout: authTimeout,
+		LoginTime:   now.Unix(),
+		MaxLifetime: jwtCrypto.maxLifetime(uacInfo.InstrumentName),
 		UacInfo: busapi.UacInfo{
 			InstrumentName: uacInfo.InstrumentName,
 			CaseID:         uacInfo.CaseID,
+			Cases:          uacInfo.Cases,
 		},
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Unix() + expirationSeconds(authTimeout),
+			Id:        tokenID,
+			ExpiresAt: now.Unix() + expirationSeconds(authTimeout),
 			Issuer:    ISSUER,
 		},
 	}
+	return jwtCrypto.sign(claims)
+}
+
+// RefreshJWT re-signs existing claims with a new expiry. The token keeps its
+// jti, so revoking it also revokes every copy issued before the refresh.
+func (jwtCrypto *JWTCrypto) RefreshJWT(uacClaims *UACClaims) (string, error) {
+	authTimeout := uacClaims.AuthTimeout
+	if authTimeout == 0 {
+		authTimeout = DefaultAuthTimeout
+	}
+
+	claims := *uacClaims
+	claims.StandardClaims.ExpiresAt = time.Now().Unix() + expirationSeconds(authTimeout)
+	return jwtCrypto.sign(claims)
+}
+
+// HashUAC returns the keyed hash of an access code that is stored in its
+// session token. Letters are hashed in lower case, as a code typed in either
+// case is the same code, so it has one active session and one audit trail.
+func (jwtCrypto *JWTCrypto) HashUAC(uac string) string {
+	secret := jwtCrypto.UACHashSecret
+	if secret == "" {
+		secret = jwtCrypto.JWTSecret
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.ToLower(uac)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (jwtCrypto *JWTCrypto) sign(claims UACClaims) (string, error) {
+	if jwtCrypto.SigningKey != nil {
+		token := jwt.NewWithClaims(jwtCrypto.SigningKey.Method, claims)
+		token.Header["kid"] = jwtCrypto.SigningKey.ID
+		return token.SignedString(jwtCrypto.SigningKey.SignKey)
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if jwtCrypto.KeyID != "" {
+		token.Header["kid"] = jwtCrypto.KeyID
+	}
 	return token.SignedString([]byte(jwtCrypto.JWTSecret))
 }
 
-func (jwtCrypto *JWTCrypto) DecryptJWT(jwtToken interface{}) (*UACClaims, error) {
+func (jwtCrypto *JWTCrypto) DecryptJWT(ctx context.Context, jwtToken interface{}) (*UACClaims, error) {
 	if jwtToken == nil {
 		return nil, fmt.Errorf("no JWT Token in session")
 	}
-	token, err := jwt.ParseWithClaims(jwtToken.(string), &UACClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(jwtCrypto.JWTSecret), nil
-	})
+	token, err := jwt.ParseWithClaims(jwtToken.(string), &legacyUACClaims{}, jwtCrypto.verificationKey)
 	if err != nil {
 		return nil, err
 	}
@@ -57,7 +151,169 @@ func (jwtCrypto *JWTCrypto) DecryptJWT(jwtToken interface{}) (*UACClaims, error)
 		return nil, err
 	}
 
-	return token.Claims.(*UACClaims), nil
+	claims := token.Claims.(*legacyUACClaims)
+	if claims.UAC != "" && claims.UACHash == "" {
+		claims.UACHash = jwtCrypto.HashUAC(claims.UAC)
+	}
+	if claims.LoginTime == 0 {
+		// Tokens issued before login times were recorded start their lifetime
+		// now, and keep it once they are refreshed
+		claims.LoginTime = time.Now().Unix()
+		claims.MaxLifetime = jwtCrypto.maxLifetime(claims.UacInfo.InstrumentName)
+	}
+	if claims.LifetimeExceeded(time.Now()) {
+		return nil, ErrSessionLifetimeExceeded
+	}
+	if err := jwtCrypto.checkRevoked(ctx, &claims.UACClaims); err != nil {
+		return nil, err
+	}
+	return &claims.UACClaims, nil
+}
+
+// RevokeJWT denies the token until every copy of it would have expired.
+// Expired tokens and tokens issued without a jti are left alone.
+func (jwtCrypto *JWTCrypto) RevokeJWT(ctx context.Context, jwtToken interface{}) error {
+	if jwtToken == nil || jwtToken.(string) == "" {
+		return nil
+	}
+	claims, err := jwtCrypto.PeekJWT(jwtToken)
+	if err != nil {
+		return err
+	}
+	if claims.Id == "" || claims.ExpiresAt <= time.Now().Unix() {
+		return nil
+	}
+
+	authTimeout := claims.AuthTimeout
+	if authTimeout == 0 {
+		authTimeout = DefaultAuthTimeout
+	}
+	return jwtCrypto.revoke(claims.Id, time.Duration(expirationSeconds(authTimeout))*time.Second)
+}
+
+// PeekJWT verifies the token's signature but not whether it has expired or
+// been revoked, for cleaning up after sessions that have already ended
+func (jwtCrypto *JWTCrypto) PeekJWT(jwtToken interface{}) (*UACClaims, error) {
+	if jwtToken == nil {
+		return nil, fmt.Errorf("no JWT Token in session")
+	}
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.ParseWithClaims(jwtToken.(string), &legacyUACClaims{}, jwtCrypto.verificationKey)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := token.Claims.(*legacyUACClaims)
+	if claims.UAC != "" && claims.UACHash == "" {
+		claims.UACHash = jwtCrypto.HashUAC(claims.UAC)
+	}
+	return &claims.UACClaims, nil
+}
+
+// RevokeTokenID denies a token by its jti for RevocationTTL
+func (jwtCrypto *JWTCrypto) RevokeTokenID(ctx context.Context, tokenID string) error {
+	return jwtCrypto.revoke(tokenID, jwtCrypto.RevocationTTL)
+}
+
+// revoke writes the revocation even once the request has gone, so that a
+// browser disconnecting during sign out cannot leave the token usable
+func (jwtCrypto *JWTCrypto) revoke(tokenID string, ttl time.Duration) error {
+	if jwtCrypto.Revocations == nil {
+		return fmt.Errorf("JWT revocation is not configured")
+	}
+	return jwtCrypto.Revocations.Revoke(tokenID, ttl)
+}
+
+func (jwtCrypto *JWTCrypto) checkRevoked(ctx context.Context, claims *UACClaims) error {
+	if jwtCrypto.Revocations == nil || claims.Id == "" {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	revoked, err := jwtCrypto.Revocations.Revoked(claims.Id)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// maxLifetime returns the maximum session lifetime for the instrument in
+// minutes, rounded up
+func (jwtCrypto *JWTCrypto) maxLifetime(instrumentName string) int {
+	maxLifetime := jwtCrypto.MaxLifetime
+	longestPrefix := -1
+	for prefix, lifetime := range jwtCrypto.InstrumentMaxLifetimes {
+		if strings.HasPrefix(strings.ToLower(instrumentName), strings.ToLower(prefix)) && len(prefix) > longestPrefix {
+			maxLifetime = lifetime
+			longestPrefix = len(prefix)
+		}
+	}
+	return int((maxLifetime + time.Minute - 1) / time.Minute)
+}
+
+func newTokenID() (string, error) {
+	tokenID := make([]byte, 16)
+	if _, err := rand.Read(tokenID); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(tokenID), nil
+}
+
+// PublicKeySet returns the asymmetric keys tokens can be verified with. Shared
+// secrets are never published.
+func (jwtCrypto *JWTCrypto) PublicKeySet() JSONWebKeySet {
+	keySet := JSONWebKeySet{Keys: []JSONWebKey{}}
+	if jwtCrypto.SigningKey != nil {
+		keySet.Keys = append(keySet.Keys, jwtCrypto.SigningKey.JSONWebKey())
+	}
+	for _, publicKey := range jwtCrypto.PublicKeys {
+		keySet.Keys = append(keySet.Keys, publicKey.JSONWebKey())
+	}
+	return keySet
+}
+
+// verificationKey picks the key matching the token's kid header and
+// algorithm, so that a shared secret and an asymmetric key can have the same
+// ID. Tokens without a kid were issued before key IDs were introduced, so are
+// checked against JWTSecret.
+func (jwtCrypto *JWTCrypto) verificationKey(token *jwt.Token) (interface{}, error) {
+	keyID, _ := token.Header["kid"].(string)
+	jwtKeys := jwtCrypto.lookupKeys(keyID)
+	if len(jwtKeys) == 0 {
+		return nil, fmt.Errorf("unknown JWT key ID %q", keyID)
+	}
+	for _, jwtKey := range jwtKeys {
+		if token.Method.Alg() == jwtKey.Method.Alg() {
+			return jwtKey.VerifyKey, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+}
+
+func (jwtCrypto *JWTCrypto) lookupKeys(keyID string) []*JWTKey {
+	var jwtKeys []*JWTKey
+	if jwtCrypto.SigningKey != nil && keyID == jwtCrypto.SigningKey.ID {
+		jwtKeys = append(jwtKeys, jwtCrypto.SigningKey)
+	}
+	for _, publicKey := range jwtCrypto.PublicKeys {
+		if keyID == publicKey.ID {
+			jwtKeys = append(jwtKeys, publicKey)
+		}
+	}
+	if keyID == "" || keyID == jwtCrypto.KeyID {
+		jwtKeys = append(jwtKeys, hmacJWTKey(keyID, jwtCrypto.JWTSecret))
+	} else if secret, found := jwtCrypto.VerificationKeys[keyID]; found {
+		jwtKeys = append(jwtKeys, hmacJWTKey(keyID, secret))
+	}
+	return jwtKeys
+}
+
+func hmacJWTKey(keyID, secret string) *JWTKey {
+	return &JWTKey{ID: keyID, Method: jwt.SigningMethodHS256, SignKey: []byte(secret), VerifyKey: []byte(secret)}
 }
 
 func expirationSeconds(sessionTimeout int) int64 {
@@ -0,0 +1,353 @@
+package authenticate_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ONSdigital/blaise-cawi-portal/authenticate"
+	mockauth "github.com/ONSdigital/blaise-cawi-portal/authenticate/mocks"
+	"github.com/ONSdigital/blaise-cawi-portal/busapi"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JWTCrypto key rotation", func() {
+	var (
+		uacInfo   = &busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}
+		oldCrypto = &authenticate.JWTCrypto{JWTSecret: "old-secret", KeyID: "2021-01"}
+		newCrypto = &authenticate.JWTCrypto{
+			JWTSecret:        "new-secret",
+			KeyID:            "2021-02",
+			VerificationKeys: map[string]string{"2021-01": "old-secret"},
+		}
+	)
+
+	It("adds the key ID to the token header", func() {
+		signedToken, err := newCrypto.EncryptJWT("123456789012", uacInfo, 15)
+		Expect(err).To(BeNil())
+
+		token, _, err := new(jwt.Parser).ParseUnverified(signedToken, &authenticate.UACClaims{})
+		Expect(err).To(BeNil())
+		Expect(token.Header["kid"]).To(Equal("2021-02"))
+	})
+
+	It("verifies tokens signed with the active key", func() {
+		signedToken, _ := newCrypto.EncryptJWT("123456789012", uacInfo, 15)
+
+		claims, err := newCrypto.DecryptJWT(context.Background(), signedToken)
+		Expect(err).To(BeNil())
+		Expect(claims.UacInfo.CaseID).To(Equal("bar"))
+	})
+
+	It("verifies tokens signed with a rotated out key", func() {
+		signedToken, _ := oldCrypto.EncryptJWT("123456789012", uacInfo, 15)
+
+		claims, err := newCrypto.DecryptJWT(context.Background(), signedToken)
+		Expect(err).To(BeNil())
+		Expect(claims.UacInfo.CaseID).To(Equal("bar"))
+	})
+
+	It("verifies tokens issued without a key ID against the active key", func() {
+		signedToken, _ := (&authenticate.JWTCrypto{JWTSecret: "new-secret"}).EncryptJWT("123456789012", uacInfo, 15)
+
+		_, err := newCrypto.DecryptJWT(context.Background(), signedToken)
+		Expect(err).To(BeNil())
+	})
+
+	It("rejects tokens signed with an unknown key ID", func() {
+		signedToken, _ := (&authenticate.JWTCrypto{JWTSecret: "other-secret", KeyID: "2020-12"}).EncryptJWT("123456789012", uacInfo, 15)
+
+		_, err := newCrypto.DecryptJWT(context.Background(), signedToken)
+		Expect(err).To(MatchError(ContainSubstring(`unknown JWT key ID "2020-12"`)))
+	})
+
+	It("rejects tokens that claim a known key ID but were signed with another secret", func() {
+		signedToken, _ := (&authenticate.JWTCrypto{JWTSecret: "other-secret", KeyID: "2021-01"}).EncryptJWT("123456789012", uacInfo, 15)
+
+		_, err := newCrypto.DecryptJWT(context.Background(), signedToken)
+		Expect(err).To(MatchError(ContainSubstring("signature is invalid")))
+	})
+
+	It("rejects tokens signed with another algorithm", func() {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS512, authenticate.UACClaims{})
+		signedToken, _ := token.SignedString([]byte("new-secret"))
+
+		_, err := newCrypto.DecryptJWT(context.Background(), signedToken)
+		Expect(err).To(MatchError(ContainSubstring("unexpected signing method HS512")))
+	})
+})
+
+var _ = Describe("JWTCrypto access code hashing", func() {
+	var (
+		uacInfo   = &busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}
+		jwtCrypto = &authenticate.JWTCrypto{JWTSecret: "secret", UACHashSecret: "hash-secret"}
+	)
+
+	It("stores a keyed hash of the access code instead of the code", func() {
+		signedToken, _ := jwtCrypto.EncryptJWT("123456789012", uacInfo, 15)
+
+		Expect(signedToken).ToNot(ContainSubstring("123456789012"))
+		claims, err := jwtCrypto.DecryptJWT(context.Background(), signedToken)
+		Expect(err).To(BeNil())
+		Expect(claims.UACHash).To(Equal(jwtCrypto.HashUAC("123456789012")))
+	})
+
+	It("hashes an access code typed in either case the same", func() {
+		Expect(jwtCrypto.HashUAC("BCDF5678GHJK2345")).To(Equal(jwtCrypto.HashUAC("bcdf5678ghjk2345")))
+	})
+
+	It("keys the hash with the hash secret", func() {
+		Expect(jwtCrypto.HashUAC("123456789012")).ToNot(Equal(
+			(&authenticate.JWTCrypto{JWTSecret: "secret", UACHashSecret: "other-secret"}).HashUAC("123456789012"),
+		))
+	})
+
+	It("falls back to the JWT secret when there is no hash secret", func() {
+		Expect((&authenticate.JWTCrypto{JWTSecret: "secret"}).HashUAC("123456789012")).To(Equal(
+			(&authenticate.JWTCrypto{JWTSecret: "other-secret", UACHashSecret: "secret"}).HashUAC("123456789012"),
+		))
+	})
+
+	It("hashes the access code of tokens issued before hashing", func() {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"uac":             "123456789012",
+			"auth_timeout":    15,
+			"instrument_name": "foo",
+			"case_id":         "bar",
+			"exp":             time.Now().Unix() + 60,
+		})
+		signedToken, _ := token.SignedString([]byte("secret"))
+
+		claims, err := jwtCrypto.DecryptJWT(context.Background(), signedToken)
+		Expect(err).To(BeNil())
+		Expect(claims.UACHash).To(Equal(jwtCrypto.HashUAC("123456789012")))
+		Expect(claims.UacInfo.CaseID).To(Equal("bar"))
+
+		refreshedToken, _ := jwtCrypto.RefreshJWT(claims)
+		Expect(refreshedToken).ToNot(ContainSubstring("123456789012"))
+	})
+
+	Describe("RefreshJWT", func() {
+		It("keeps the claims and extends the expiry", func() {
+			claims := &authenticate.UACClaims{
+				UACHash:        "abc123",
+				AuthTimeout:    30,
+				UacInfo:        *uacInfo,
+				StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Unix() + 10, Issuer: authenticate.ISSUER},
+			}
+
+			signedToken, err := jwtCrypto.RefreshJWT(claims)
+			Expect(err).To(BeNil())
+
+			refreshed, err := jwtCrypto.DecryptJWT(context.Background(), signedToken)
+			Expect(err).To(BeNil())
+			Expect(refreshed.UACHash).To(Equal("abc123"))
+			Expect(refreshed.AuthTimeout).To(Equal(30))
+			Expect(refreshed.UacInfo.InstrumentName).To(Equal("foo"))
+			Expect(refreshed.ExpiresAt).To(BeNumerically(">", claims.ExpiresAt))
+		})
+	})
+})
+
+var _ = Describe("JWTCrypto revocation", func() {
+	var (
+		uacInfo         = &busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}
+		mockRevocations *mockauth.RevocationListInterface
+		jwtCrypto       *authenticate.JWTCrypto
+	)
+
+	BeforeEach(func() {
+		mockRevocations = &mockauth.RevocationListInterface{}
+		jwtCrypto = &authenticate.JWTCrypto{
+			JWTSecret:     "secret",
+			Revocations:   mockRevocations,
+			RevocationTTL: 24 * time.Hour,
+		}
+	})
+
+	It("gives every token a unique ID that is kept when it is refreshed", func() {
+		mockRevocations.On("Revoked", mock.Anything).Return(false, nil)
+
+		firstToken, _ := jwtCrypto.EncryptJWT("123456789012", uacInfo, 15)
+		secondToken, _ := jwtCrypto.EncryptJWT("123456789012", uacInfo, 15)
+		firstClaims, _ := jwtCrypto.DecryptJWT(context.Background(), firstToken)
+		secondClaims, _ := jwtCrypto.DecryptJWT(context.Background(), secondToken)
+		Expect(firstClaims.Id).To(HaveLen(32))
+		Expect(firstClaims.Id).ToNot(Equal(secondClaims.Id))
+
+		refreshedToken, _ := jwtCrypto.RefreshJWT(firstClaims)
+		refreshedClaims, _ := jwtCrypto.DecryptJWT(context.Background(), refreshedToken)
+		Expect(refreshedClaims.Id).To(Equal(firstClaims.Id))
+	})
+
+	It("rejects revoked tokens", func() {
+		mockRevocations.On("Revoked", mock.Anything).Return(true, nil)
+		signedToken, _ := jwtCrypto.EncryptJWT("123456789012", uacInfo, 15)
+
+		_, err := jwtCrypto.DecryptJWT(context.Background(), signedToken)
+		Expect(err).To(Equal(authenticate.ErrTokenRevoked))
+	})
+
+	It("rejects tokens when the revocation list cannot be checked", func() {
+		mockRevocations.On("Revoked", mock.Anything).Return(false, fmt.Errorf("redis down"))
+		signedToken, _ := jwtCrypto.EncryptJWT("123456789012", uacInfo, 15)
+
+		_, err := jwtCrypto.DecryptJWT(context.Background(), signedToken)
+		Expect(err).To(MatchError("redis down"))
+	})
+
+	It("does not check the revocation list once the request has gone", func() {
+		signedToken, _ := jwtCrypto.EncryptJWT("123456789012", uacInfo, 15)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := jwtCrypto.DecryptJWT(ctx, signedToken)
+		Expect(err).To(Equal(context.Canceled))
+		mockRevocations.AssertNotCalled(GinkgoT(), "Revoked", mock.Anything)
+	})
+
+	Describe("RevokeJWT", func() {
+		It("revokes the token for as long as any copy of it could be valid", func() {
+			signedToken, _ := jwtCrypto.EncryptJWT("123456789012", uacInfo, 30)
+			token, _, _ := new(jwt.Parser).ParseUnverified(signedToken, &authenticate.UACClaims{})
+			tokenID := token.Claims.(*authenticate.UACClaims).Id
+			mockRevocations.On("Revoke", tokenID, 30*time.Minute).Return(nil)
+
+			Expect(jwtCrypto.RevokeJWT(context.Background(), signedToken)).To(Succeed())
+			mockRevocations.AssertCalled(GinkgoT(), "Revoke", tokenID, 30*time.Minute)
+		})
+
+		It("revokes the token even once the request has gone", func() {
+			signedToken, _ := jwtCrypto.EncryptJWT("123456789012", uacInfo, 30)
+			mockRevocations.On("Revoke", mock.Anything, 30*time.Minute).Return(nil)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			Expect(jwtCrypto.RevokeJWT(ctx, signedToken)).To(Succeed())
+			mockRevocations.AssertNumberOfCalls(GinkgoT(), "Revoke", 1)
+		})
+
+		It("ignores expired tokens", func() {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, authenticate.UACClaims{
+				StandardClaims: jwt.StandardClaims{Id: "abc123", ExpiresAt: time.Now().Unix() - 60},
+			})
+			signedToken, _ := token.SignedString([]byte("secret"))
+
+			Expect(jwtCrypto.RevokeJWT(context.Background(), signedToken)).To(Succeed())
+			mockRevocations.AssertNotCalled(GinkgoT(), "Revoke", mock.Anything, mock.Anything)
+		})
+
+		It("rejects tokens with an invalid signature", func() {
+			signedToken, _ := (&authenticate.JWTCrypto{JWTSecret: "other-secret"}).EncryptJWT("123456789012", uacInfo, 15)
+
+			Expect(jwtCrypto.RevokeJWT(context.Background(), signedToken)).To(MatchError(ContainSubstring("signature is invalid")))
+		})
+	})
+
+	Describe("PeekJWT", func() {
+		It("reads expired tokens", func() {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, authenticate.UACClaims{
+				UacInfo:        *uacInfo,
+				StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Unix() - 60},
+			})
+			signedToken, _ := token.SignedString([]byte("secret"))
+
+			claims, err := jwtCrypto.PeekJWT(signedToken)
+			Expect(err).To(BeNil())
+			Expect(claims.UacInfo.CaseID).To(Equal("bar"))
+		})
+
+		It("rejects tokens with an invalid signature", func() {
+			signedToken, _ := (&authenticate.JWTCrypto{JWTSecret: "other-secret"}).EncryptJWT("123456789012", uacInfo, 15)
+
+			_, err := jwtCrypto.PeekJWT(signedToken)
+			Expect(err).To(MatchError(ContainSubstring("signature is invalid")))
+		})
+	})
+
+	Describe("RevokeTokenID", func() {
+		It("revokes the token ID for the revocation TTL", func() {
+			mockRevocations.On("Revoke", "abc123", 24*time.Hour).Return(nil)
+
+			Expect(jwtCrypto.RevokeTokenID(context.Background(), "abc123")).To(Succeed())
+		})
+
+		It("errors when revocation is not configured", func() {
+			Expect((&authenticate.JWTCrypto{}).RevokeTokenID(context.Background(), "abc123")).To(MatchError("JWT revocation is not configured"))
+		})
+	})
+})
+
+var _ = Describe("JWTCrypto maximum lifetime", func() {
+	var jwtCrypto *authenticate.JWTCrypto
+
+	BeforeEach(func() {
+		jwtCrypto = &authenticate.JWTCrypto{
+			JWTSecret:   "secret",
+			MaxLifetime: 12 * time.Hour,
+			InstrumentMaxLifetimes: map[string]time.Duration{
+				"dia":      4 * time.Hour,
+				"dia2101b": 90 * time.Second,
+			},
+		}
+	})
+
+	DescribeTable("records the login time and the instrument's lifetime",
+		func(instrumentName string, expectedLifetime int) {
+			signedToken, _ := jwtCrypto.EncryptJWT("123456789012", &busapi.UacInfo{InstrumentName: instrumentName}, 15)
+
+			claims, err := jwtCrypto.DecryptJWT(context.Background(), signedToken)
+			Expect(err).To(BeNil())
+			Expect(claims.LoginTime).To(BeNumerically("~", time.Now().Unix(), 1))
+			Expect(claims.MaxLifetime).To(Equal(expectedLifetime))
+		},
+		Entry("default lifetime", "lms2101a", 720),
+		Entry("instrument prefix", "DIA2101A", 240),
+		Entry("longest instrument prefix rounded up to the minute", "dia2101b", 2),
+	)
+
+	It("keeps the login time when the token is refreshed", func() {
+		claims := &authenticate.UACClaims{
+			AuthTimeout:    15,
+			LoginTime:      time.Now().Add(-time.Hour).Unix(),
+			MaxLifetime:    720,
+			StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Unix() + 60},
+		}
+
+		signedToken, _ := jwtCrypto.RefreshJWT(claims)
+		refreshed, err := jwtCrypto.DecryptJWT(context.Background(), signedToken)
+		Expect(err).To(BeNil())
+		Expect(refreshed.LoginTime).To(Equal(claims.LoginTime))
+	})
+
+	It("rejects tokens that have outlived their lifetime however recently they were refreshed", func() {
+		claims := &authenticate.UACClaims{
+			AuthTimeout:    15,
+			LoginTime:      time.Now().Add(-13 * time.Hour).Unix(),
+			MaxLifetime:    720,
+			StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Unix() + 60},
+		}
+
+		signedToken, _ := jwtCrypto.RefreshJWT(claims)
+		_, err := jwtCrypto.DecryptJWT(context.Background(), signedToken)
+		Expect(err).To(Equal(authenticate.ErrSessionLifetimeExceeded))
+	})
+
+	It("starts the lifetime of tokens issued before login times were recorded", func() {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, authenticate.UACClaims{
+			UacInfo:        busapi.UacInfo{InstrumentName: "dia2101a"},
+			StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Unix() + 60},
+		})
+		signedToken, _ := token.SignedString([]byte("secret"))
+
+		claims, err := jwtCrypto.DecryptJWT(context.Background(), signedToken)
+		Expect(err).To(BeNil())
+		Expect(claims.LoginTime).To(BeNumerically("~", time.Now().Unix(), 1))
+		Expect(claims.MaxLifetime).To(Equal(240))
+	})
+})
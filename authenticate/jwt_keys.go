@@ -0,0 +1,100 @@
+package authenticate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// JWTKey is an asymmetric key for signing or verifying session tokens. Keys
+// loaded from a public key have no SignKey and can only verify.
+type JWTKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	SignKey   interface{}
+	VerifyKey interface{}
+}
+
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+	Modulus   string `json:"n,omitempty"`
+	Exponent  string `json:"e,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// LoadJWTKey reads an ECDSA or RSA key, private or public, from a PEM file.
+// ECDSA keys sign with ES256, ES384 or ES512 depending on their curve and RSA
+// keys sign with RS256.
+func LoadJWTKey(keyID, path string) (*JWTKey, error) {
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if privateKey, err := jwt.ParseECPrivateKeyFromPEM(pemBytes); err == nil {
+		return ecdsaJWTKey(keyID, privateKey, &privateKey.PublicKey)
+	}
+	if privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(pemBytes); err == nil {
+		return &JWTKey{ID: keyID, Method: jwt.SigningMethodRS256, SignKey: privateKey, VerifyKey: &privateKey.PublicKey}, nil
+	}
+	if publicKey, err := jwt.ParseECPublicKeyFromPEM(pemBytes); err == nil {
+		return ecdsaJWTKey(keyID, nil, publicKey)
+	}
+	if publicKey, err := jwt.ParseRSAPublicKeyFromPEM(pemBytes); err == nil {
+		return &JWTKey{ID: keyID, Method: jwt.SigningMethodRS256, VerifyKey: publicKey}, nil
+	}
+	return nil, fmt.Errorf("%s is not a PEM encoded ECDSA or RSA key", path)
+}
+
+func ecdsaJWTKey(keyID string, privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey) (*JWTKey, error) {
+	jwtKey := &JWTKey{ID: keyID, VerifyKey: publicKey}
+	if privateKey != nil {
+		jwtKey.SignKey = privateKey
+	}
+	switch publicKey.Curve {
+	case elliptic.P256():
+		jwtKey.Method = jwt.SigningMethodES256
+	case elliptic.P384():
+		jwtKey.Method = jwt.SigningMethodES384
+	case elliptic.P521():
+		jwtKey.Method = jwt.SigningMethodES512
+	default:
+		return nil, fmt.Errorf("unsupported elliptic curve %s", publicKey.Curve.Params().Name)
+	}
+	return jwtKey, nil
+}
+
+func (jwtKey *JWTKey) JSONWebKey() JSONWebKey {
+	jsonWebKey := JSONWebKey{
+		KeyID:     jwtKey.ID,
+		Algorithm: jwtKey.Method.Alg(),
+		Use:       "sig",
+	}
+	switch publicKey := jwtKey.VerifyKey.(type) {
+	case *ecdsa.PublicKey:
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		jsonWebKey.KeyType = "EC"
+		jsonWebKey.Curve = publicKey.Curve.Params().Name
+		jsonWebKey.X = base64.RawURLEncoding.EncodeToString(publicKey.X.FillBytes(make([]byte, size)))
+		jsonWebKey.Y = base64.RawURLEncoding.EncodeToString(publicKey.Y.FillBytes(make([]byte, size)))
+	case *rsa.PublicKey:
+		jsonWebKey.KeyType = "RSA"
+		jsonWebKey.Modulus = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+		jsonWebKey.Exponent = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+	}
+	return jsonWebKey
+}
@@ -0,0 +1,182 @@
+package authenticate_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+
+	"github.com/ONSdigital/blaise-cawi-portal/authenticate"
+	"github.com/ONSdigital/blaise-cawi-portal/busapi"
+	"github.com/golang-jwt/jwt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func writePEM(directory, name, blockType string, der []byte) string {
+	path := filepath.Join(directory, name)
+	Expect(os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)).To(Succeed())
+	return path
+}
+
+var _ = Describe("JWT keys", func() {
+	var (
+		directory  string
+		uacInfo    = &busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}
+		ecdsaKey   *ecdsa.PrivateKey
+		rsaKey     *rsa.PrivateKey
+		ecdsaPath  string
+		rsaPath    string
+		publicPath string
+	)
+
+	BeforeEach(func() {
+		var err error
+		directory, err = os.MkdirTemp("", "jwt_keys")
+		Expect(err).To(BeNil())
+
+		ecdsaKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		ecdsaDER, _ := x509.MarshalECPrivateKey(ecdsaKey)
+		ecdsaPath = writePEM(directory, "ec.pem", "EC PRIVATE KEY", ecdsaDER)
+
+		rsaKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+		rsaPath = writePEM(directory, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+
+		publicDER, _ := x509.MarshalPKIXPublicKey(&ecdsaKey.PublicKey)
+		publicPath = writePEM(directory, "ec.pub", "PUBLIC KEY", publicDER)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(directory)
+	})
+
+	Describe("LoadJWTKey", func() {
+		It("loads ECDSA private keys as ES256", func() {
+			jwtKey, err := authenticate.LoadJWTKey("ec", ecdsaPath)
+			Expect(err).To(BeNil())
+			Expect(jwtKey.Method).To(Equal(jwt.SigningMethodES256))
+			Expect(jwtKey.SignKey).ToNot(BeNil())
+		})
+
+		It("loads RSA private keys as RS256", func() {
+			jwtKey, err := authenticate.LoadJWTKey("rsa", rsaPath)
+			Expect(err).To(BeNil())
+			Expect(jwtKey.Method).To(Equal(jwt.SigningMethodRS256))
+			Expect(jwtKey.SignKey).ToNot(BeNil())
+		})
+
+		It("loads public keys for verification only", func() {
+			jwtKey, err := authenticate.LoadJWTKey("ec", publicPath)
+			Expect(err).To(BeNil())
+			Expect(jwtKey.Method).To(Equal(jwt.SigningMethodES256))
+			Expect(jwtKey.SignKey).To(BeNil())
+		})
+
+		It("rejects files that are not keys", func() {
+			path := writePEM(directory, "junk.pem", "CERTIFICATE REQUEST", []byte("junk"))
+
+			_, err := authenticate.LoadJWTKey("junk", path)
+			Expect(err).To(MatchError(ContainSubstring("is not a PEM encoded ECDSA or RSA key")))
+		})
+	})
+
+	Describe("signing with an asymmetric key", func() {
+		var jwtCrypto *authenticate.JWTCrypto
+
+		BeforeEach(func() {
+			signingKey, _ := authenticate.LoadJWTKey("2021-03", ecdsaPath)
+			jwtCrypto = &authenticate.JWTCrypto{JWTSecret: "secret", KeyID: "default", SigningKey: signingKey}
+		})
+
+		It("signs with the key's algorithm and ID", func() {
+			signedToken, err := jwtCrypto.EncryptJWT("123456789012", uacInfo, 15)
+			Expect(err).To(BeNil())
+
+			token, _, _ := new(jwt.Parser).ParseUnverified(signedToken, &authenticate.UACClaims{})
+			Expect(token.Header["alg"]).To(Equal("ES256"))
+			Expect(token.Header["kid"]).To(Equal("2021-03"))
+
+			claims, err := jwtCrypto.DecryptJWT(context.Background(), signedToken)
+			Expect(err).To(BeNil())
+			Expect(claims.UacInfo.CaseID).To(Equal("bar"))
+		})
+
+		It("still verifies tokens signed with the shared secret", func() {
+			signedToken, _ := (&authenticate.JWTCrypto{JWTSecret: "secret", KeyID: "default"}).EncryptJWT("123456789012", uacInfo, 15)
+
+			token, _, _ := new(jwt.Parser).ParseUnverified(signedToken, &authenticate.UACClaims{})
+			Expect(token.Header["alg"]).To(Equal("HS256"))
+			Expect(token.Header["kid"]).To(Equal("default"))
+			_, err := jwtCrypto.DecryptJWT(context.Background(), signedToken)
+			Expect(err).To(BeNil())
+		})
+
+		It("verifies tokens by algorithm when the shared secret and signing key have the same ID", func() {
+			jwtCrypto.KeyID = "2021-03"
+			signedToken, _ := (&authenticate.JWTCrypto{JWTSecret: "secret", KeyID: "2021-03"}).EncryptJWT("123456789012", uacInfo, 15)
+
+			_, err := jwtCrypto.DecryptJWT(context.Background(), signedToken)
+			Expect(err).To(BeNil())
+		})
+
+		It("verifies tokens signed with a rotated out public key", func() {
+			oldKey, _ := authenticate.LoadJWTKey("2021-02", rsaPath)
+			signedToken, _ := (&authenticate.JWTCrypto{SigningKey: oldKey}).EncryptJWT("123456789012", uacInfo, 15)
+
+			publicKey, _ := authenticate.LoadJWTKey("2021-02", rsaPath)
+			publicKey.SignKey = nil
+			jwtCrypto.PublicKeys = []*authenticate.JWTKey{publicKey}
+
+			_, err := jwtCrypto.DecryptJWT(context.Background(), signedToken)
+			Expect(err).To(BeNil())
+		})
+
+		It("rejects HS256 tokens that claim an asymmetric key ID", func() {
+			signedToken, _ := (&authenticate.JWTCrypto{JWTSecret: "secret", KeyID: "2021-03"}).EncryptJWT("123456789012", uacInfo, 15)
+
+			_, err := jwtCrypto.DecryptJWT(context.Background(), signedToken)
+			Expect(err).To(MatchError(ContainSubstring("unexpected signing method HS256")))
+		})
+	})
+
+	Describe("PublicKeySet", func() {
+		It("publishes asymmetric keys only", func() {
+			signingKey, _ := authenticate.LoadJWTKey("ec", ecdsaPath)
+			publicKey, _ := authenticate.LoadJWTKey("rsa", rsaPath)
+			jwtCrypto := &authenticate.JWTCrypto{
+				JWTSecret:        "secret",
+				VerificationKeys: map[string]string{"old": "old-secret"},
+				SigningKey:       signingKey,
+				PublicKeys:       []*authenticate.JWTKey{publicKey},
+			}
+
+			keySet := jwtCrypto.PublicKeySet()
+			Expect(keySet.Keys).To(HaveLen(2))
+
+			Expect(keySet.Keys[0].KeyType).To(Equal("EC"))
+			Expect(keySet.Keys[0].KeyID).To(Equal("ec"))
+			Expect(keySet.Keys[0].Algorithm).To(Equal("ES256"))
+			Expect(keySet.Keys[0].Use).To(Equal("sig"))
+			Expect(keySet.Keys[0].Curve).To(Equal("P-256"))
+			Expect(keySet.Keys[0].X).To(HaveLen(43))
+			Expect(keySet.Keys[0].Y).To(HaveLen(43))
+
+			Expect(keySet.Keys[1].KeyType).To(Equal("RSA"))
+			Expect(keySet.Keys[1].KeyID).To(Equal("rsa"))
+			Expect(keySet.Keys[1].Algorithm).To(Equal("RS256"))
+			Expect(keySet.Keys[1].Exponent).To(Equal("AQAB"))
+			Expect(keySet.Keys[1].Modulus).ToNot(BeEmpty())
+		})
+
+		It("is empty when only shared secrets are configured", func() {
+			keySet := (&authenticate.JWTCrypto{JWTSecret: "secret"}).PublicKeySet()
+			Expect(keySet.Keys).To(BeEmpty())
+		})
+	})
+})
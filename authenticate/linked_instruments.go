@@ -0,0 +1,138 @@
+package authenticate
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// LinkedInstrumentRule lets a UAC for an instrument matching From access the
+// instruments matching To, so one access code can cover every part of a multi
+// part or follow up survey. Both are regular expressions and To can refer to
+// From's capture groups as $1 or ${1}, so that a rule can tie the parts of
+// the same wave together, e.g. {"from": "^dia(\\d{4})a$", "to": "^dia${1}b$"}
+type LinkedInstrumentRule struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	from *regexp.Regexp
+	// to is nil when To refers to From's capture groups, the expanded patterns
+	// are compiled once and kept in targets instead
+	to      *regexp.Regexp
+	targets *sync.Map
+}
+
+var captureReference = regexp.MustCompile(`\$(\d+)|\$\{(\d+)\}`)
+
+func (rule *LinkedInstrumentRule) compile() error {
+	from, err := regexp.Compile(rule.From)
+	if err != nil || rule.From == "" {
+		return fmt.Errorf("invalid linked instrument rule from pattern %q", rule.From)
+	}
+	references := false
+	for _, match := range captureReference.FindAllStringSubmatch(rule.To, -1) {
+		group, _ := strconv.Atoi(match[1] + match[2])
+		if group < 1 || group > from.NumSubexp() {
+			return fmt.Errorf("linked instrument rule to pattern %q refers to missing group %d of %q", rule.To, group, rule.From)
+		}
+		references = true
+	}
+	to, err := regexp.Compile(captureReference.ReplaceAllString(rule.To, ""))
+	if err != nil || rule.To == "" {
+		return fmt.Errorf("invalid linked instrument rule to pattern %q", rule.To)
+	}
+	rule.from = from
+	if references {
+		rule.targets = &sync.Map{}
+	} else {
+		rule.to = to
+	}
+	return nil
+}
+
+// allows reports whether the rule lets a UAC for authedInstrument access
+// instrumentName
+func (rule LinkedInstrumentRule) allows(authedInstrument, instrumentName string) bool {
+	if rule.from == nil {
+		return false
+	}
+	match := rule.from.FindStringSubmatch(authedInstrument)
+	if match == nil {
+		return false
+	}
+	if rule.to != nil {
+		return rule.to.MatchString(instrumentName)
+	}
+	pattern := captureReference.ReplaceAllStringFunc(rule.To, func(reference string) string {
+		submatch := captureReference.FindStringSubmatch(reference)
+		group, _ := strconv.Atoi(submatch[1] + submatch[2])
+		return regexp.QuoteMeta(match[group])
+	})
+	if to, ok := rule.targets.Load(pattern); ok {
+		return to.(*regexp.Regexp).MatchString(instrumentName)
+	}
+	to, err := regexp.Compile(pattern)
+	if err != nil {
+		return false
+	}
+	rule.targets.Store(pattern, to)
+	return to.MatchString(instrumentName)
+}
+
+type LinkedInstrumentRules []LinkedInstrumentRule
+
+// DefaultLinkedInstrumentRules lets a UAC for any DIA "a" instrument access
+// any DIA "b" instrument
+var DefaultLinkedInstrumentRules = MustLinkedInstrumentRules(
+	LinkedInstrumentRule{From: `^dia\d{4}a$`, To: `^dia\d{4}b$`},
+)
+
+// NewLinkedInstrumentRules compiles the rules, failing on the first invalid one
+func NewLinkedInstrumentRules(rules ...LinkedInstrumentRule) (LinkedInstrumentRules, error) {
+	linkedInstrumentRules := make(LinkedInstrumentRules, len(rules))
+	for i, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return nil, err
+		}
+		linkedInstrumentRules[i] = rule
+	}
+	return linkedInstrumentRules, nil
+}
+
+// MustLinkedInstrumentRules is like NewLinkedInstrumentRules but panics on an
+// invalid rule
+func MustLinkedInstrumentRules(rules ...LinkedInstrumentRule) LinkedInstrumentRules {
+	linkedInstrumentRules, err := NewLinkedInstrumentRules(rules...)
+	if err != nil {
+		panic(err)
+	}
+	return linkedInstrumentRules
+}
+
+// Decode reads the rules from a JSON list, so they can be configured by
+// envconfig, e.g. [{"from":"^lms(\\d{4})a$","to":"^lms${1}[bc]$"}]
+func (linkedInstrumentRules *LinkedInstrumentRules) Decode(value string) error {
+	var rules []LinkedInstrumentRule
+	if err := json.Unmarshal([]byte(value), &rules); err != nil {
+		return fmt.Errorf("invalid linked instrument rules: %w", err)
+	}
+	compiled, err := NewLinkedInstrumentRules(rules...)
+	if err != nil {
+		return err
+	}
+	*linkedInstrumentRules = compiled
+	return nil
+}
+
+// Allows reports whether any rule lets a UAC for authedInstrument access
+// instrumentName
+func (linkedInstrumentRules LinkedInstrumentRules) Allows(authedInstrument, instrumentName string) bool {
+	for _, rule := range linkedInstrumentRules {
+		if rule.allows(authedInstrument, instrumentName) {
+			return true
+		}
+	}
+	return false
+}
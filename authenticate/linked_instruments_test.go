@@ -0,0 +1,91 @@
+package authenticate_test
+
+import (
+	"github.com/ONSdigital/blaise-cawi-portal/authenticate"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LinkedInstrumentRules", func() {
+	DescribeTable("DefaultLinkedInstrumentRules",
+		func(authedInstrument, instrumentName string, expected bool) {
+			Expect(authenticate.DefaultLinkedInstrumentRules.Allows(authedInstrument, instrumentName)).To(Equal(expected))
+		},
+		Entry("both diaA and diaB", "dia1234a", "dia1234b", true),
+		Entry("diaA and a different diaB", "dia1234a", "dia5678b", true),
+		Entry("only diaA", "dia1234a", "notdia5678b", false),
+		Entry("only diaB", "notdia1234a", "dia5678b", false),
+		Entry("neither diaA nor diaB", "notdia1234a", "notdia5678b", false),
+		Entry("diaB and diaA", "dia1234b", "dia1234a", false),
+		Entry("different case for diaA", "Dia1234a", "dia5678b", false),
+		Entry("different case for diaB", "dia1234a", "DIA5678B", false),
+		Entry("both in different case", "DIA1234A", "DIA5678B", false),
+		Entry("invalid names", "bacon", "ham", false),
+	)
+
+	DescribeTable("Allows with capture groups",
+		func(authedInstrument, instrumentName string, expected bool) {
+			rules := authenticate.MustLinkedInstrumentRules(
+				authenticate.LinkedInstrumentRule{From: `^lms(\d{4})a$`, To: `^lms${1}[bc]$`},
+				authenticate.LinkedInstrumentRule{From: `^(?i)opn(\d{2})(\d{2})a$`, To: `^(?i)opn$1$2f$`},
+			)
+			Expect(rules.Allows(authedInstrument, instrumentName)).To(Equal(expected))
+			// The expanded patterns are cached, so check again
+			Expect(rules.Allows(authedInstrument, instrumentName)).To(Equal(expected))
+		},
+		Entry("the same wave", "lms2101a", "lms2101b", true),
+		Entry("another part of the same wave", "lms2101a", "lms2101c", true),
+		Entry("a different wave", "lms2101a", "lms2102b", false),
+		Entry("an unlinked part", "lms2101a", "lms2101d", false),
+		Entry("a follow up with several groups", "opn2101a", "OPN2101F", true),
+		Entry("a follow up for a different wave", "opn2101a", "opn2102f", false),
+	)
+
+	Describe("Decode", func() {
+		It("reads a JSON list of rules", func() {
+			var rules authenticate.LinkedInstrumentRules
+			Expect(rules.Decode(`[{"from":"^lms(\\d{4})a$","to":"^lms${1}b$"},{"from":"^dia\\d{4}a$","to":"^dia\\d{4}b$"}]`)).To(Succeed())
+			Expect(rules).To(HaveLen(2))
+			Expect(rules[0].From).To(Equal(`^lms(\d{4})a$`))
+			Expect(rules[0].To).To(Equal(`^lms${1}b$`))
+			Expect(rules.Allows("lms2101a", "lms2101b")).To(BeTrue())
+			Expect(rules.Allows("dia2101a", "dia2101b")).To(BeTrue())
+		})
+
+		It("reads an empty list as no links", func() {
+			var rules authenticate.LinkedInstrumentRules
+			Expect(rules.Decode(`[]`)).To(Succeed())
+			Expect(rules).ToNot(BeNil())
+			Expect(rules.Allows("dia1234a", "dia1234b")).To(BeFalse())
+		})
+
+		It("rejects invalid JSON", func() {
+			var rules authenticate.LinkedInstrumentRules
+			Expect(rules.Decode(`dia*a:dia*b`)).To(MatchError(ContainSubstring("invalid linked instrument rules")))
+		})
+
+		It("rejects invalid patterns", func() {
+			var rules authenticate.LinkedInstrumentRules
+			Expect(rules.Decode(`[{"from":"^dia(\\d{4}a$","to":"^dia\\d{4}b$"}]`)).To(
+				MatchError(`invalid linked instrument rule from pattern "^dia(\\d{4}a$"`))
+			Expect(rules.Decode(`[{"from":"^dia\\d{4}a$","to":"^dia[\\d{4}b$"}]`)).To(
+				MatchError(`invalid linked instrument rule to pattern "^dia[\\d{4}b$"`))
+			Expect(rules.Decode(`[{"to":"^dia\\d{4}b$"}]`)).To(MatchError(`invalid linked instrument rule from pattern ""`))
+			Expect(rules.Decode(`[{"from":"^dia\\d{4}a$"}]`)).To(MatchError(`invalid linked instrument rule to pattern ""`))
+		})
+
+		It("rejects references to missing groups", func() {
+			var rules authenticate.LinkedInstrumentRules
+			Expect(rules.Decode(`[{"from":"^lms(\\d{4})a$","to":"^lms$2b$"}]`)).To(
+				MatchError(`linked instrument rule to pattern "^lms$2b$" refers to missing group 2 of "^lms(\\d{4})a$"`))
+			Expect(rules).To(BeNil())
+		})
+	})
+
+	It("panics on invalid rules when they must compile", func() {
+		Expect(func() {
+			authenticate.MustLinkedInstrumentRules(authenticate.LinkedInstrumentRule{From: "(", To: "b"})
+		}).To(Panic())
+	})
+})
@@ -21,6 +21,25 @@ func (_m *AuthInterface) AuthenticatedWithUac(_a0 *gin.Context) {
 	_m.Called(_a0)
 }
 
+// CaseSelection provides a mock function with given fields: _a0
+func (_m *AuthInterface) CaseSelection(_a0 *gin.Context) {
+	_m.Called(_a0)
+}
+
+// EndSession provides a mock function with given fields: _a0, _a1, _a2
+func (_m *AuthInterface) EndSession(_a0 *gin.Context, _a1 sessions.Session, _a2 authenticate.SessionEnd) error {
+	ret := _m.Called(_a0, _a1, _a2)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*gin.Context, sessions.Session, authenticate.SessionEnd) error); ok {
+		r0 = rf(_a0, _a1, _a2)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // HasSession provides a mock function with given fields: _a0
 func (_m *AuthInterface) HasSession(_a0 *gin.Context) (bool, *authenticate.UACClaims) {
 	ret := _m.Called(_a0)
@@ -63,3 +82,22 @@ func (_m *AuthInterface) NotAuthWithError(_a0 *gin.Context, _a1 string) {
 func (_m *AuthInterface) RefreshToken(_a0 *gin.Context, _a1 sessions.Session, _a2 *authenticate.UACClaims) {
 	_m.Called(_a0, _a1, _a2)
 }
+
+// SelectCase provides a mock function with given fields: _a0, _a1
+func (_m *AuthInterface) SelectCase(_a0 *gin.Context, _a1 sessions.Session) {
+	_m.Called(_a0, _a1)
+}
+
+// SignedInElsewhere provides a mock function with given fields: _a0
+func (_m *AuthInterface) SignedInElsewhere(_a0 *gin.Context) bool {
+	ret := _m.Called(_a0)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(*gin.Context) bool); ok {
+		r0 = rf(_a0)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
@@ -3,6 +3,8 @@
 package mocks
 
 import (
+	context "context"
+
 	authenticate "github.com/ONSdigital/blaise-cawi-portal/authenticate"
 	busapi "github.com/ONSdigital/blaise-cawi-portal/busapi"
 
@@ -14,13 +16,13 @@ type JWTCryptoInterface struct {
 	mock.Mock
 }
 
-// DecryptJWT provides a mock function with given fields: _a0
-func (_m *JWTCryptoInterface) DecryptJWT(_a0 interface{}) (*authenticate.UACClaims, error) {
-	ret := _m.Called(_a0)
+// DecryptJWT provides a mock function with given fields: _a0, _a1
+func (_m *JWTCryptoInterface) DecryptJWT(_a0 context.Context, _a1 interface{}) (*authenticate.UACClaims, error) {
+	ret := _m.Called(_a0, _a1)
 
 	var r0 *authenticate.UACClaims
-	if rf, ok := ret.Get(0).(func(interface{}) *authenticate.UACClaims); ok {
-		r0 = rf(_a0)
+	if rf, ok := ret.Get(0).(func(context.Context, interface{}) *authenticate.UACClaims); ok {
+		r0 = rf(_a0, _a1)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*authenticate.UACClaims)
@@ -28,8 +30,8 @@ func (_m *JWTCryptoInterface) DecryptJWT(_a0 interface{}) (*authenticate.UACClai
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(interface{}) error); ok {
-		r1 = rf(_a0)
+	if rf, ok := ret.Get(1).(func(context.Context, interface{}) error); ok {
+		r1 = rf(_a0, _a1)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -57,3 +59,103 @@ func (_m *JWTCryptoInterface) EncryptJWT(_a0 string, _a1 *busapi.UacInfo, _a2 in
 
 	return r0, r1
 }
+
+// HashUAC provides a mock function with given fields: _a0
+func (_m *JWTCryptoInterface) HashUAC(_a0 string) string {
+	ret := _m.Called(_a0)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string) string); ok {
+		r0 = rf(_a0)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// PeekJWT provides a mock function with given fields: _a0
+func (_m *JWTCryptoInterface) PeekJWT(_a0 interface{}) (*authenticate.UACClaims, error) {
+	ret := _m.Called(_a0)
+
+	var r0 *authenticate.UACClaims
+	if rf, ok := ret.Get(0).(func(interface{}) *authenticate.UACClaims); ok {
+		r0 = rf(_a0)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*authenticate.UACClaims)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(interface{}) error); ok {
+		r1 = rf(_a0)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PublicKeySet provides a mock function with given fields:
+func (_m *JWTCryptoInterface) PublicKeySet() authenticate.JSONWebKeySet {
+	ret := _m.Called()
+
+	var r0 authenticate.JSONWebKeySet
+	if rf, ok := ret.Get(0).(func() authenticate.JSONWebKeySet); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(authenticate.JSONWebKeySet)
+	}
+
+	return r0
+}
+
+// RefreshJWT provides a mock function with given fields: _a0
+func (_m *JWTCryptoInterface) RefreshJWT(_a0 *authenticate.UACClaims) (string, error) {
+	ret := _m.Called(_a0)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(*authenticate.UACClaims) string); ok {
+		r0 = rf(_a0)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*authenticate.UACClaims) error); ok {
+		r1 = rf(_a0)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RevokeJWT provides a mock function with given fields: _a0, _a1
+func (_m *JWTCryptoInterface) RevokeJWT(_a0 context.Context, _a1 interface{}) error {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, interface{}) error); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RevokeTokenID provides a mock function with given fields: _a0, _a1
+func (_m *JWTCryptoInterface) RevokeTokenID(_a0 context.Context, _a1 string) error {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
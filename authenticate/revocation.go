@@ -0,0 +1,41 @@
+package authenticate
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ONSdigital/blaise-cawi-portal/kvstore"
+)
+
+var ErrTokenRevoked = errors.New("JWT has been revoked")
+
+// Generate mocks by running "go generate ./..."
+//
+//go:generate mockery --name RevocationListInterface
+type RevocationListInterface interface {
+	Revoke(string, time.Duration) error
+	Revoked(string) (bool, error)
+}
+
+// RevocationList records the IDs of revoked tokens until every copy of them
+// would have expired anyway.
+type RevocationList struct {
+	Store kvstore.Store
+}
+
+func (revocationList *RevocationList) Revoke(tokenID string, ttl time.Duration) error {
+	if tokenID == "" {
+		return fmt.Errorf("cannot revoke a JWT without an ID")
+	}
+	return revocationList.Store.Set(revocationList.key(tokenID), "revoked", ttl)
+}
+
+func (revocationList *RevocationList) Revoked(tokenID string) (bool, error) {
+	_, found, err := revocationList.Store.Get(revocationList.key(tokenID))
+	return found, err
+}
+
+func (revocationList *RevocationList) key(tokenID string) string {
+	return fmt.Sprintf("revoked_jwt:%s", tokenID)
+}
@@ -0,0 +1,48 @@
+package authenticate_test
+
+import (
+	"time"
+
+	"github.com/ONSdigital/blaise-cawi-portal/authenticate"
+	"github.com/ONSdigital/blaise-cawi-portal/kvstore"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RevocationList", func() {
+	var (
+		now            time.Time
+		revocationList *authenticate.RevocationList
+	)
+
+	BeforeEach(func() {
+		now = time.Now()
+		revocationList = &authenticate.RevocationList{
+			Store: &kvstore.MemoryStore{Clock: func() time.Time { return now }},
+		}
+	})
+
+	It("reports revoked token IDs until the TTL passes", func() {
+		Expect(revocationList.Revoke("abc123", time.Minute)).To(Succeed())
+
+		revoked, err := revocationList.Revoked("abc123")
+		Expect(err).To(BeNil())
+		Expect(revoked).To(BeTrue())
+
+		now = now.Add(time.Minute + time.Second)
+		revoked, _ = revocationList.Revoked("abc123")
+		Expect(revoked).To(BeFalse())
+	})
+
+	It("does not report other token IDs", func() {
+		_ = revocationList.Revoke("abc123", time.Minute)
+
+		revoked, _ := revocationList.Revoked("def456")
+		Expect(revoked).To(BeFalse())
+	})
+
+	It("refuses to revoke an empty token ID", func() {
+		Expect(revocationList.Revoke("", time.Minute)).To(MatchError("cannot revoke a JWT without an ID"))
+	})
+})
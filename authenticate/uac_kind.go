@@ -0,0 +1,291 @@
+package authenticate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// UacKind describes one format of access code that can be printed on a
+// respondent's letter. New formats only need to implement this interface and
+// be registered with RegisterUacKind to be accepted by the portal.
+type UacKind interface {
+	Name() string
+	Length() int
+	Numeric() bool
+	InputWidth() int
+	Normalise(string) string
+	ValidFormat(string) bool
+	ValidCheckCharacters(string) bool
+	Description() map[string]string
+	Hint() map[string]string
+	InvalidError() map[string]string
+	LetterImage() map[string]string
+}
+
+type UacFormat struct {
+	FormatName        string
+	FormatLength      int
+	Pattern           *regexp.Regexp
+	CheckCharacters   func(string) bool
+	NumericOnly       bool
+	Width             int
+	FormatDescription map[string]string
+	FormatHint        map[string]string
+	Image             map[string]string
+}
+
+var (
+	Uac12 UacKind = &UacFormat{
+		FormatName:      "uac",
+		FormatLength:    12,
+		Pattern:         regexp.MustCompile(`^\d{12}$`),
+		CheckCharacters: LuhnMod10,
+		NumericOnly:     true,
+		Width:           10,
+		FormatDescription: map[string]string{
+			"english": "12-digit",
+			"welsh":   "12 o nodau",
+		},
+		Image: map[string]string{
+			"english": "/assets/images/ONS-online-studies-letter-12-digit.svg",
+			"welsh":   "/assets/images/ONS-online-studies-letter-12-digit-welsh.svg",
+		},
+	}
+	Uac16 UacKind = &UacFormat{
+		FormatName:      "uac16",
+		FormatLength:    16,
+		Pattern:         regexp.MustCompile(`^[a-zA-Z0-9]{16}$`),
+		CheckCharacters: LuhnMod36,
+		Width:           15,
+		FormatDescription: map[string]string{
+			"english": "16-character",
+			"welsh":   "16 o nodau",
+		},
+		FormatHint: map[string]string{
+			"english": "Your 16-character access code will be a combination of letters and numbers.",
+			"welsh":   "Bydd eich cod 16 o nodau yn gymysg o lythrennau a rhifau.",
+		},
+		Image: map[string]string{
+			"english": "/assets/images/ONS-online-studies-letter-16-character.svg",
+			"welsh":   "/assets/images/ONS-online-studies-letter-16-character-welsh.svg",
+		},
+	}
+
+	uacKindRegistry = map[string]UacKind{
+		Uac12.Name(): Uac12,
+		Uac16.Name(): Uac16,
+	}
+)
+
+func RegisterUacKind(uacKind UacKind) {
+	uacKindRegistry[uacKind.Name()] = uacKind
+}
+
+func LookupUacKind(name string) (UacKind, error) {
+	uacKind, found := uacKindRegistry[strings.TrimSpace(name)]
+	if !found {
+		return nil, fmt.Errorf("unknown UAC kind %q", name)
+	}
+	return uacKind, nil
+}
+
+func (uacFormat *UacFormat) Name() string {
+	return uacFormat.FormatName
+}
+
+func (uacFormat *UacFormat) Length() int {
+	return uacFormat.FormatLength
+}
+
+func (uacFormat *UacFormat) Numeric() bool {
+	return uacFormat.NumericOnly
+}
+
+func (uacFormat *UacFormat) InputWidth() int {
+	return uacFormat.Width
+}
+
+// Normalise strips the whitespace respondents use to group the characters
+func (uacFormat *UacFormat) Normalise(uac string) string {
+	return strings.Join(strings.Fields(uac), "")
+}
+
+func (uacFormat *UacFormat) ValidFormat(uac string) bool {
+	return len(uac) == uacFormat.FormatLength && uacFormat.Pattern.MatchString(uac)
+}
+
+// ValidCheckCharacters validates the access code's check characters, which
+// catches most typos without a round trip to BUS. Kinds without a check
+// character scheme always pass.
+func (uacFormat *UacFormat) ValidCheckCharacters(uac string) bool {
+	if uacFormat.CheckCharacters == nil {
+		return true
+	}
+	return uacFormat.CheckCharacters(uac)
+}
+
+func (uacFormat *UacFormat) Description() map[string]string {
+	return uacFormat.FormatDescription
+}
+
+func (uacFormat *UacFormat) Hint() map[string]string {
+	return uacFormat.FormatHint
+}
+
+func (uacFormat *UacFormat) InvalidError() map[string]string {
+	return invalidLengthError(uacFormat.FormatDescription["english"], uacFormat.FormatDescription["welsh"])
+}
+
+func (uacFormat *UacFormat) LetterImage() map[string]string {
+	return uacFormat.Image
+}
+
+// UacKinds are the kinds of access code a deployment accepts. They are
+// configured as a comma separated list of names, e.g. "uac,uac16".
+type UacKinds []UacKind
+
+func ParseUacKinds(names string) (UacKinds, error) {
+	var uacKinds UacKinds
+	for _, name := range strings.Split(names, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		uacKind, err := LookupUacKind(name)
+		if err != nil {
+			return nil, err
+		}
+		uacKinds = append(uacKinds, uacKind)
+	}
+	if len(uacKinds) == 0 {
+		return nil, fmt.Errorf("no UAC kinds configured")
+	}
+	return uacKinds, nil
+}
+
+// Decode allows UacKinds to be loaded by envconfig
+func (uacKinds *UacKinds) Decode(value string) error {
+	parsed, err := ParseUacKinds(value)
+	if err != nil {
+		return err
+	}
+	*uacKinds = parsed
+	return nil
+}
+
+// Detect returns the first kind the input is a valid access code for, along
+// with the access code normalised for that kind
+func (uacKinds UacKinds) Detect(input string) (UacKind, string, bool) {
+	for _, uacKind := range uacKinds {
+		uac := uacKind.Normalise(input)
+		if uacKind.ValidFormat(uac) {
+			return uacKind, uac, true
+		}
+	}
+	return nil, "", false
+}
+
+// MatchesLength reports whether the input is the right length for any kind
+func (uacKinds UacKinds) MatchesLength(input string) bool {
+	for _, uacKind := range uacKinds {
+		if len(uacKind.Normalise(input)) == uacKind.Length() {
+			return true
+		}
+	}
+	return false
+}
+
+func (uacKinds UacKinds) InvalidError() map[string]string {
+	if len(uacKinds) == 1 {
+		return uacKinds[0].InvalidError()
+	}
+	return invalidLengthError(uacKinds.Description(false), uacKinds.Description(true))
+}
+
+func (uacKinds UacKinds) Description(welsh bool) string {
+	separator := " or "
+	if welsh {
+		separator = " neu "
+	}
+	var descriptions []string
+	for _, uacKind := range uacKinds {
+		descriptions = append(descriptions, uacKind.Description()[languageKey(welsh)])
+	}
+	return strings.Join(descriptions, separator)
+}
+
+func (uacKinds UacKinds) Hints(welsh bool) []string {
+	var hints []string
+	for _, uacKind := range uacKinds {
+		if hint := uacKind.Hint(); hint != nil {
+			hints = append(hints, hint[languageKey(welsh)])
+		}
+	}
+	return hints
+}
+
+func (uacKinds UacKinds) LetterImages(welsh bool) []string {
+	var images []string
+	for _, uacKind := range uacKinds {
+		images = append(images, uacKind.LetterImage()[languageKey(welsh)])
+	}
+	return images
+}
+
+// Numeric reports whether every accepted kind is made up of digits only
+func (uacKinds UacKinds) Numeric() bool {
+	for _, uacKind := range uacKinds {
+		if !uacKind.Numeric() {
+			return false
+		}
+	}
+	return true
+}
+
+// MaxLength allows for the longest kind typed in groups of four separated by spaces
+func (uacKinds UacKinds) MaxLength() int {
+	var maxLength int
+	for _, uacKind := range uacKinds {
+		if groupedLength := uacKind.Length() + (uacKind.Length()-1)/4; groupedLength > maxLength {
+			maxLength = groupedLength
+		}
+	}
+	return maxLength
+}
+
+func (uacKinds UacKinds) InputWidth() int {
+	var inputWidth int
+	for _, uacKind := range uacKinds {
+		if uacKind.InputWidth() > inputWidth {
+			inputWidth = uacKind.InputWidth()
+		}
+	}
+	return inputWidth
+}
+
+func (uacKinds UacKinds) lengthField() zap.Field {
+	if len(uacKinds) == 1 {
+		return zap.Int("UACLength", uacKinds[0].Length())
+	}
+	var lengths []int
+	for _, uacKind := range uacKinds {
+		lengths = append(lengths, uacKind.Length())
+	}
+	return zap.Ints("UACLengths", lengths)
+}
+
+func invalidLengthError(englishDescription, welshDescription string) map[string]string {
+	return map[string]string{
+		"english": fmt.Sprintf(INVALID_LENGTH_ERR["english"], englishDescription),
+		"welsh":   fmt.Sprintf(INVALID_LENGTH_ERR["welsh"], welshDescription),
+	}
+}
+
+func languageKey(welsh bool) string {
+	if welsh {
+		return "welsh"
+	}
+	return "english"
+}
@@ -0,0 +1,97 @@
+package authenticate_test
+
+import (
+	"github.com/ONSdigital/blaise-cawi-portal/authenticate"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("UacKinds", func() {
+	Describe("ParseUacKinds", func() {
+		It("looks up each comma separated kind", func() {
+			uacKinds, err := authenticate.ParseUacKinds("uac, uac16")
+			Expect(err).To(BeNil())
+			Expect(uacKinds).To(Equal(authenticate.UacKinds{authenticate.Uac12, authenticate.Uac16}))
+		})
+
+		It("errors for an unknown kind", func() {
+			_, err := authenticate.ParseUacKinds("uac,uac20")
+			Expect(err).To(MatchError(`unknown UAC kind "uac20"`))
+		})
+
+		It("errors when no kinds are given", func() {
+			_, err := authenticate.ParseUacKinds(" ")
+			Expect(err).To(MatchError("no UAC kinds configured"))
+		})
+	})
+
+	DescribeTable("Detect",
+		func(input string, expectedKind authenticate.UacKind, expectedUac string) {
+			uacKinds := authenticate.UacKinds{authenticate.Uac12, authenticate.Uac16}
+			uacKind, uac, valid := uacKinds.Detect(input)
+			Expect(uac).To(Equal(expectedUac))
+			if expectedKind == nil {
+				Expect(valid).To(BeFalse())
+				Expect(uacKind).To(BeNil())
+				return
+			}
+			Expect(valid).To(BeTrue())
+			Expect(uacKind).To(Equal(expectedKind))
+		},
+		Entry("12 digit", "123456789012", authenticate.Uac12, "123456789012"),
+		Entry("spaced 12 digit", "1234 5678 9012", authenticate.Uac12, "123456789012"),
+		Entry("16 character", "bcdf5678ghjk2345", authenticate.Uac16, "bcdf5678ghjk2345"),
+		Entry("spaced 16 character", "bcdf 5678 ghjk 2345", authenticate.Uac16, "bcdf5678ghjk2345"),
+		Entry("12 characters with letters", "12345678901a", nil, ""),
+		Entry("wrong length", "12345", nil, ""),
+		Entry("16 characters with symbols", "bcdf5678ghjk234!", nil, ""),
+	)
+
+	Describe("a single kind", func() {
+		var uacKinds = authenticate.UacKinds{authenticate.Uac16}
+
+		It("describes the kind", func() {
+			Expect(uacKinds.Description(false)).To(Equal("16-character"))
+			Expect(uacKinds.Description(true)).To(Equal("16 o nodau"))
+			Expect(uacKinds.InvalidError()["english"]).To(Equal("Enter your 16-character access code"))
+			Expect(uacKinds.InvalidError()["welsh"]).To(Equal("Rhowch eich cod mynediad sy'n cynnwys 16 o nodau"))
+			Expect(uacKinds.MaxLength()).To(Equal(19))
+			Expect(uacKinds.Numeric()).To(BeFalse())
+			Expect(uacKinds.LetterImages(false)).To(Equal([]string{"/assets/images/ONS-online-studies-letter-16-character.svg"}))
+		})
+	})
+
+	Describe("several kinds", func() {
+		var uacKinds = authenticate.UacKinds{authenticate.Uac12, authenticate.Uac16}
+
+		It("describes all of the kinds", func() {
+			Expect(uacKinds.Description(false)).To(Equal("12-digit or 16-character"))
+			Expect(uacKinds.Description(true)).To(Equal("12 o nodau neu 16 o nodau"))
+			Expect(uacKinds.InvalidError()["english"]).To(Equal("Enter your 12-digit or 16-character access code"))
+			Expect(uacKinds.MaxLength()).To(Equal(19))
+			Expect(uacKinds.InputWidth()).To(Equal(15))
+			Expect(uacKinds.Numeric()).To(BeFalse())
+			Expect(uacKinds.Hints(false)).To(HaveLen(1))
+			Expect(uacKinds.LetterImages(true)).To(Equal([]string{
+				"/assets/images/ONS-online-studies-letter-12-digit-welsh.svg",
+				"/assets/images/ONS-online-studies-letter-16-character-welsh.svg",
+			}))
+		})
+	})
+})
+
+var _ = DescribeTable("ValidCheckCharacters",
+	func(uacKind authenticate.UacKind, uac string, expected bool) {
+		Expect(uacKind.ValidCheckCharacters(uac)).To(Equal(expected))
+	},
+	Entry("valid 12 digit", authenticate.Uac12, "123456789015", true),
+	Entry("12 digit with a typo", authenticate.Uac12, "123456789051", false),
+	Entry("12 digit with the wrong check digit", authenticate.Uac12, "123456789012", false),
+	Entry("valid 16 character", authenticate.Uac16, "bcdf5678ghjk234g", true),
+	Entry("valid 16 character in upper case", authenticate.Uac16, "BCDF5678GHJK234G", true),
+	Entry("16 character with a typo", authenticate.Uac16, "bcdf5687ghjk234g", false),
+	Entry("16 character with the wrong check character", authenticate.Uac16, "bcdf5678ghjk2345", false),
+	Entry("kind without a check character scheme", &authenticate.UacFormat{}, "anything", true),
+)
@@ -0,0 +1,233 @@
+package blaiserestapi
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Generate mocks by running "go generate ./..."
+//go:generate mockery --name InstrumentSettingsCacheInterface
+type InstrumentSettingsCacheInterface interface {
+	Stats() CacheStats
+	Invalidate(string)
+}
+
+type CacheStats struct {
+	Entries   int    `json:"entries"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Coalesced uint64 `json:"coalesced"`
+	Stale     uint64 `json:"stale"`
+	Errors    uint64 `json:"errors"`
+	Evicted   uint64 `json:"evicted"`
+}
+
+const defaultMaxEntries = 1000
+
+type cacheEntry struct {
+	value     interface{}
+	fetchedAt time.Time
+}
+
+type cacheCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// What is cached for an instrument, which prefixes its keys
+const (
+	settingsKind   = "settings"
+	statusKind     = "status"
+	surveyDaysKind = "surveydays"
+)
+
+var cachedKinds = []string{settingsKind, statusKind, surveyDaysKind}
+
+// CachingBlaiseRestApi caches instrument settings for TTL, and questionnaire
+// statuses and survey days for the shorter StatusTTL, so logins do not each
+// need calls to the REST API. Concurrent misses share one call. Values older
+// than their TTL, but not StaleTTL, are served straight away while they are
+// fetched again in the background, one fetch per value at a time, and are
+// kept when the REST API cannot be reached. Statuses and survey days are not
+// cached when StatusTTL is 0.
+//
+// At most MaxEntries values are cached, 1000 if it is not set, the one
+// fetched longest ago making way for another.
+type CachingBlaiseRestApi struct {
+	BlaiseRestApi BlaiseRestApiInterface
+	TTL           time.Duration
+	StatusTTL     time.Duration
+	StaleTTL      time.Duration
+	MaxEntries    int
+	Clock         func() time.Time
+
+	mutex    sync.Mutex
+	entries  map[string]cacheEntry
+	inflight map[string]*cacheCall
+	stats    CacheStats
+}
+
+func (cachingBlaiseRestApi *CachingBlaiseRestApi) GetInstrumentSettings(ctx context.Context, instrumentName string) (InstrumentSettings, error) {
+	value, err := cachingBlaiseRestApi.get(ctx, settingsKind, instrumentName, cachingBlaiseRestApi.TTL, func(ctx context.Context) (interface{}, error) {
+		return cachingBlaiseRestApi.BlaiseRestApi.GetInstrumentSettings(ctx, instrumentName)
+	})
+	settings, _ := value.(InstrumentSettings)
+	return settings, err
+}
+
+// GetQuestionnaireStatus is only cached for StatusTTL, so questionnaires taken
+// offline soon stop being signed in to
+func (cachingBlaiseRestApi *CachingBlaiseRestApi) GetQuestionnaireStatus(ctx context.Context, instrumentName string) (QuestionnaireStatus, error) {
+	if cachingBlaiseRestApi.StatusTTL <= 0 {
+		return cachingBlaiseRestApi.BlaiseRestApi.GetQuestionnaireStatus(ctx, instrumentName)
+	}
+	value, err := cachingBlaiseRestApi.get(ctx, statusKind, instrumentName, cachingBlaiseRestApi.StatusTTL, func(ctx context.Context) (interface{}, error) {
+		return cachingBlaiseRestApi.BlaiseRestApi.GetQuestionnaireStatus(ctx, instrumentName)
+	})
+	status, _ := value.(QuestionnaireStatus)
+	return status, err
+}
+
+func (cachingBlaiseRestApi *CachingBlaiseRestApi) GetSurveyDays(ctx context.Context, instrumentName string) (SurveyDays, error) {
+	if cachingBlaiseRestApi.StatusTTL <= 0 {
+		return cachingBlaiseRestApi.BlaiseRestApi.GetSurveyDays(ctx, instrumentName)
+	}
+	value, err := cachingBlaiseRestApi.get(ctx, surveyDaysKind, instrumentName, cachingBlaiseRestApi.StatusTTL, func(ctx context.Context) (interface{}, error) {
+		return cachingBlaiseRestApi.BlaiseRestApi.GetSurveyDays(ctx, instrumentName)
+	})
+	surveyDays, _ := value.(SurveyDays)
+	return surveyDays, err
+}
+
+func (cachingBlaiseRestApi *CachingBlaiseRestApi) get(ctx context.Context, kind, instrumentName string, ttl time.Duration, fetch func(context.Context) (interface{}, error)) (interface{}, error) {
+	key := cacheKey(kind, instrumentName)
+	// Calls are shared, so they must not be cancelled when the respondent who
+	// happened to start one goes away
+	sharedCtx := context.WithoutCancel(ctx)
+
+	cachingBlaiseRestApi.mutex.Lock()
+	cachingBlaiseRestApi.init()
+	entry, cached := cachingBlaiseRestApi.entries[key]
+	age := cachingBlaiseRestApi.now().Sub(entry.fetchedAt)
+	if cached && age < ttl {
+		cachingBlaiseRestApi.stats.Hits++
+		cachingBlaiseRestApi.mutex.Unlock()
+		return entry.value, nil
+	}
+	if cached && age < cachingBlaiseRestApi.StaleTTL {
+		cachingBlaiseRestApi.stats.Stale++
+		if _, refreshing := cachingBlaiseRestApi.inflight[key]; !refreshing {
+			cachingBlaiseRestApi.start(sharedCtx, key, fetch)
+		}
+		cachingBlaiseRestApi.mutex.Unlock()
+		return entry.value, nil
+	}
+	call, found := cachingBlaiseRestApi.inflight[key]
+	if found {
+		cachingBlaiseRestApi.stats.Coalesced++
+	} else {
+		cachingBlaiseRestApi.stats.Misses++
+		call = cachingBlaiseRestApi.start(sharedCtx, key, fetch)
+	}
+	cachingBlaiseRestApi.mutex.Unlock()
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// start fetches the value in the background, as the call for key that others
+// share until it is done
+func (cachingBlaiseRestApi *CachingBlaiseRestApi) start(ctx context.Context, key string, fetch func(context.Context) (interface{}, error)) *cacheCall {
+	call := &cacheCall{done: make(chan struct{})}
+	cachingBlaiseRestApi.inflight[key] = call
+	go cachingBlaiseRestApi.fetch(ctx, key, fetch, call)
+	return call
+}
+
+func (cachingBlaiseRestApi *CachingBlaiseRestApi) fetch(ctx context.Context, key string, fetch func(context.Context) (interface{}, error), call *cacheCall) {
+	call.value, call.err = fetch(ctx)
+
+	cachingBlaiseRestApi.mutex.Lock()
+	switch {
+	case call.err == nil:
+		cachingBlaiseRestApi.store(key, cacheEntry{value: call.value, fetchedAt: cachingBlaiseRestApi.now()})
+	case call.err == InstrumentNotFoundError:
+		delete(cachingBlaiseRestApi.entries, key)
+	default:
+		cachingBlaiseRestApi.stats.Errors++
+	}
+	delete(cachingBlaiseRestApi.inflight, key)
+	cachingBlaiseRestApi.mutex.Unlock()
+	close(call.done)
+}
+
+// store caches the entry, evicting the one fetched longest ago when the cache
+// is full
+func (cachingBlaiseRestApi *CachingBlaiseRestApi) store(key string, entry cacheEntry) {
+	if _, cached := cachingBlaiseRestApi.entries[key]; !cached && len(cachingBlaiseRestApi.entries) >= cachingBlaiseRestApi.maxEntries() {
+		var (
+			oldestKey string
+			oldest    time.Time
+			found     bool
+		)
+		for cachedKey, cachedEntry := range cachingBlaiseRestApi.entries {
+			if !found || cachedEntry.fetchedAt.Before(oldest) {
+				oldestKey, oldest, found = cachedKey, cachedEntry.fetchedAt, true
+			}
+		}
+		delete(cachingBlaiseRestApi.entries, oldestKey)
+		cachingBlaiseRestApi.stats.Evicted++
+	}
+	cachingBlaiseRestApi.entries[key] = entry
+}
+
+// Invalidate drops everything cached for one instrument, so it is fetched
+// again on next use
+func (cachingBlaiseRestApi *CachingBlaiseRestApi) Invalidate(instrumentName string) {
+	cachingBlaiseRestApi.mutex.Lock()
+	defer cachingBlaiseRestApi.mutex.Unlock()
+	for _, kind := range cachedKinds {
+		delete(cachingBlaiseRestApi.entries, cacheKey(kind, instrumentName))
+	}
+}
+
+func (cachingBlaiseRestApi *CachingBlaiseRestApi) Stats() CacheStats {
+	cachingBlaiseRestApi.mutex.Lock()
+	defer cachingBlaiseRestApi.mutex.Unlock()
+	stats := cachingBlaiseRestApi.stats
+	stats.Entries = len(cachingBlaiseRestApi.entries)
+	return stats
+}
+
+func (cachingBlaiseRestApi *CachingBlaiseRestApi) init() {
+	if cachingBlaiseRestApi.entries == nil {
+		cachingBlaiseRestApi.entries = map[string]cacheEntry{}
+		cachingBlaiseRestApi.inflight = map[string]*cacheCall{}
+	}
+}
+
+func cacheKey(kind, instrumentName string) string {
+	return fmt.Sprintf("%s:%s", kind, strings.ToLower(instrumentName))
+}
+
+func (cachingBlaiseRestApi *CachingBlaiseRestApi) maxEntries() int {
+	if cachingBlaiseRestApi.MaxEntries > 0 {
+		return cachingBlaiseRestApi.MaxEntries
+	}
+	return defaultMaxEntries
+}
+
+func (cachingBlaiseRestApi *CachingBlaiseRestApi) now() time.Time {
+	if cachingBlaiseRestApi.Clock != nil {
+		return cachingBlaiseRestApi.Clock()
+	}
+	return time.Now()
+}
@@ -0,0 +1,255 @@
+package blaiserestapi_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ONSdigital/blaise-cawi-portal/blaiserestapi"
+	"github.com/ONSdigital/blaise-cawi-portal/blaiserestapi/mocks"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CachingBlaiseRestApi", func() {
+	var (
+		now                  time.Time
+		mockRestApi          *mocks.BlaiseRestApiInterface
+		cachingBlaiseRestApi *blaiserestapi.CachingBlaiseRestApi
+		settings             = blaiserestapi.InstrumentSettings{{Type: "StrictInterviewing", SessionTimeout: 15}}
+	)
+
+	BeforeEach(func() {
+		now = time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+		mockRestApi = &mocks.BlaiseRestApiInterface{}
+		cachingBlaiseRestApi = &blaiserestapi.CachingBlaiseRestApi{
+			BlaiseRestApi: mockRestApi,
+			TTL:           5 * time.Minute,
+			StatusTTL:     30 * time.Second,
+			StaleTTL:      time.Hour,
+			Clock:         func() time.Time { return now },
+		}
+	})
+
+	It("serves settings from the cache until the TTL passes, then refreshes them in the background", func() {
+		var fetches atomic.Int32
+		mockRestApi.On("GetInstrumentSettings", mock.Anything, "dst2101a").Run(func(mock.Arguments) { fetches.Add(1) }).Return(settings, nil)
+
+		Expect(cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "dst2101a")).To(Equal(settings))
+		now = now.Add(4 * time.Minute)
+		Expect(cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "DST2101A")).To(Equal(settings))
+		mockRestApi.AssertNumberOfCalls(GinkgoT(), "GetInstrumentSettings", 1)
+
+		now = now.Add(2 * time.Minute)
+		Expect(cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "dst2101a")).To(Equal(settings))
+		Eventually(fetches.Load).Should(Equal(int32(2)))
+		Eventually(cachingBlaiseRestApi.Stats).Should(Equal(blaiserestapi.CacheStats{Entries: 1, Hits: 1, Misses: 1, Stale: 1}))
+
+		Expect(cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "dst2101a")).To(Equal(settings))
+		Expect(cachingBlaiseRestApi.Stats().Hits).To(Equal(uint64(2)))
+	})
+
+	It("serves stale settings without waiting for them to be refreshed", func() {
+		release := make(chan struct{})
+		mockRestApi.On("GetInstrumentSettings", mock.Anything, "dst2101a").Once().Return(settings, nil)
+		var refreshes atomic.Int32
+		mockRestApi.On("GetInstrumentSettings", mock.Anything, "dst2101a").Run(func(mock.Arguments) { refreshes.Add(1) }).Return(func(context.Context, string) blaiserestapi.InstrumentSettings {
+			<-release
+			return settings
+		}, nil)
+
+		_, _ = cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "dst2101a")
+		now = now.Add(10 * time.Minute)
+
+		for i := 0; i < 3; i++ {
+			Expect(cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "dst2101a")).To(Equal(settings))
+		}
+		Eventually(refreshes.Load).Should(Equal(int32(1)))
+		Consistently(refreshes.Load, 50*time.Millisecond).Should(Equal(int32(1)))
+		Expect(cachingBlaiseRestApi.Stats().Stale).To(Equal(uint64(3)))
+
+		close(release)
+		Eventually(func() uint64 {
+			_, _ = cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "dst2101a")
+			return cachingBlaiseRestApi.Stats().Hits
+		}).Should(Equal(uint64(1)))
+	})
+
+	It("keeps serving stale settings when the REST API cannot be reached", func() {
+		mockRestApi.On("GetInstrumentSettings", mock.Anything, "dst2101a").Once().Return(settings, nil)
+		mockRestApi.On("GetInstrumentSettings", mock.Anything, "dst2101a").Return(nil, fmt.Errorf("connection refused"))
+
+		_, _ = cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "dst2101a")
+		now = now.Add(30 * time.Minute)
+
+		instrumentSettings, err := cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "dst2101a")
+		Expect(err).To(BeNil())
+		Expect(instrumentSettings).To(Equal(settings))
+		Eventually(func() uint64 { return cachingBlaiseRestApi.Stats().Errors }).Should(Equal(uint64(1)))
+
+		instrumentSettings, err = cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "dst2101a")
+		Expect(err).To(BeNil())
+		Expect(instrumentSettings).To(Equal(settings))
+		Expect(cachingBlaiseRestApi.Stats().Stale).To(Equal(uint64(2)))
+	})
+
+	It("stops serving stale settings after the stale TTL", func() {
+		mockRestApi.On("GetInstrumentSettings", mock.Anything, "dst2101a").Once().Return(settings, nil)
+		mockRestApi.On("GetInstrumentSettings", mock.Anything, "dst2101a").Return(nil, fmt.Errorf("connection refused"))
+
+		_, _ = cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "dst2101a")
+		now = now.Add(2 * time.Hour)
+
+		_, err := cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "dst2101a")
+		Expect(err).To(MatchError("connection refused"))
+	})
+
+	It("forgets instruments that are no longer installed", func() {
+		mockRestApi.On("GetInstrumentSettings", mock.Anything, "dst2101a").Once().Return(settings, nil)
+		mockRestApi.On("GetInstrumentSettings", mock.Anything, "dst2101a").Return(nil, blaiserestapi.InstrumentNotFoundError)
+
+		_, _ = cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "dst2101a")
+		now = now.Add(10 * time.Minute)
+
+		_, _ = cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "dst2101a")
+		Eventually(func() int { return cachingBlaiseRestApi.Stats().Entries }).Should(Equal(0))
+
+		_, err := cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "dst2101a")
+		Expect(err).To(Equal(blaiserestapi.InstrumentNotFoundError))
+	})
+
+	It("evicts the instrument fetched longest ago when it is full", func() {
+		cachingBlaiseRestApi.MaxEntries = 2
+		mockRestApi.On("GetInstrumentSettings", mock.Anything, mock.Anything).Return(settings, nil)
+
+		for _, instrumentName := range []string{"dst2101a", "lms2101a", "opn2101a"} {
+			_, _ = cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), instrumentName)
+			now = now.Add(time.Second)
+		}
+		Expect(cachingBlaiseRestApi.Stats().Entries).To(Equal(2))
+		Expect(cachingBlaiseRestApi.Stats().Evicted).To(Equal(uint64(1)))
+
+		_, _ = cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "lms2101a")
+		_, _ = cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "dst2101a")
+		mockRestApi.AssertNumberOfCalls(GinkgoT(), "GetInstrumentSettings", 4)
+	})
+
+	It("fetches invalidated instruments again", func() {
+		mockRestApi.On("GetInstrumentSettings", mock.Anything, mock.Anything).Return(settings, nil)
+
+		_, _ = cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "dst2101a")
+		_, _ = cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "lms2101a")
+		cachingBlaiseRestApi.Invalidate("DST2101A")
+		_, _ = cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "dst2101a")
+		_, _ = cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "lms2101a")
+
+		mockRestApi.AssertNumberOfCalls(GinkgoT(), "GetInstrumentSettings", 3)
+	})
+
+	It("shares one call between concurrent misses", func() {
+		release := make(chan struct{})
+		mockRestApi.On("GetInstrumentSettings", mock.Anything, "dst2101a").Return(func(context.Context, string) blaiserestapi.InstrumentSettings {
+			<-release
+			return settings
+		}, nil)
+
+		var waitGroup sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			waitGroup.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer waitGroup.Done()
+				Expect(cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "dst2101a")).To(Equal(settings))
+			}()
+		}
+		Eventually(func() uint64 { return cachingBlaiseRestApi.Stats().Coalesced }).Should(Equal(uint64(4)))
+		close(release)
+		waitGroup.Wait()
+
+		mockRestApi.AssertNumberOfCalls(GinkgoT(), "GetInstrumentSettings", 1)
+	})
+
+	It("stops waiting when the caller goes away without cancelling the shared call", func() {
+		release := make(chan struct{})
+		sharedCallCancelled := make(chan error, 1)
+		mockRestApi.On("GetInstrumentSettings", mock.Anything, "dst2101a").Return(func(ctx context.Context, _ string) blaiserestapi.InstrumentSettings {
+			<-release
+			sharedCallCancelled <- ctx.Err()
+			return settings
+		}, nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := cachingBlaiseRestApi.GetInstrumentSettings(ctx, "dst2101a")
+		Expect(err).To(Equal(context.Canceled))
+
+		close(release)
+		Eventually(sharedCallCancelled).Should(Receive(BeNil()))
+		Eventually(func() int { return cachingBlaiseRestApi.Stats().Entries }).Should(Equal(1))
+	})
+
+	Describe("questionnaire statuses and survey days", func() {
+		It("caches them for the status TTL, then refreshes them in the background", func() {
+			var fetches atomic.Int32
+			mockRestApi.On("GetQuestionnaireStatus", mock.Anything, "dst2101a").Once().Return(blaiserestapi.QuestionnaireStatus("Active"), nil)
+			mockRestApi.On("GetQuestionnaireStatus", mock.Anything, "dst2101a").Run(func(mock.Arguments) { fetches.Add(1) }).Return(blaiserestapi.QuestionnaireStatus("Inactive"), nil)
+
+			Expect(cachingBlaiseRestApi.GetQuestionnaireStatus(context.Background(), "dst2101a")).To(Equal(blaiserestapi.QuestionnaireStatus("Active")))
+			now = now.Add(20 * time.Second)
+			Expect(cachingBlaiseRestApi.GetQuestionnaireStatus(context.Background(), "DST2101A")).To(Equal(blaiserestapi.QuestionnaireStatus("Active")))
+			mockRestApi.AssertNumberOfCalls(GinkgoT(), "GetQuestionnaireStatus", 1)
+
+			now = now.Add(20 * time.Second)
+			Expect(cachingBlaiseRestApi.GetQuestionnaireStatus(context.Background(), "dst2101a")).To(Equal(blaiserestapi.QuestionnaireStatus("Active")))
+			Eventually(fetches.Load).Should(Equal(int32(1)))
+			Eventually(func() uint64 { return cachingBlaiseRestApi.Stats().Hits }).Should(Equal(uint64(1)))
+			Eventually(func() (blaiserestapi.QuestionnaireStatus, error) {
+				return cachingBlaiseRestApi.GetQuestionnaireStatus(context.Background(), "dst2101a")
+			}).Should(Equal(blaiserestapi.QuestionnaireStatus("Inactive")))
+		})
+
+		It("keeps serving stale survey days when the REST API cannot be reached", func() {
+			surveyDays := blaiserestapi.SurveyDays{now}
+			mockRestApi.On("GetSurveyDays", mock.Anything, "dst2101a").Once().Return(surveyDays, nil)
+			var fetches atomic.Int32
+			mockRestApi.On("GetSurveyDays", mock.Anything, "dst2101a").Run(func(mock.Arguments) { fetches.Add(1) }).Return(nil, fmt.Errorf("unreachable"))
+
+			Expect(cachingBlaiseRestApi.GetSurveyDays(context.Background(), "dst2101a")).To(Equal(surveyDays))
+			now = now.Add(time.Minute)
+			Expect(cachingBlaiseRestApi.GetSurveyDays(context.Background(), "dst2101a")).To(Equal(surveyDays))
+			Eventually(fetches.Load).Should(Equal(int32(1)))
+			Eventually(func() uint64 { return cachingBlaiseRestApi.Stats().Errors }).Should(Equal(uint64(1)))
+			Expect(cachingBlaiseRestApi.GetSurveyDays(context.Background(), "dst2101a")).To(Equal(surveyDays))
+		})
+
+		It("caches them apart from the instrument's settings, and invalidates them with them", func() {
+			mockRestApi.On("GetInstrumentSettings", mock.Anything, "dst2101a").Return(settings, nil)
+			mockRestApi.On("GetQuestionnaireStatus", mock.Anything, "dst2101a").Return(blaiserestapi.QuestionnaireStatus("Active"), nil)
+
+			Expect(cachingBlaiseRestApi.GetInstrumentSettings(context.Background(), "dst2101a")).To(Equal(settings))
+			Expect(cachingBlaiseRestApi.GetQuestionnaireStatus(context.Background(), "dst2101a")).To(Equal(blaiserestapi.QuestionnaireStatus("Active")))
+			Expect(cachingBlaiseRestApi.Stats().Entries).To(Equal(2))
+
+			cachingBlaiseRestApi.Invalidate("DST2101A")
+			Expect(cachingBlaiseRestApi.Stats().Entries).To(Equal(0))
+		})
+
+		It("does not cache them when the status TTL is 0", func() {
+			cachingBlaiseRestApi.StatusTTL = 0
+			mockRestApi.On("GetQuestionnaireStatus", mock.Anything, "dst2101a").Return(blaiserestapi.QuestionnaireStatus("Active"), nil)
+			mockRestApi.On("GetSurveyDays", mock.Anything, "dst2101a").Return(blaiserestapi.SurveyDays{now}, nil)
+
+			for i := 0; i < 2; i++ {
+				Expect(cachingBlaiseRestApi.GetQuestionnaireStatus(context.Background(), "dst2101a")).To(Equal(blaiserestapi.QuestionnaireStatus("Active")))
+				Expect(cachingBlaiseRestApi.GetSurveyDays(context.Background(), "dst2101a")).To(Equal(blaiserestapi.SurveyDays{now}))
+			}
+			mockRestApi.AssertNumberOfCalls(GinkgoT(), "GetQuestionnaireStatus", 2)
+			mockRestApi.AssertNumberOfCalls(GinkgoT(), "GetSurveyDays", 2)
+			Expect(cachingBlaiseRestApi.Stats().Entries).To(Equal(0))
+		})
+	})
+})
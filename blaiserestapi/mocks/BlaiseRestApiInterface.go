@@ -3,6 +3,8 @@
 package mocks
 
 import (
+	context "context"
+
 	blaiserestapi "github.com/ONSdigital/blaise-cawi-portal/blaiserestapi"
 	mock "github.com/stretchr/testify/mock"
 )
@@ -12,13 +14,13 @@ type BlaiseRestApiInterface struct {
 	mock.Mock
 }
 
-// GetInstrumentSettings provides a mock function with given fields: _a0
-func (_m *BlaiseRestApiInterface) GetInstrumentSettings(_a0 string) (blaiserestapi.InstrumentSettings, error) {
-	ret := _m.Called(_a0)
+// GetInstrumentSettings provides a mock function with given fields: _a0, _a1
+func (_m *BlaiseRestApiInterface) GetInstrumentSettings(_a0 context.Context, _a1 string) (blaiserestapi.InstrumentSettings, error) {
+	ret := _m.Called(_a0, _a1)
 
 	var r0 blaiserestapi.InstrumentSettings
-	if rf, ok := ret.Get(0).(func(string) blaiserestapi.InstrumentSettings); ok {
-		r0 = rf(_a0)
+	if rf, ok := ret.Get(0).(func(context.Context, string) blaiserestapi.InstrumentSettings); ok {
+		r0 = rf(_a0, _a1)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(blaiserestapi.InstrumentSettings)
@@ -26,8 +28,52 @@ func (_m *BlaiseRestApiInterface) GetInstrumentSettings(_a0 string) (blaiseresta
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(_a0)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetQuestionnaireStatus provides a mock function with given fields: _a0, _a1
+func (_m *BlaiseRestApiInterface) GetQuestionnaireStatus(_a0 context.Context, _a1 string) (blaiserestapi.QuestionnaireStatus, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 blaiserestapi.QuestionnaireStatus
+	if rf, ok := ret.Get(0).(func(context.Context, string) blaiserestapi.QuestionnaireStatus); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Get(0).(blaiserestapi.QuestionnaireStatus)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSurveyDays provides a mock function with given fields: _a0, _a1
+func (_m *BlaiseRestApiInterface) GetSurveyDays(_a0 context.Context, _a1 string) (blaiserestapi.SurveyDays, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 blaiserestapi.SurveyDays
+	if rf, ok := ret.Get(0).(func(context.Context, string) blaiserestapi.SurveyDays); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(blaiserestapi.SurveyDays)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(_a0, _a1)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -1,17 +1,25 @@
 package blaiserestapi
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/ONSdigital/blaise-cawi-portal/tracing"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"io"
 	"net/http"
+	"time"
 )
 
 //Generate mocks by running "go generate ./..."
 //go:generate mockery --name BlaiseRestApiInterface
 type BlaiseRestApiInterface interface {
-	GetInstrumentSettings(string) (InstrumentSettings, error)
+	GetInstrumentSettings(context.Context, string) (InstrumentSettings, error)
+	GetQuestionnaireStatus(context.Context, string) (QuestionnaireStatus, error)
+	GetSurveyDays(context.Context, string) (SurveyDays, error)
 }
 
 type InstrumentSettingsType struct {
@@ -38,14 +46,77 @@ func (instrumentSettings InstrumentSettings) StrictInterviewing() InstrumentSett
 	return InstrumentSettingsType{}
 }
 
+// QuestionnaireStatus is the state of an installed questionnaire, only
+// Active questionnaires can be interviewed on
+type QuestionnaireStatus string
+
+const (
+	QuestionnaireActive     QuestionnaireStatus = "Active"
+	QuestionnaireInactive   QuestionnaireStatus = "Inactive"
+	QuestionnaireErroneous  QuestionnaireStatus = "Erroneous"
+	QuestionnaireInstalling QuestionnaireStatus = "Installing"
+)
+
+func (questionnaireStatus QuestionnaireStatus) Live() bool {
+	return questionnaireStatus == QuestionnaireActive
+}
+
+// SurveyDays are the days a questionnaire is scheduled to be interviewed on
+type SurveyDays []time.Time
+
+func (surveyDays *SurveyDays) UnmarshalJSON(data []byte) error {
+	var days []string
+	if err := json.Unmarshal(data, &days); err != nil {
+		return err
+	}
+	parsed := make(SurveyDays, 0, len(days))
+	for _, day := range days {
+		surveyDay, err := time.Parse("2006-01-02T15:04:05", day)
+		if err != nil {
+			surveyDay, err = time.Parse(time.RFC3339, day)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid survey day %q", day)
+		}
+		parsed = append(parsed, surveyDay)
+	}
+	*surveyDays = parsed
+	return nil
+}
+
+// Includes reports whether now falls on one of the survey days, comparing
+// dates in now's location
+func (surveyDays SurveyDays) Includes(now time.Time) bool {
+	year, month, day := now.Date()
+	for _, surveyDay := range surveyDays {
+		surveyYear, surveyMonth, surveyDayOfMonth := surveyDay.Date()
+		if surveyYear == year && surveyMonth == month && surveyDayOfMonth == day {
+			return true
+		}
+	}
+	return false
+}
+
 type BlaiseRestApi struct {
 	BaseUrl    string
 	Serverpark string
 	Client     *http.Client
 }
 
-func (blaiseRestApi *BlaiseRestApi) GetInstrumentSettings(instrumentName string) (InstrumentSettings, error) {
-	req, err := http.NewRequest("GET", blaiseRestApi.instrumentSettingsUrl(instrumentName), nil)
+func (blaiseRestApi *BlaiseRestApi) GetInstrumentSettings(ctx context.Context, instrumentName string) (InstrumentSettings, error) {
+	ctx, span := tracing.Start(ctx, "BlaiseRestApi.GetInstrumentSettings",
+		trace.WithAttributes(attribute.String("instrument.name", instrumentName)))
+	instrumentSettings, err := blaiseRestApi.getInstrumentSettings(ctx, instrumentName)
+	if errors.Is(err, InstrumentNotFoundError) {
+		tracing.End(span, nil)
+	} else {
+		tracing.End(span, err)
+	}
+	return instrumentSettings, err
+}
+
+func (blaiseRestApi *BlaiseRestApi) getInstrumentSettings(ctx context.Context, instrumentName string) (InstrumentSettings, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", blaiseRestApi.instrumentSettingsUrl(instrumentName), nil)
 	if err != nil {
 		log.Error("Failed to make new request to blaise rest api")
 		return nil, err
@@ -75,6 +146,53 @@ func (blaiseRestApi *BlaiseRestApi) GetInstrumentSettings(instrumentName string)
 	return instrumentSettings, nil
 }
 
+func (blaiseRestApi *BlaiseRestApi) GetQuestionnaireStatus(ctx context.Context, instrumentName string) (QuestionnaireStatus, error) {
+	var questionnaireStatus QuestionnaireStatus
+	err := blaiseRestApi.getJSON(ctx, fmt.Sprintf("%s/status", blaiseRestApi.questionnaireUrl(instrumentName)), &questionnaireStatus)
+	return questionnaireStatus, err
+}
+
+func (blaiseRestApi *BlaiseRestApi) GetSurveyDays(ctx context.Context, instrumentName string) (SurveyDays, error) {
+	var surveyDays SurveyDays
+	err := blaiseRestApi.getJSON(ctx, fmt.Sprintf("%s/surveydays", blaiseRestApi.questionnaireUrl(instrumentName)), &surveyDays)
+	return surveyDays, err
+}
+
+func (blaiseRestApi *BlaiseRestApi) getJSON(ctx context.Context, url string, value interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		log.Error("Failed to make new request to blaise rest api")
+		return err
+	}
+	req.Header.Add("Accept", "application/json")
+	resp, err := blaiseRestApi.Client.Do(req)
+	if err != nil {
+		log.Error(fmt.Sprintf("Failed to get %s", url))
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return InstrumentNotFoundError
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, value)
+}
+
+func (blaiseRestApi *BlaiseRestApi) questionnaireUrl(instrumentName string) string {
+	return fmt.Sprintf(
+		"%s/api/v2/serverparks/%s/questionnaires/%s",
+		blaiseRestApi.BaseUrl,
+		blaiseRestApi.Serverpark,
+		instrumentName,
+	)
+}
+
 func (blaiseRestApi *BlaiseRestApi) instrumentSettingsUrl(instrumentName string) string {
 	return fmt.Sprintf(
 		"%s/api/v2/serverparks/%s/questionnaires/%s/settings",
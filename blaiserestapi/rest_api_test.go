@@ -1,8 +1,10 @@
 package blaiserestapi_test
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/ONSdigital/blaise-cawi-portal/blaiserestapi"
 	"github.com/jarcoal/httpmock"
@@ -38,7 +40,7 @@ var _ = Describe("Blaise rest api endpoints", func() {
 			})
 
 			It("returns a NotFound error", func() {
-				instrumentSettings, err := blaiseRestApi.GetInstrumentSettings(instrumentName)
+				instrumentSettings, err := blaiseRestApi.GetInstrumentSettings(context.Background(), instrumentName)
 				Expect(err).To(MatchError("instrument not found"))
 				Expect(instrumentSettings).To(BeEmpty())
 			})
@@ -56,7 +58,7 @@ var _ = Describe("Blaise rest api endpoints", func() {
 			})
 
 			It("returns instrument settings", func() {
-				instrumentSettings, err := blaiseRestApi.GetInstrumentSettings(instrumentName)
+				instrumentSettings, err := blaiseRestApi.GetInstrumentSettings(context.Background(), instrumentName)
 				Expect(err).To(BeNil())
 				Expect(instrumentSettings).To(HaveLen(1))
 				Expect(instrumentSettings[0].Type).To(Equal("StrictInterviewing"))
@@ -64,6 +66,55 @@ var _ = Describe("Blaise rest api endpoints", func() {
 			})
 		})
 	})
+
+	Describe("Get questionnaire status", func() {
+		statusUrl := fmt.Sprintf("%s/api/v2/serverparks/%s/questionnaires/%s/status", restApiUrl, serverpark, instrumentName)
+
+		It("returns the status", func() {
+			httpmock.RegisterResponder("GET", statusUrl, httpmock.NewStringResponder(200, `"Inactive"`))
+
+			questionnaireStatus, err := blaiseRestApi.GetQuestionnaireStatus(context.Background(), instrumentName)
+			Expect(err).To(BeNil())
+			Expect(questionnaireStatus).To(Equal(blaiserestapi.QuestionnaireInactive))
+			Expect(questionnaireStatus.Live()).To(BeFalse())
+		})
+
+		It("returns instrument not found when the questionnaire is not installed", func() {
+			httpmock.RegisterResponder("GET", statusUrl, httpmock.NewBytesResponder(404, []byte{}))
+
+			_, err := blaiseRestApi.GetQuestionnaireStatus(context.Background(), instrumentName)
+			Expect(err).To(Equal(blaiserestapi.InstrumentNotFoundError))
+		})
+
+		It("errors on other statuses", func() {
+			httpmock.RegisterResponder("GET", statusUrl, httpmock.NewBytesResponder(500, []byte{}))
+
+			_, err := blaiseRestApi.GetQuestionnaireStatus(context.Background(), instrumentName)
+			Expect(err).To(MatchError(fmt.Sprintf("unexpected status 500 from %s", statusUrl)))
+		})
+	})
+
+	Describe("Get survey days", func() {
+		surveyDaysUrl := fmt.Sprintf("%s/api/v2/serverparks/%s/questionnaires/%s/surveydays", restApiUrl, serverpark, instrumentName)
+
+		It("returns the survey days", func() {
+			httpmock.RegisterResponder("GET", surveyDaysUrl,
+				httpmock.NewStringResponder(200, `["2021-01-04T00:00:00", "2021-01-05T00:00:00Z"]`))
+
+			surveyDays, err := blaiseRestApi.GetSurveyDays(context.Background(), instrumentName)
+			Expect(err).To(BeNil())
+			Expect(surveyDays).To(HaveLen(2))
+			Expect(surveyDays.Includes(time.Date(2021, 1, 5, 18, 0, 0, 0, time.UTC))).To(BeTrue())
+			Expect(surveyDays.Includes(time.Date(2021, 1, 6, 9, 0, 0, 0, time.UTC))).To(BeFalse())
+		})
+
+		It("errors on survey days it cannot read", func() {
+			httpmock.RegisterResponder("GET", surveyDaysUrl, httpmock.NewStringResponder(200, `["next tuesday"]`))
+
+			_, err := blaiseRestApi.GetSurveyDays(context.Background(), instrumentName)
+			Expect(err).To(MatchError(`invalid survey day "next tuesday"`))
+		})
+	})
 })
 
 var _ = Describe("InstrumentSettings.StrictInterviewing", func() {
@@ -2,16 +2,21 @@ package busapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
     "io"
 	"net/http"
+
+	"github.com/ONSdigital/blaise-cawi-portal/outbound"
+	"github.com/ONSdigital/blaise-cawi-portal/tracing"
 )
 
 //Generate mocks by running "go generate ./..."
 //go:generate mockery --name BusApiInterface
 type BusApiInterface interface {
-	GetUacInfo(string) (UacInfo, error)
+	GetUacInfo(context.Context, string) (UacInfo, error)
 }
 
 type BusApi struct {
@@ -23,17 +28,46 @@ type UACRequest struct {
 	UAC string `json:"uac"`
 }
 
-func (busApi *BusApi) GetUacInfo(uac string) (UacInfo, error) {
-	response, err := busApi.doGetUacInfo(uac)
+// GetUacInfo looks up an access code. It returns UacNotFoundError and
+// UacDisabledError for codes that cannot be used, and an UnavailableError or
+// MalformedResponseError when BUS is failing.
+func (busApi *BusApi) GetUacInfo(ctx context.Context, uac string) (UacInfo, error) {
+	ctx, span := tracing.Start(ctx, "BusApi.GetUacInfo")
+	uacInfo, err := busApi.getUacInfo(ctx, uac)
+	// An access code that cannot be used is not a failure of BUS
+	if errors.Is(err, UacNotFoundError) || errors.Is(err, UacDisabledError) {
+		tracing.End(span, nil)
+	} else {
+		tracing.End(span, err)
+	}
+	return uacInfo, err
+}
+
+func (busApi *BusApi) getUacInfo(ctx context.Context, uac string) (UacInfo, error) {
+	response, err := busApi.doGetUacInfo(ctx, uac)
 	if err != nil {
-		return UacInfo{}, err
+		return UacInfo{}, &UnavailableError{Err: err}
 	}
+	defer response.Body.Close()
 
 	if response.StatusCode == http.StatusNotFound {
-		return UacInfo{}, nil
+		return UacInfo{}, UacNotFoundError
+	}
+	if response.StatusCode != http.StatusOK {
+		return UacInfo{}, &UnavailableError{StatusCode: response.StatusCode}
 	}
 
-	return busApi.marshalUacResponse(response)
+	uacInfo, err := busApi.marshalUacResponse(response)
+	if err != nil {
+		return UacInfo{}, err
+	}
+	if uacInfo.Disabled {
+		return uacInfo, UacDisabledError
+	}
+	if uacInfo.InvalidCase() {
+		return uacInfo, UacNotFoundError
+	}
+	return uacInfo, nil
 }
 
 func (busApi *BusApi) getUACInfoUrl() (url string) {
@@ -42,14 +76,15 @@ func (busApi *BusApi) getUACInfoUrl() (url string) {
 	)
 }
 
-func (busApi *BusApi) doGetUacInfo(uac string) (*http.Response, error) {
+func (busApi *BusApi) doGetUacInfo(ctx context.Context, uac string) (*http.Response, error) {
 	uacRequest := UACRequest{UAC: uac}
 	uacJSON, err := json.Marshal(uacRequest)
 	if err != nil {
 		return nil, fmt.Errorf("unable to Marshal error")
 	}
 
-	request, err := http.NewRequest("POST", busApi.getUACInfoUrl(),
+	// Looking up an access code changes nothing, so is safe to retry
+	request, err := http.NewRequestWithContext(outbound.Idempotent(ctx), "POST", busApi.getUACInfoUrl(),
 		bytes.NewReader(uacJSON),
 	)
 
@@ -63,14 +98,14 @@ func (busApi *BusApi) doGetUacInfo(uac string) (*http.Response, error) {
 func (busApi *BusApi) marshalUacResponse(response *http.Response) (UacInfo, error) {
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
-		return UacInfo{}, fmt.Errorf("unable to read body")
+		return UacInfo{}, &UnavailableError{Err: err}
 	}
-	defer response.Body.Close()
 
 	var uacInfo UacInfo
 	err = json.Unmarshal(body, &uacInfo)
 	if err != nil {
-		return UacInfo{}, fmt.Errorf("unable To Unmarshal Json")
+		return UacInfo{}, &MalformedResponseError{Err: err}
 	}
+	uacInfo.normalise()
 	return uacInfo, nil
 }
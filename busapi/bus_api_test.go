@@ -1,6 +1,8 @@
 package busapi_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -8,6 +10,11 @@ import (
 	"github.com/jarcoal/httpmock"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 var _ = Describe("BUS API", func() {
@@ -36,25 +43,187 @@ var _ = Describe("BUS API", func() {
 			})
 
 			It("Returns UAC Info for a valid UAC", func() {
-				uacInfo, err := busApi.GetUacInfo(uac)
+				uacInfo, err := busApi.GetUacInfo(context.Background(), uac)
 				Expect(err).To(BeNil())
 				Expect(uacInfo.InstrumentName).To(Equal("foo"))
 				Expect(uacInfo.CaseID).To(Equal("bar"))
 			})
 		})
 
+		Context("when a uac covers a household", func() {
+			JustBeforeEach(func() {
+				httpmock.RegisterResponder("POST", fmt.Sprintf("%s/uacs/uac", baseUrl),
+					httpmock.NewStringResponder(200, `{"cases": [
+						{"instrument_name": "lms2101a", "case_id": "100001", "label": "Alex"},
+						{"instrument_name": "lms2101a", "case_id": "100002", "label": "Sam"}
+					]}`))
+			})
+
+			It("Returns every case", func() {
+				uacInfo, err := busApi.GetUacInfo(context.Background(), uac)
+				Expect(err).To(BeNil())
+				Expect(uacInfo.Household()).To(BeTrue())
+				Expect(uacInfo.Cases).To(Equal([]busapi.UacCase{
+					{InstrumentName: "lms2101a", CaseID: "100001", Label: "Alex"},
+					{InstrumentName: "lms2101a", CaseID: "100002", Label: "Sam"},
+				}))
+			})
+		})
+
+		Context("when a uac lists a single case", func() {
+			JustBeforeEach(func() {
+				httpmock.RegisterResponder("POST", fmt.Sprintf("%s/uacs/uac", baseUrl),
+					httpmock.NewStringResponder(200, `{"cases": [{"instrument_name": "foo", "case_id": "bar"}]}`))
+			})
+
+			It("Returns it like any other uac", func() {
+				uacInfo, err := busApi.GetUacInfo(context.Background(), uac)
+				Expect(err).To(BeNil())
+				Expect(uacInfo).To(Equal(busapi.UacInfo{InstrumentName: "foo", CaseID: "bar"}))
+			})
+		})
+
+		Context("when a household includes an unknown case", func() {
+			JustBeforeEach(func() {
+				httpmock.RegisterResponder("POST", fmt.Sprintf("%s/uacs/uac", baseUrl),
+					httpmock.NewStringResponder(200, `{"cases": [
+						{"instrument_name": "lms2101a", "case_id": "100001"},
+						{"instrument_name": "lms2101a", "case_id": "unknown"}
+					]}`))
+			})
+
+			It("Returns a not found error", func() {
+				_, err := busApi.GetUacInfo(context.Background(), uac)
+				Expect(err).To(Equal(busapi.UacNotFoundError))
+			})
+		})
+
+		Context("when the request is cancelled", func() {
+			JustBeforeEach(func() {
+				httpmock.RegisterResponder("POST", fmt.Sprintf("%s/uacs/uac", baseUrl),
+					func(request *http.Request) (*http.Response, error) {
+						return nil, request.Context().Err()
+					})
+			})
+
+			It("passes the cancellation on to BUS", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				_, err := busApi.GetUacInfo(ctx, uac)
+				Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+			})
+		})
+
 		Context("bad response is returned", func() {
 			JustBeforeEach(func() {
 				httpmock.RegisterResponder("POST", fmt.Sprintf("%s/uacs/uac", baseUrl),
 					httpmock.NewJsonResponderOrPanic(500, "nil"))
 			})
 
-			It("Returns a an error and an empty uac info struct", func() {
-				uacInfo, err := busApi.GetUacInfo(uac)
-				Expect(err).To(MatchError("unable To Unmarshal Json"))
+			It("Returns an unavailable error and an empty uac info struct", func() {
+				uacInfo, err := busApi.GetUacInfo(context.Background(), uac)
+				Expect(err).To(Equal(&busapi.UnavailableError{StatusCode: 500}))
 				Expect(uacInfo.InstrumentName).To(Equal(""))
 				Expect(uacInfo.CaseID).To(Equal(""))
 			})
 		})
+
+		Context("when the uac is not found", func() {
+			JustBeforeEach(func() {
+				httpmock.RegisterResponder("POST", fmt.Sprintf("%s/uacs/uac", baseUrl),
+					httpmock.NewStringResponder(404, ""))
+			})
+
+			It("Returns a not found error", func() {
+				_, err := busApi.GetUacInfo(context.Background(), uac)
+				Expect(err).To(Equal(busapi.UacNotFoundError))
+			})
+		})
+
+		Context("when the uac is for an unknown case", func() {
+			JustBeforeEach(func() {
+				httpmock.RegisterResponder("POST", fmt.Sprintf("%s/uacs/uac", baseUrl),
+					httpmock.NewJsonResponderOrPanic(200, busapi.UacInfo{InstrumentName: "unknown", CaseID: "unknown"}))
+			})
+
+			It("Returns a not found error", func() {
+				_, err := busApi.GetUacInfo(context.Background(), uac)
+				Expect(err).To(Equal(busapi.UacNotFoundError))
+			})
+		})
+
+		Context("when the uac is disabled", func() {
+			JustBeforeEach(func() {
+				httpmock.RegisterResponder("POST", fmt.Sprintf("%s/uacs/uac", baseUrl),
+					httpmock.NewJsonResponderOrPanic(200, busapi.UacInfo{InstrumentName: "foo", CaseID: "bar", Disabled: true}))
+			})
+
+			It("Returns a disabled error with the uac info", func() {
+				uacInfo, err := busApi.GetUacInfo(context.Background(), uac)
+				Expect(err).To(Equal(busapi.UacDisabledError))
+				Expect(uacInfo.InstrumentName).To(Equal("foo"))
+				Expect(uacInfo.CaseID).To(Equal("bar"))
+			})
+		})
+
+		Context("when BUS responds with something other than uac info", func() {
+			JustBeforeEach(func() {
+				httpmock.RegisterResponder("POST", fmt.Sprintf("%s/uacs/uac", baseUrl),
+					httpmock.NewStringResponder(200, "<html>Bad gateway</html>"))
+			})
+
+			It("Returns a malformed response error", func() {
+				_, err := busApi.GetUacInfo(context.Background(), uac)
+				var malformedResponseError *busapi.MalformedResponseError
+				Expect(errors.As(err, &malformedResponseError)).To(BeTrue())
+			})
+		})
+
+		Context("when BUS cannot be reached", func() {
+			JustBeforeEach(func() {
+				httpmock.RegisterResponder("POST", fmt.Sprintf("%s/uacs/uac", baseUrl),
+					httpmock.NewErrorResponder(fmt.Errorf("connection refused")))
+			})
+
+			It("Returns an unavailable error", func() {
+				_, err := busApi.GetUacInfo(context.Background(), uac)
+				var unavailableError *busapi.UnavailableError
+				Expect(errors.As(err, &unavailableError)).To(BeTrue())
+				Expect(unavailableError.StatusCode).To(Equal(0))
+				Expect(err).To(MatchError(ContainSubstring("connection refused")))
+			})
+		})
+
+		Context("when traced", func() {
+			var recorder *tracetest.SpanRecorder
+
+			BeforeEach(func() {
+				recorder = tracetest.NewSpanRecorder()
+				otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+			})
+
+			AfterEach(func() {
+				otel.SetTracerProvider(noop.NewTracerProvider())
+			})
+
+			It("does not fail the span for an access code that cannot be used", func() {
+				httpmock.RegisterResponder("POST", fmt.Sprintf("%s/uacs/uac", baseUrl),
+					httpmock.NewStringResponder(404, ""))
+
+				_, _ = busApi.GetUacInfo(context.Background(), uac)
+				Expect(recorder.Ended()).To(HaveLen(1))
+				Expect(recorder.Ended()[0].Name()).To(Equal("BusApi.GetUacInfo"))
+				Expect(recorder.Ended()[0].Status().Code).To(Equal(codes.Unset))
+			})
+
+			It("fails the span when BUS is unavailable", func() {
+				httpmock.RegisterResponder("POST", fmt.Sprintf("%s/uacs/uac", baseUrl),
+					httpmock.NewStringResponder(503, ""))
+
+				_, _ = busApi.GetUacInfo(context.Background(), uac)
+				Expect(recorder.Ended()[0].Status().Code).To(Equal(codes.Error))
+			})
+		})
 	})
 })
@@ -0,0 +1,45 @@
+package busapi
+
+import (
+	"errors"
+	"fmt"
+)
+
+// UacNotFoundError is returned when BUS does not recognise the access code
+var UacNotFoundError = errors.New("uac not found")
+
+// UacDisabledError is returned when the access code exists but can no longer
+// be used, along with its UacInfo
+var UacDisabledError = errors.New("uac disabled")
+
+// UnavailableError is returned when BUS cannot be reached or fails to handle
+// the request. StatusCode is 0 when no response was received.
+type UnavailableError struct {
+	StatusCode int
+	Err        error
+}
+
+func (unavailableError *UnavailableError) Error() string {
+	if unavailableError.StatusCode != 0 {
+		return fmt.Sprintf("bus unavailable: unexpected status %d", unavailableError.StatusCode)
+	}
+	return fmt.Sprintf("bus unavailable: %s", unavailableError.Err)
+}
+
+func (unavailableError *UnavailableError) Unwrap() error {
+	return unavailableError.Err
+}
+
+// MalformedResponseError is returned when BUS responds with something that
+// is not UAC info
+type MalformedResponseError struct {
+	Err error
+}
+
+func (malformedResponseError *MalformedResponseError) Error() string {
+	return fmt.Sprintf("malformed bus response: %s", malformedResponseError.Err)
+}
+
+func (malformedResponseError *MalformedResponseError) Unwrap() error {
+	return malformedResponseError.Err
+}
@@ -3,6 +3,8 @@
 package mocks
 
 import (
+	context "context"
+
 	busapi "github.com/ONSdigital/blaise-cawi-portal/busapi"
 	mock "github.com/stretchr/testify/mock"
 )
@@ -12,20 +14,20 @@ type BusApiInterface struct {
 	mock.Mock
 }
 
-// GetUacInfo provides a mock function with given fields: _a0
-func (_m *BusApiInterface) GetUacInfo(_a0 string) (busapi.UacInfo, error) {
-	ret := _m.Called(_a0)
+// GetUacInfo provides a mock function with given fields: _a0, _a1
+func (_m *BusApiInterface) GetUacInfo(_a0 context.Context, _a1 string) (busapi.UacInfo, error) {
+	ret := _m.Called(_a0, _a1)
 
 	var r0 busapi.UacInfo
-	if rf, ok := ret.Get(0).(func(string) busapi.UacInfo); ok {
-		r0 = rf(_a0)
+	if rf, ok := ret.Get(0).(func(context.Context, string) busapi.UacInfo); ok {
+		r0 = rf(_a0, _a1)
 	} else {
 		r0 = ret.Get(0).(busapi.UacInfo)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(_a0)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(_a0, _a1)
 	} else {
 		r1 = ret.Error(1)
 	}
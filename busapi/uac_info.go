@@ -1,12 +1,75 @@
 package busapi
 
+import "strings"
+
 type UacInfo struct {
 	InstrumentName string `json:"instrument_name"`
 	CaseID         string `json:"case_id"`
 	Disabled       bool   `json:"disabled"`
+	// Every case a household access code covers. Access codes for one case
+	// leave it empty and only set InstrumentName and CaseID.
+	Cases []UacCase `json:"cases,omitempty"`
+}
+
+// UacCase is one of the cases a household access code covers. Label is what
+// the respondent sees when choosing between them, e.g. a household member's
+// name, and can be left out.
+type UacCase struct {
+	InstrumentName string `json:"instrument_name"`
+	CaseID         string `json:"case_id"`
+	Label          string `json:"label,omitempty"`
+}
+
+func (uacCase UacCase) invalid() bool {
+	return uacCase.InstrumentName == "" || uacCase.CaseID == "" ||
+		uacCase.InstrumentName == "unknown" || uacCase.CaseID == "unknown"
 }
 
 func (uacInfo *UacInfo) InvalidCase() bool {
-	return uacInfo.InstrumentName == "" || uacInfo.CaseID == "" ||
-		uacInfo.InstrumentName == "unknown" || uacInfo.CaseID == "unknown" || uacInfo.Disabled
+	if uacInfo.Disabled {
+		return true
+	}
+	for _, uacCase := range uacInfo.AllCases() {
+		if uacCase.invalid() {
+			return true
+		}
+	}
+	return false
+}
+
+// AllCases returns the cases the access code covers, which is just
+// InstrumentName and CaseID unless it is for a household
+func (uacInfo *UacInfo) AllCases() []UacCase {
+	if len(uacInfo.Cases) > 0 {
+		return uacInfo.Cases
+	}
+	return []UacCase{{InstrumentName: uacInfo.InstrumentName, CaseID: uacInfo.CaseID}}
+}
+
+// Household reports whether the access code covers more than one case, so
+// the respondent has to choose which to open
+func (uacInfo *UacInfo) Household() bool {
+	return len(uacInfo.Cases) > 1
+}
+
+// HasCase reports whether the access code covers the case of the instrument
+func (uacInfo *UacInfo) HasCase(instrumentName, caseID string) bool {
+	for _, uacCase := range uacInfo.AllCases() {
+		if strings.EqualFold(uacCase.InstrumentName, instrumentName) && strings.EqualFold(uacCase.CaseID, caseID) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalise treats a household of one case like any other access code
+func (uacInfo *UacInfo) normalise() {
+	if len(uacInfo.Cases) != 1 {
+		return
+	}
+	if uacInfo.InstrumentName == "" && uacInfo.CaseID == "" {
+		uacInfo.InstrumentName = uacInfo.Cases[0].InstrumentName
+		uacInfo.CaseID = uacInfo.Cases[0].CaseID
+	}
+	uacInfo.Cases = nil
 }
@@ -2,6 +2,7 @@ package busapi_test
 
 import (
 	"github.com/ONSdigital/blaise-cawi-portal/busapi"
+	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 )
@@ -20,3 +21,44 @@ var _ = DescribeTable("InvalidCase",
 	Entry("Unknown instrumentName", "unknown", "caseFoo", true),
 	Entry("Valid", "instrumentFoo", "caseFoo", false),
 )
+
+var _ = DescribeTable("InvalidCase for a household",
+	func(cases []busapi.UacCase, expected bool) {
+		uacInfo := busapi.UacInfo{Cases: cases}
+		Expect(uacInfo.InvalidCase()).To(Equal(expected))
+	},
+	Entry("Valid", []busapi.UacCase{{InstrumentName: "instrumentFoo", CaseID: "caseFoo"}, {InstrumentName: "instrumentFoo", CaseID: "caseBar"}}, false),
+	Entry("One without a caseID", []busapi.UacCase{{InstrumentName: "instrumentFoo", CaseID: "caseFoo"}, {InstrumentName: "instrumentFoo"}}, true),
+	Entry("One unknown instrumentName", []busapi.UacCase{{InstrumentName: "unknown", CaseID: "caseFoo"}, {InstrumentName: "instrumentFoo", CaseID: "caseBar"}}, true),
+)
+
+var _ = Describe("Household cases", func() {
+	var (
+		single    = busapi.UacInfo{InstrumentName: "instrumentFoo", CaseID: "caseFoo"}
+		household = busapi.UacInfo{Cases: []busapi.UacCase{
+			{InstrumentName: "instrumentFoo", CaseID: "caseFoo"},
+			{InstrumentName: "instrumentBar", CaseID: "caseBar"},
+		}}
+	)
+
+	It("treats an access code for one case as a household of one", func() {
+		Expect(single.Household()).To(BeFalse())
+		Expect(single.AllCases()).To(Equal([]busapi.UacCase{{InstrumentName: "instrumentFoo", CaseID: "caseFoo"}}))
+	})
+
+	It("lists every case of a household", func() {
+		Expect(household.Household()).To(BeTrue())
+		Expect(household.AllCases()).To(Equal(household.Cases))
+	})
+
+	DescribeTable("HasCase",
+		func(uacInfo busapi.UacInfo, instrumentName, caseID string, expected bool) {
+			Expect(uacInfo.HasCase(instrumentName, caseID)).To(Equal(expected))
+		},
+		Entry("the case", single, "instrumentFoo", "caseFoo", true),
+		Entry("the case in a different case", single, "INSTRUMENTFOO", "CASEFOO", true),
+		Entry("another case", single, "instrumentFoo", "caseBar", false),
+		Entry("a household case", household, "instrumentBar", "caseBar", true),
+		Entry("a household case of another instrument", household, "instrumentFoo", "caseBar", false),
+	)
+})
@@ -0,0 +1,109 @@
+package cspreport
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Aggregator counts violations and logs each distinct one once per Interval
+// with how often it happened, rather than once per report. Counts are logged
+// every Interval while Run is running, when a violation is recorded after the
+// interval has passed, and by Flush.
+//
+// At most MaxViolations distinct violations are counted in an interval, so
+// that a flood of different reports cannot use up memory, any others are
+// only counted as dropped.
+type Aggregator struct {
+	Logger        *zap.Logger
+	Interval      time.Duration
+	MaxViolations int
+	Clock         func() time.Time
+
+	mutex   sync.Mutex
+	since   time.Time
+	counts  map[Violation]int
+	dropped int
+}
+
+// Record counts violation, logging the counts so far when the interval has passed
+func (aggregator *Aggregator) Record(violation Violation) {
+	aggregator.mutex.Lock()
+	defer aggregator.mutex.Unlock()
+
+	now := aggregator.now()
+	if aggregator.counts == nil {
+		aggregator.reset(now)
+	} else if now.Sub(aggregator.since) >= aggregator.Interval {
+		aggregator.flush(now)
+	}
+
+	if _, counted := aggregator.counts[violation]; !counted && len(aggregator.counts) >= aggregator.MaxViolations {
+		aggregator.dropped++
+		return
+	}
+	aggregator.counts[violation]++
+}
+
+// Run logs the counts every Interval until ctx is done, so that a violation
+// is logged even when no other is reported after it
+func (aggregator *Aggregator) Run(ctx context.Context) {
+	if aggregator.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(aggregator.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			aggregator.Flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Flush logs the violations counted since the last time they were logged
+func (aggregator *Aggregator) Flush() {
+	aggregator.mutex.Lock()
+	defer aggregator.mutex.Unlock()
+
+	aggregator.flush(aggregator.now())
+}
+
+func (aggregator *Aggregator) flush(now time.Time) {
+	for violation, count := range aggregator.counts {
+		aggregator.Logger.Warn("CSP violations",
+			zap.String("Directive", violation.Directive),
+			zap.String("BlockedURI", violation.BlockedURI),
+			zap.String("DocumentPath", violation.DocumentPath),
+			zap.String("SourceFile", violation.SourceFile),
+			zap.String("Disposition", violation.Disposition),
+			zap.Int("Count", count),
+			zap.Time("Since", aggregator.since),
+		)
+	}
+	if aggregator.dropped > 0 {
+		aggregator.Logger.Warn("CSP violations not aggregated",
+			zap.Int("Count", aggregator.dropped),
+			zap.Int("MaxViolations", aggregator.MaxViolations),
+			zap.Time("Since", aggregator.since),
+		)
+	}
+	aggregator.reset(now)
+}
+
+func (aggregator *Aggregator) reset(now time.Time) {
+	aggregator.since = now
+	aggregator.counts = map[Violation]int{}
+	aggregator.dropped = 0
+}
+
+func (aggregator *Aggregator) now() time.Time {
+	if aggregator.Clock != nil {
+		return aggregator.Clock().UTC()
+	}
+	return time.Now().UTC()
+}
@@ -0,0 +1,137 @@
+package cspreport
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"strings"
+)
+
+// Violation is the part of a Content-Security-Policy violation report that is
+// aggregated. URLs are cut down to their origin or path, so that query
+// strings carrying respondents' details are not logged and there are few
+// distinct violations to count.
+type Violation struct {
+	Directive    string
+	BlockedURI   string
+	DocumentPath string
+	SourceFile   string
+	Disposition  string
+}
+
+// reportURIBody is sent by browsers to a policy's report-uri
+type reportURIBody struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		BlockedURI         string `json:"blocked-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		SourceFile         string `json:"source-file"`
+		Disposition        string `json:"disposition"`
+	} `json:"csp-report"`
+}
+
+// reportToBody is sent by browsers to a policy's report-to endpoint, which
+// can batch several reports of different types
+type reportToBody []struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		BlockedURL         string `json:"blockedURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		SourceFile         string `json:"sourceFile"`
+		Disposition        string `json:"disposition"`
+	} `json:"body"`
+}
+
+// Parse reads the violations from a report sent to either report-uri, as
+// application/csp-report, or report-to, as application/reports+json
+func Parse(contentType string, body []byte) ([]Violation, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/reports+json":
+		var reports reportToBody
+		if err := json.Unmarshal(body, &reports); err != nil {
+			return nil, err
+		}
+		var violations []Violation
+		for _, report := range reports {
+			if report.Type != "csp-violation" {
+				continue
+			}
+			violations = append(violations, newViolation(report.Body.EffectiveDirective, report.Body.BlockedURL,
+				report.Body.DocumentURL, report.Body.SourceFile, report.Body.Disposition))
+		}
+		return violations, nil
+	case "application/csp-report", "application/json":
+		var report reportURIBody
+		if err := json.Unmarshal(body, &report); err != nil {
+			return nil, err
+		}
+		directive := report.Report.EffectiveDirective
+		if directive == "" {
+			directive = report.Report.ViolatedDirective
+		}
+		return []Violation{newViolation(directive, report.Report.BlockedURI,
+			report.Report.DocumentURI, report.Report.SourceFile, report.Report.Disposition)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported report content type %q", contentType)
+	}
+}
+
+func newViolation(directive, blockedURI, documentURI, sourceFile, disposition string) Violation {
+	// Older browsers report the whole directive, e.g. "script-src 'self'"
+	directive, _, _ = strings.Cut(strings.TrimSpace(directive), " ")
+	if disposition == "" {
+		disposition = "enforce"
+	}
+	return Violation{
+		Directive:    truncate(directive),
+		BlockedURI:   truncate(origin(blockedURI)),
+		DocumentPath: truncate(documentPath(documentURI)),
+		SourceFile:   truncate(withoutQuery(sourceFile)),
+		Disposition:  truncate(disposition),
+	}
+}
+
+// origin reduces a blocked URL to where it was loaded from. Keywords such as
+// "inline" and "eval" are kept as they are.
+func origin(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Host == "" {
+		if scheme, _, found := strings.Cut(uri, ":"); found {
+			return scheme
+		}
+		return uri
+	}
+	return fmt.Sprintf("%s://%s", parsed.Scheme, parsed.Host)
+}
+
+// withoutQuery drops the query, fragment and any credentials from a URL
+func withoutQuery(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+	parsed.User = nil
+	return parsed.String()
+}
+
+func documentPath(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	return parsed.EscapedPath()
+}
+
+func truncate(value string) string {
+	const maxLength = 200
+	if len(value) > maxLength {
+		return value[:maxLength]
+	}
+	return value
+}
@@ -0,0 +1,13 @@
+package cspreport_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestCspreport(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "CSP Report Suite")
+}
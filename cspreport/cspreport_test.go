@@ -0,0 +1,162 @@
+package cspreport_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/ONSdigital/blaise-cawi-portal/cspreport"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parse", func() {
+	It("reads reports sent to report-uri", func() {
+		violations, err := cspreport.Parse("application/csp-report", []byte(`{"csp-report": {
+			"document-uri": "https://portal.example/dst2101a/?uac=123456789012",
+			"blocked-uri": "https://evil.example/steal.js?token=abc",
+			"violated-directive": "script-src-elem 'self' https://cdn.ons.gov.uk",
+			"source-file": "https://portal.example/dst2101a/resources/app.js?v=1",
+			"disposition": "enforce"
+		}}`))
+
+		Expect(err).To(BeNil())
+		Expect(violations).To(Equal([]cspreport.Violation{{
+			Directive:    "script-src-elem",
+			BlockedURI:   "https://evil.example",
+			DocumentPath: "/dst2101a/",
+			SourceFile:   "https://portal.example/dst2101a/resources/app.js",
+			Disposition:  "enforce",
+		}}))
+	})
+
+	It("reads the CSP violations sent to report-to", func() {
+		violations, err := cspreport.Parse("application/reports+json", []byte(`[
+			{"type": "csp-violation", "url": "https://portal.example/", "body": {
+				"documentURL": "https://portal.example/auth/login",
+				"blockedURL": "inline",
+				"effectiveDirective": "script-src-elem",
+				"disposition": "enforce"
+			}},
+			{"type": "deprecation", "body": {"id": "UnloadHandler"}}
+		]`))
+
+		Expect(err).To(BeNil())
+		Expect(violations).To(Equal([]cspreport.Violation{{
+			Directive:    "script-src-elem",
+			BlockedURI:   "inline",
+			DocumentPath: "/auth/login",
+			Disposition:  "enforce",
+		}}))
+	})
+
+	It("keeps only the scheme of data URIs", func() {
+		violations, err := cspreport.Parse("application/json", []byte(`{"csp-report": {
+			"blocked-uri": "data:text/javascript;base64,YWxlcnQoMSk=",
+			"effective-directive": "script-src-elem"
+		}}`))
+
+		Expect(err).To(BeNil())
+		Expect(violations[0].BlockedURI).To(Equal("data"))
+		Expect(violations[0].Disposition).To(Equal("enforce"))
+	})
+
+	It("rejects other content types", func() {
+		_, err := cspreport.Parse("text/plain", []byte(`{}`))
+
+		Expect(err).To(MatchError(`unsupported report content type "text/plain"`))
+	})
+
+	It("rejects malformed reports", func() {
+		_, err := cspreport.Parse("application/csp-report", []byte(`{"csp-report":`))
+
+		Expect(err).ToNot(BeNil())
+	})
+})
+
+var _ = Describe("Aggregator", func() {
+	var (
+		aggregator   *cspreport.Aggregator
+		observedLogs *observer.ObservedLogs
+		now          time.Time
+		inline       = cspreport.Violation{Directive: "script-src-elem", BlockedURI: "inline", DocumentPath: "/auth/login", Disposition: "enforce"}
+		evil         = cspreport.Violation{Directive: "img-src", BlockedURI: "https://evil.example", DocumentPath: "/dst2101a/", Disposition: "enforce"}
+	)
+
+	BeforeEach(func() {
+		var observedZapCore zapcore.Core
+		observedZapCore, observedLogs = observer.New(zap.InfoLevel)
+		now = time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC)
+		aggregator = &cspreport.Aggregator{
+			Logger:        zap.New(observedZapCore),
+			Interval:      time.Minute,
+			MaxViolations: 2,
+			Clock:         func() time.Time { return now },
+		}
+	})
+
+	It("logs each violation once an interval with its count", func() {
+		aggregator.Record(inline)
+		aggregator.Record(inline)
+		aggregator.Record(evil)
+		Expect(observedLogs.Len()).To(Equal(0))
+
+		now = now.Add(time.Minute)
+		aggregator.Record(inline)
+
+		Expect(observedLogs.FilterMessage("CSP violations").FilterField(zap.Int("Count", 2)).All()).To(HaveLen(1))
+		logged := observedLogs.FilterField(zap.String("BlockedURI", "inline")).All()
+		Expect(logged).To(HaveLen(1))
+		Expect(logged[0].ContextMap()["Directive"]).To(Equal("script-src-elem"))
+		Expect(logged[0].ContextMap()["DocumentPath"]).To(Equal("/auth/login"))
+		Expect(observedLogs.FilterField(zap.String("BlockedURI", "https://evil.example")).All()).To(HaveLen(1))
+
+		aggregator.Flush()
+		Expect(observedLogs.FilterField(zap.String("BlockedURI", "inline")).All()).To(HaveLen(2))
+	})
+
+	It("only counts MaxViolations distinct violations an interval", func() {
+		aggregator.Record(inline)
+		aggregator.Record(evil)
+		aggregator.Record(cspreport.Violation{Directive: "font-src", BlockedURI: "https://fonts.example"})
+		aggregator.Record(cspreport.Violation{Directive: "frame-src", BlockedURI: "https://frames.example"})
+		aggregator.Flush()
+
+		Expect(observedLogs.FilterMessage("CSP violations").All()).To(HaveLen(2))
+		dropped := observedLogs.FilterMessage("CSP violations not aggregated").All()
+		Expect(dropped).To(HaveLen(1))
+		Expect(dropped[0].ContextMap()["Count"]).To(Equal(int64(2)))
+	})
+
+	It("logs the counts every interval while running", func() {
+		aggregator.Interval = 10 * time.Millisecond
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := make(chan struct{})
+		go func() {
+			aggregator.Run(ctx)
+			close(stopped)
+		}()
+		defer func() {
+			cancel()
+			<-stopped
+		}()
+
+		aggregator.Record(inline)
+
+		Eventually(func() int {
+			return len(observedLogs.FilterMessage("CSP violations").All())
+		}).Should(Equal(1))
+		Consistently(func() int {
+			return len(observedLogs.FilterMessage("CSP violations").All())
+		}, 50*time.Millisecond).Should(Equal(1))
+	})
+
+	It("logs nothing when there have been no violations", func() {
+		aggregator.Flush()
+
+		Expect(observedLogs.Len()).To(Equal(0))
+	})
+})
@@ -0,0 +1,16 @@
+package kvstore
+
+import "time"
+
+// Generate mocks by running "go generate ./..."
+//
+//go:generate mockery --name Store
+type Store interface {
+	Incr(string, time.Duration) (int64, error)
+	Set(string, string, time.Duration) error
+	Get(string) (string, bool, error)
+	ExpireIfEqual(string, string, time.Duration) (bool, error)
+	DelIfEqual(string, string) (bool, error)
+	TTL(string) (time.Duration, error)
+	Del(...string) error
+}
@@ -0,0 +1,131 @@
+package kvstore
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process Store for dev mode and tests. Keys are not
+// shared between instances, so it must not be used for deployed services.
+type MemoryStore struct {
+	Clock func() time.Time
+
+	mutex   sync.Mutex
+	entries map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+func (memoryStore *MemoryStore) Incr(key string, ttl time.Duration) (int64, error) {
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+
+	entry, found := memoryStore.get(key)
+	if !found {
+		entry = memoryEntry{value: "0", expiresAt: memoryStore.now().Add(ttl)}
+	}
+	count, err := strconv.ParseInt(entry.value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	count++
+	entry.value = strconv.FormatInt(count, 10)
+	memoryStore.entries[key] = entry
+	return count, nil
+}
+
+func (memoryStore *MemoryStore) Set(key, value string, ttl time.Duration) error {
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+
+	memoryStore.init()
+	memoryStore.entries[key] = memoryEntry{value: value, expiresAt: memoryStore.now().Add(ttl)}
+	return nil
+}
+
+func (memoryStore *MemoryStore) Get(key string) (string, bool, error) {
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+
+	entry, found := memoryStore.get(key)
+	return entry.value, found, nil
+}
+
+// ExpireIfEqual restarts the expiry of key, only if it still holds value
+func (memoryStore *MemoryStore) ExpireIfEqual(key, value string, ttl time.Duration) (bool, error) {
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+
+	entry, found := memoryStore.get(key)
+	if !found || entry.value != value {
+		return false, nil
+	}
+	entry.expiresAt = memoryStore.now().Add(ttl)
+	memoryStore.entries[key] = entry
+	return true, nil
+}
+
+// DelIfEqual deletes key, only if it still holds value
+func (memoryStore *MemoryStore) DelIfEqual(key, value string) (bool, error) {
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+
+	entry, found := memoryStore.get(key)
+	if !found || entry.value != value {
+		return false, nil
+	}
+	delete(memoryStore.entries, key)
+	return true, nil
+}
+
+func (memoryStore *MemoryStore) TTL(key string) (time.Duration, error) {
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+
+	entry, found := memoryStore.get(key)
+	if !found {
+		return 0, nil
+	}
+	return entry.expiresAt.Sub(memoryStore.now()), nil
+}
+
+func (memoryStore *MemoryStore) Del(keys ...string) error {
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+
+	memoryStore.init()
+	for _, key := range keys {
+		delete(memoryStore.entries, key)
+	}
+	return nil
+}
+
+func (memoryStore *MemoryStore) get(key string) (memoryEntry, bool) {
+	memoryStore.init()
+	entry, found := memoryStore.entries[key]
+	if !found {
+		return memoryEntry{}, false
+	}
+	if !memoryStore.now().Before(entry.expiresAt) {
+		delete(memoryStore.entries, key)
+		return memoryEntry{}, false
+	}
+	return entry, true
+}
+
+func (memoryStore *MemoryStore) init() {
+	if memoryStore.entries == nil {
+		memoryStore.entries = map[string]memoryEntry{}
+	}
+}
+
+func (memoryStore *MemoryStore) now() time.Time {
+	if memoryStore.Clock != nil {
+		return memoryStore.Clock()
+	}
+	return time.Now()
+}
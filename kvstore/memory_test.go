@@ -0,0 +1,115 @@
+package kvstore_test
+
+import (
+	"time"
+
+	"github.com/ONSdigital/blaise-cawi-portal/kvstore"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MemoryStore", func() {
+	var (
+		now         time.Time
+		memoryStore *kvstore.MemoryStore
+	)
+
+	BeforeEach(func() {
+		now = time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+		memoryStore = &kvstore.MemoryStore{Clock: func() time.Time { return now }}
+	})
+
+	Describe("Incr", func() {
+		It("counts up from one and expires from the first increment", func() {
+			Expect(memoryStore.Incr("foo", time.Minute)).To(Equal(int64(1)))
+			now = now.Add(30 * time.Second)
+			Expect(memoryStore.Incr("foo", time.Minute)).To(Equal(int64(2)))
+			now = now.Add(30 * time.Second)
+			Expect(memoryStore.Incr("foo", time.Minute)).To(Equal(int64(1)))
+		})
+	})
+
+	Describe("Set and Get", func() {
+		It("returns a value until it expires", func() {
+			Expect(memoryStore.Set("foo", "bar", time.Minute)).To(Succeed())
+
+			value, found, err := memoryStore.Get("foo")
+			Expect(err).To(BeNil())
+			Expect(found).To(BeTrue())
+			Expect(value).To(Equal("bar"))
+
+			now = now.Add(time.Minute)
+			_, found, err = memoryStore.Get("foo")
+			Expect(err).To(BeNil())
+			Expect(found).To(BeFalse())
+		})
+	})
+
+	Describe("ExpireIfEqual", func() {
+		It("restarts the expiry of a key holding the value", func() {
+			Expect(memoryStore.Set("foo", "bar", time.Minute)).To(Succeed())
+			now = now.Add(40 * time.Second)
+
+			Expect(memoryStore.ExpireIfEqual("foo", "bar", time.Minute)).To(BeTrue())
+			Expect(memoryStore.TTL("foo")).To(Equal(time.Minute))
+		})
+
+		It("leaves a key holding another value", func() {
+			Expect(memoryStore.Set("foo", "other", time.Minute)).To(Succeed())
+			now = now.Add(40 * time.Second)
+
+			Expect(memoryStore.ExpireIfEqual("foo", "bar", time.Minute)).To(BeFalse())
+			Expect(memoryStore.TTL("foo")).To(Equal(20 * time.Second))
+		})
+
+		It("does not create a missing key", func() {
+			Expect(memoryStore.ExpireIfEqual("foo", "bar", time.Minute)).To(BeFalse())
+			_, found, _ := memoryStore.Get("foo")
+			Expect(found).To(BeFalse())
+		})
+	})
+
+	Describe("DelIfEqual", func() {
+		It("deletes a key holding the value", func() {
+			Expect(memoryStore.Set("foo", "bar", time.Minute)).To(Succeed())
+
+			Expect(memoryStore.DelIfEqual("foo", "bar")).To(BeTrue())
+			_, found, _ := memoryStore.Get("foo")
+			Expect(found).To(BeFalse())
+		})
+
+		It("leaves a key holding another value", func() {
+			Expect(memoryStore.Set("foo", "other", time.Minute)).To(Succeed())
+
+			Expect(memoryStore.DelIfEqual("foo", "bar")).To(BeFalse())
+			value, found, _ := memoryStore.Get("foo")
+			Expect(found).To(BeTrue())
+			Expect(value).To(Equal("other"))
+		})
+	})
+
+	Describe("TTL", func() {
+		It("returns the time left to live", func() {
+			Expect(memoryStore.Set("foo", "bar", time.Minute)).To(Succeed())
+			now = now.Add(20 * time.Second)
+			Expect(memoryStore.TTL("foo")).To(Equal(40 * time.Second))
+		})
+
+		It("returns zero for a missing key", func() {
+			Expect(memoryStore.TTL("missing")).To(Equal(time.Duration(0)))
+		})
+	})
+
+	Describe("Del", func() {
+		It("removes keys", func() {
+			Expect(memoryStore.Set("foo", "bar", time.Minute)).To(Succeed())
+			Expect(memoryStore.Set("fizz", "buzz", time.Minute)).To(Succeed())
+			Expect(memoryStore.Del("foo", "fizz")).To(Succeed())
+
+			_, found, _ := memoryStore.Get("foo")
+			Expect(found).To(BeFalse())
+			_, found, _ = memoryStore.Get("fizz")
+			Expect(found).To(BeFalse())
+		})
+	})
+})
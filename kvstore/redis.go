@@ -0,0 +1,141 @@
+package kvstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// incrScript increments the counter and starts its expiry in one step, so
+// that a counter is never left without one
+var incrScript = redis.NewScript(1, `
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// expireIfEqualScript compares and expires the key in one step, so that a
+// value set between the two is never given the expiry
+var expireIfEqualScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// delIfEqualScript compares and deletes the key in one step, so that a value
+// set between the two is never deleted
+var delIfEqualScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisStore keeps its keys in the same Redis database as the user sessions,
+// so it can share the session store's connection pool.
+type RedisStore struct {
+	Pool   *redis.Pool
+	Prefix string
+}
+
+// Ping checks Redis can be reached
+func (redisStore *RedisStore) Ping(ctx context.Context) error {
+	conn, err := redisStore.Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("PING")
+	return err
+}
+
+// Close closes the connection pool, which the session store shares
+func (redisStore *RedisStore) Close() error {
+	return redisStore.Pool.Close()
+}
+
+// Incr increments the counter at key, starting its expiry on the first increment
+func (redisStore *RedisStore) Incr(key string, ttl time.Duration) (int64, error) {
+	conn := redisStore.Pool.Get()
+	defer conn.Close()
+
+	return redis.Int64(incrScript.Do(conn, redisStore.key(key), ttl.Milliseconds()))
+}
+
+func (redisStore *RedisStore) Set(key, value string, ttl time.Duration) error {
+	conn := redisStore.Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", redisStore.key(key), value, "PX", ttl.Milliseconds())
+	return err
+}
+
+func (redisStore *RedisStore) Get(key string) (string, bool, error) {
+	conn := redisStore.Pool.Get()
+	defer conn.Close()
+
+	value, err := redis.String(conn.Do("GET", redisStore.key(key)))
+	if errors.Is(err, redis.ErrNil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// ExpireIfEqual restarts the expiry of key, only if it still holds value
+func (redisStore *RedisStore) ExpireIfEqual(key, value string, ttl time.Duration) (bool, error) {
+	conn := redisStore.Pool.Get()
+	defer conn.Close()
+
+	return redis.Bool(expireIfEqualScript.Do(conn, redisStore.key(key), value, ttl.Milliseconds()))
+}
+
+// DelIfEqual deletes key, only if it still holds value
+func (redisStore *RedisStore) DelIfEqual(key, value string) (bool, error) {
+	conn := redisStore.Pool.Get()
+	defer conn.Close()
+
+	return redis.Bool(delIfEqualScript.Do(conn, redisStore.key(key), value))
+}
+
+// TTL returns how long key has left to live, or zero if it does not exist
+func (redisStore *RedisStore) TTL(key string) (time.Duration, error) {
+	conn := redisStore.Pool.Get()
+	defer conn.Close()
+
+	ttl, err := redis.Int64(conn.Do("PTTL", redisStore.key(key)))
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return time.Duration(ttl) * time.Millisecond, nil
+}
+
+func (redisStore *RedisStore) Del(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	conn := redisStore.Pool.Get()
+	defer conn.Close()
+
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = redisStore.key(key)
+	}
+	_, err := conn.Do("DEL", args...)
+	return err
+}
+
+func (redisStore *RedisStore) key(key string) string {
+	return redisStore.Prefix + key
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/ONSdigital/blaise-cawi-portal/webserver"
 )
@@ -15,7 +19,17 @@ func main() {
 
 	server := &webserver.Server{Config: config}
 	httpRouter := server.SetupRouter()
-	err = httpRouter.Run(fmt.Sprintf(":%s", config.Port))
+	httpServer := server.HTTPServer(httpRouter)
+
+	listener, err := net.Listen("tcp", httpServer.Addr)
+	if err != nil {
+		_ = server.Shutdown(context.Background())
+		log.Fatal(err.Error())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	err = server.Serve(ctx, httpServer, listener)
 	if err != nil {
 		log.Fatal(err.Error())
 	}
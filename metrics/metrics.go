@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "cawi_portal"
+
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+)
+
+// Metrics collects the portal's Prometheus metrics. Every method does nothing
+// on a nil *Metrics, so metrics can be left out where they are not wanted.
+type Metrics struct {
+	registry           *prometheus.Registry
+	loginAttempts      *prometheus.CounterVec
+	upstreamDuration   *prometheus.HistogramVec
+	proxyDuration      *prometheus.HistogramVec
+	sessionRefreshes   prometheus.Counter
+	sessionStoreErrors *prometheus.CounterVec
+	auditDropped       prometheus.Counter
+	auditWriteFailures prometheus.Counter
+}
+
+// New returns metrics registered with their own registry, along with the Go
+// runtime and process metrics
+func New() *Metrics {
+	metrics := &Metrics{
+		registry: prometheus.NewRegistry(),
+		loginAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "login_attempts_total",
+			Help:      "Sign in attempts by outcome, and reason for failures.",
+		}, []string{"outcome", "reason"}),
+		upstreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "upstream_request_duration_seconds",
+			Help:      "How long calls to BUS, the Blaise REST API and CATI took, including retries, by how they ended.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"upstream", "outcome"}),
+		proxyDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "proxy_request_duration_seconds",
+			Help:      "How long requests proxied to Blaise took, by instrument, kind of path and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"instrument", "path_class", "status"}),
+		sessionRefreshes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "session_refreshes_total",
+			Help:      "Session tokens refreshed by respondents' activity.",
+		}),
+		sessionStoreErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "session_store_errors_total",
+			Help:      "Errors loading or saving sessions in the session store.",
+		}, []string{"operation"}),
+		auditDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "audit_events_dropped_total",
+			Help:      "Audit events dropped because too many were waiting to be written.",
+		}),
+		auditWriteFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "audit_write_failures_total",
+			Help:      "Attempts to write an audit event to the audit sink that failed, and will be retried.",
+		}),
+	}
+	metrics.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		metrics.loginAttempts,
+		metrics.upstreamDuration,
+		metrics.proxyDuration,
+		metrics.sessionRefreshes,
+		metrics.sessionStoreErrors,
+		metrics.auditDropped,
+		metrics.auditWriteFailures,
+	)
+	return metrics
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (metrics *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{})
+}
+
+// LoginAttempt counts a sign in, with the reason it failed if it did
+func (metrics *Metrics) LoginAttempt(outcome, reason string) {
+	if metrics == nil {
+		return
+	}
+	metrics.loginAttempts.WithLabelValues(outcome, reason).Inc()
+}
+
+// ObserveUpstream records how a call to an upstream ended and how long it took
+func (metrics *Metrics) ObserveUpstream(upstream, outcome string, duration time.Duration) {
+	if metrics == nil {
+		return
+	}
+	metrics.upstreamDuration.WithLabelValues(upstream, outcome).Observe(duration.Seconds())
+}
+
+// ProxyRequest records a request for an instrument proxied to Blaise
+func (metrics *Metrics) ProxyRequest(instrumentName, pathClass string, status int, duration time.Duration) {
+	if metrics == nil {
+		return
+	}
+	metrics.proxyDuration.WithLabelValues(instrumentName, pathClass, strconv.Itoa(status)).Observe(duration.Seconds())
+}
+
+// SessionRefreshed counts a session token being refreshed
+func (metrics *Metrics) SessionRefreshed() {
+	if metrics == nil {
+		return
+	}
+	metrics.sessionRefreshes.Inc()
+}
+
+// SessionStoreError counts a failure to load or save a session
+func (metrics *Metrics) SessionStoreError(operation string) {
+	if metrics == nil {
+		return
+	}
+	metrics.sessionStoreErrors.WithLabelValues(operation).Inc()
+}
+
+// AuditEventDropped counts an audit event that was never written
+func (metrics *Metrics) AuditEventDropped() {
+	if metrics == nil {
+		return
+	}
+	metrics.auditDropped.Inc()
+}
+
+// AuditWriteFailed counts a failed attempt to write an audit event
+func (metrics *Metrics) AuditWriteFailed() {
+	if metrics == nil {
+		return
+	}
+	metrics.auditWriteFailures.Inc()
+}
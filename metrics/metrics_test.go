@@ -0,0 +1,131 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/ONSdigital/blaise-cawi-portal/metrics"
+	"github.com/gin-contrib/sessions/cookie"
+	gorillasessions "github.com/gorilla/sessions"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func scrape(portalMetrics *metrics.Metrics) string {
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/metrics", nil)
+	portalMetrics.Handler().ServeHTTP(recorder, request)
+	return recorder.Body.String()
+}
+
+var _ = Describe("Metrics", func() {
+	var portalMetrics *metrics.Metrics
+
+	BeforeEach(func() {
+		portalMetrics = metrics.New()
+	})
+
+	It("counts login attempts by outcome and reason", func() {
+		portalMetrics.LoginAttempt(metrics.LoginSuccess, "")
+		portalMetrics.LoginAttempt(metrics.LoginFailure, "Access code not recognised")
+		portalMetrics.LoginAttempt(metrics.LoginFailure, "Access code not recognised")
+
+		body := scrape(portalMetrics)
+		Expect(body).To(ContainSubstring(`cawi_portal_login_attempts_total{outcome="success",reason=""} 1`))
+		Expect(body).To(ContainSubstring(`cawi_portal_login_attempts_total{outcome="failure",reason="Access code not recognised"} 2`))
+	})
+
+	It("records upstream calls by how they ended", func() {
+		portalMetrics.ObserveUpstream("bus", "2xx", 50*time.Millisecond)
+		portalMetrics.ObserveUpstream("bus", "error", time.Second)
+
+		body := scrape(portalMetrics)
+		Expect(body).To(ContainSubstring(`cawi_portal_upstream_request_duration_seconds_count{outcome="2xx",upstream="bus"} 1`))
+		Expect(body).To(ContainSubstring(`cawi_portal_upstream_request_duration_seconds_count{outcome="error",upstream="bus"} 1`))
+	})
+
+	It("records proxied requests by instrument, path class and status", func() {
+		portalMetrics.ProxyRequest("dst2101a", "api", http.StatusOK, 10*time.Millisecond)
+
+		Expect(scrape(portalMetrics)).To(ContainSubstring(
+			`cawi_portal_proxy_request_duration_seconds_count{instrument="dst2101a",path_class="api",status="200"} 1`,
+		))
+	})
+
+	It("counts session refreshes and session store errors", func() {
+		portalMetrics.SessionRefreshed()
+		portalMetrics.SessionStoreError("save")
+
+		body := scrape(portalMetrics)
+		Expect(body).To(ContainSubstring(`cawi_portal_session_refreshes_total 1`))
+		Expect(body).To(ContainSubstring(`cawi_portal_session_store_errors_total{operation="save"} 1`))
+	})
+
+	It("counts dropped audit events and failed audit writes", func() {
+		portalMetrics.AuditEventDropped()
+		portalMetrics.AuditWriteFailed()
+		portalMetrics.AuditWriteFailed()
+
+		body := scrape(portalMetrics)
+		Expect(body).To(ContainSubstring(`cawi_portal_audit_events_dropped_total 1`))
+		Expect(body).To(ContainSubstring(`cawi_portal_audit_write_failures_total 2`))
+	})
+
+	It("includes the Go runtime metrics", func() {
+		Expect(scrape(portalMetrics)).To(ContainSubstring("go_goroutines"))
+	})
+
+	It("does nothing when nil", func() {
+		var nilMetrics *metrics.Metrics
+		Expect(func() {
+			nilMetrics.LoginAttempt(metrics.LoginSuccess, "")
+			nilMetrics.ObserveUpstream("bus", "2xx", time.Second)
+			nilMetrics.ProxyRequest("dst2101a", "api", http.StatusOK, time.Second)
+			nilMetrics.SessionRefreshed()
+			nilMetrics.SessionStoreError("save")
+			nilMetrics.AuditEventDropped()
+			nilMetrics.AuditWriteFailed()
+		}).ToNot(Panic())
+	})
+})
+
+var _ = Describe("SessionStore", func() {
+	var (
+		portalMetrics *metrics.Metrics
+		sessionStore  *metrics.SessionStore
+	)
+
+	BeforeEach(func() {
+		portalMetrics = metrics.New()
+		sessionStore = &metrics.SessionStore{Store: cookie.NewStore([]byte("secret")), Metrics: portalMetrics}
+	})
+
+	It("counts sessions that cannot be loaded", func() {
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.AddCookie(&http.Cookie{Name: "user_session", Value: "tampered"})
+
+		_, err := sessionStore.Get(request, "user_session")
+		Expect(err).To(HaveOccurred())
+		Expect(scrape(portalMetrics)).To(ContainSubstring(`cawi_portal_session_store_errors_total{operation="load"} 1`))
+	})
+
+	It("counts sessions that cannot be saved", func() {
+		request, _ := http.NewRequest("GET", "/", nil)
+		session := gorillasessions.NewSession(sessionStore, "user_session")
+		session.Values[struct{}{}] = func() {}
+
+		err := sessionStore.Save(request, httptest.NewRecorder(), session)
+		Expect(err).To(HaveOccurred())
+		Expect(scrape(portalMetrics)).To(ContainSubstring(`cawi_portal_session_store_errors_total{operation="save"} 1`))
+	})
+
+	It("does not count sessions that load", func() {
+		request, _ := http.NewRequest("GET", "/", nil)
+
+		_, err := sessionStore.Get(request, "user_session")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(scrape(portalMetrics)).ToNot(ContainSubstring(`cawi_portal_session_store_errors_total{`))
+	})
+})
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/gin-contrib/sessions"
+	gorillasessions "github.com/gorilla/sessions"
+)
+
+// SessionStore counts the errors of the store it wraps, which the sessions
+// middleware otherwise only prints when loading a session
+type SessionStore struct {
+	sessions.Store
+	Metrics *Metrics
+}
+
+func (sessionStore *SessionStore) Get(request *http.Request, name string) (*gorillasessions.Session, error) {
+	session, err := sessionStore.Store.Get(request, name)
+	if err != nil {
+		sessionStore.Metrics.SessionStoreError("load")
+	}
+	return session, err
+}
+
+func (sessionStore *SessionStore) New(request *http.Request, name string) (*gorillasessions.Session, error) {
+	session, err := sessionStore.Store.New(request, name)
+	if err != nil {
+		sessionStore.Metrics.SessionStoreError("load")
+	}
+	return session, err
+}
+
+func (sessionStore *SessionStore) Save(request *http.Request, writer http.ResponseWriter, session *gorillasessions.Session) error {
+	err := sessionStore.Store.Save(request, writer, session)
+	if err != nil {
+		sessionStore.Metrics.SessionStoreError("save")
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package outbound
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of calling an upstream whose circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitBreaker stops calls to an upstream after Threshold consecutive
+// failures. Once Cooldown has passed a single trial call is let through,
+// which closes the breaker if it succeeds and opens it again if it fails.
+// A Threshold of 0 never opens the breaker.
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+	Clock     func() time.Time
+
+	mutex     sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+// Allow reports whether a call may be made now
+func (breaker *CircuitBreaker) Allow() bool {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	if !breaker.tripped() {
+		return true
+	}
+	if breaker.now().Before(breaker.openUntil) || breaker.trial {
+		return false
+	}
+	breaker.trial = true
+	return true
+}
+
+func (breaker *CircuitBreaker) Success() {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	breaker.failures = 0
+	breaker.trial = false
+}
+
+func (breaker *CircuitBreaker) Failure() {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	breaker.failures++
+	breaker.trial = false
+	if breaker.tripped() {
+		breaker.openUntil = breaker.now().Add(breaker.Cooldown)
+	}
+}
+
+// Release lets another trial call through in place of one that ended without
+// saying whether the upstream works, such as a call its caller cancelled.
+// Without it, the breaker would wait for the trial's outcome forever.
+func (breaker *CircuitBreaker) Release() {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	breaker.trial = false
+}
+
+// Open reports whether calls are currently being refused
+func (breaker *CircuitBreaker) Open() bool {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	return breaker.tripped() && (breaker.now().Before(breaker.openUntil) || breaker.trial)
+}
+
+func (breaker *CircuitBreaker) tripped() bool {
+	return breaker.Threshold > 0 && breaker.failures >= breaker.Threshold
+}
+
+func (breaker *CircuitBreaker) now() time.Time {
+	if breaker.Clock != nil {
+		return breaker.Clock()
+	}
+	return time.Now()
+}
@@ -0,0 +1,95 @@
+package outbound_test
+
+import (
+	"time"
+
+	"github.com/ONSdigital/blaise-cawi-portal/outbound"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CircuitBreaker", func() {
+	var (
+		now     time.Time
+		breaker *outbound.CircuitBreaker
+	)
+
+	BeforeEach(func() {
+		now = time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+		breaker = &outbound.CircuitBreaker{
+			Threshold: 3,
+			Cooldown:  30 * time.Second,
+			Clock:     func() time.Time { return now },
+		}
+	})
+
+	It("stays closed below the threshold", func() {
+		breaker.Failure()
+		breaker.Failure()
+		Expect(breaker.Allow()).To(BeTrue())
+		Expect(breaker.Open()).To(BeFalse())
+	})
+
+	It("only counts consecutive failures", func() {
+		breaker.Failure()
+		breaker.Failure()
+		breaker.Success()
+		breaker.Failure()
+		Expect(breaker.Allow()).To(BeTrue())
+	})
+
+	Context("when the threshold is reached", func() {
+		BeforeEach(func() {
+			for i := 0; i < 3; i++ {
+				breaker.Failure()
+			}
+		})
+
+		It("refuses calls until the cooldown has passed", func() {
+			Expect(breaker.Open()).To(BeTrue())
+			Expect(breaker.Allow()).To(BeFalse())
+			now = now.Add(29 * time.Second)
+			Expect(breaker.Allow()).To(BeFalse())
+		})
+
+		It("lets a single trial call through after the cooldown", func() {
+			now = now.Add(30 * time.Second)
+			Expect(breaker.Allow()).To(BeTrue())
+			Expect(breaker.Allow()).To(BeFalse())
+		})
+
+		It("closes when the trial call succeeds", func() {
+			now = now.Add(30 * time.Second)
+			breaker.Allow()
+			breaker.Success()
+			Expect(breaker.Open()).To(BeFalse())
+			Expect(breaker.Allow()).To(BeTrue())
+			Expect(breaker.Allow()).To(BeTrue())
+		})
+
+		It("lets another trial call through when the trial call is released", func() {
+			now = now.Add(30 * time.Second)
+			breaker.Allow()
+			breaker.Release()
+			Expect(breaker.Allow()).To(BeTrue())
+			Expect(breaker.Allow()).To(BeFalse())
+		})
+
+		It("opens again when the trial call fails", func() {
+			now = now.Add(30 * time.Second)
+			breaker.Allow()
+			breaker.Failure()
+			Expect(breaker.Allow()).To(BeFalse())
+			now = now.Add(30 * time.Second)
+			Expect(breaker.Allow()).To(BeTrue())
+		})
+	})
+
+	It("never opens without a threshold", func() {
+		breaker.Threshold = 0
+		for i := 0; i < 10; i++ {
+			breaker.Failure()
+		}
+		Expect(breaker.Allow()).To(BeTrue())
+	})
+})
@@ -0,0 +1,209 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Policy configures how calls to an upstream are made. Timeout bounds the
+// whole call, including any retries. Retries wait a random time of up to
+// RetryBackoff, doubled for each further attempt.
+type Policy struct {
+	Timeout          time.Duration
+	MaxRetries       int
+	RetryBackoff     time.Duration
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// Told how each call went, when set
+	Observer Observer
+}
+
+// Observer is told how each call to an upstream ended and how long it took,
+// including any retries
+type Observer interface {
+	ObserveUpstream(upstream, outcome string, duration time.Duration)
+}
+
+type idempotentKey struct{}
+
+// Idempotent marks a request as safe to retry even though its method is not,
+// such as a lookup made with a POST
+func Idempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+// NewClient returns a client for the named upstream that makes its calls
+// through base, or the default transport if base is nil
+func NewClient(name string, policy Policy, base http.RoundTripper, logger *zap.Logger) *http.Client {
+	return &http.Client{
+		Timeout: policy.Timeout,
+		Transport: &Transport{
+			Name:         name,
+			Base:         base,
+			MaxRetries:   policy.MaxRetries,
+			RetryBackoff: policy.RetryBackoff,
+			Breaker: &CircuitBreaker{
+				Threshold: policy.BreakerThreshold,
+				Cooldown:  policy.BreakerCooldown,
+			},
+			Logger:   logger,
+			Observer: policy.Observer,
+		},
+	}
+}
+
+// Transport retries idempotent requests that fail with a network error or a
+// 502, 503 or 504, and refuses requests while the upstream's circuit breaker
+// is open. Server errors count towards opening the breaker, client errors do
+// not. Calls cancelled by the caller, such as when a respondent closes the
+// page, count as neither, since they say nothing about the upstream.
+type Transport struct {
+	Name         string
+	Base         http.RoundTripper
+	MaxRetries   int
+	RetryBackoff time.Duration
+	Breaker      *CircuitBreaker
+	Logger       *zap.Logger
+	Observer     Observer
+	// Waits between retries, defaults to sleeping until the request is cancelled
+	Sleep func(context.Context, time.Duration) error
+}
+
+func (transport *Transport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if !transport.Breaker.Allow() {
+		transport.observe("circuit_open", 0)
+		return nil, fmt.Errorf("%s: %w", transport.Name, ErrCircuitOpen)
+	}
+
+	start := time.Now()
+	response, err := transport.roundTripWithRetries(request)
+	if err != nil && cancelled(request, err) {
+		transport.observe("cancelled", time.Since(start))
+		transport.Breaker.Release()
+		return response, err
+	}
+	if err != nil {
+		transport.observe("error", time.Since(start))
+	} else {
+		transport.observe(fmt.Sprintf("%dxx", response.StatusCode/100), time.Since(start))
+	}
+	if err != nil || response.StatusCode >= http.StatusInternalServerError {
+		transport.Breaker.Failure()
+		if transport.Breaker.Open() {
+			transport.Logger.Warn("Circuit breaker opened", zap.String("Upstream", transport.Name))
+		}
+	} else {
+		transport.Breaker.Success()
+	}
+	return response, err
+}
+
+func (transport *Transport) roundTripWithRetries(request *http.Request) (*http.Response, error) {
+	retries := 0
+	if retryable(request) {
+		retries = transport.MaxRetries
+	}
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && request.GetBody != nil {
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			request = request.Clone(request.Context())
+			request.Body = body
+		}
+
+		response, err := transport.base().RoundTrip(request)
+		if attempt == retries || !shouldRetry(response, err) || request.Context().Err() != nil {
+			return response, err
+		}
+
+		fields := []zap.Field{zap.String("Upstream", transport.Name), zap.Int("Attempt", attempt+1)}
+		if err != nil {
+			fields = append(fields, zap.Error(err))
+		} else {
+			fields = append(fields, zap.Int("RespStatusCode", response.StatusCode))
+			_, _ = io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+		}
+		transport.Logger.Warn("Retrying outbound request", fields...)
+
+		if err := transport.sleep(request.Context(), transport.backoff(attempt)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff is a random wait of up to RetryBackoff doubled for each attempt
+// already made, so that callers retrying together spread out
+func (transport *Transport) backoff(attempt int) time.Duration {
+	maximum := transport.RetryBackoff << attempt
+	if maximum <= 0 {
+		return 0
+	}
+	return rand.N(maximum)
+}
+
+func (transport *Transport) sleep(ctx context.Context, duration time.Duration) error {
+	if transport.Sleep != nil {
+		return transport.Sleep(ctx, duration)
+	}
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (transport *Transport) observe(outcome string, duration time.Duration) {
+	if transport.Observer != nil {
+		transport.Observer.ObserveUpstream(transport.Name, outcome, duration)
+	}
+}
+
+func (transport *Transport) base() http.RoundTripper {
+	if transport.Base != nil {
+		return transport.Base
+	}
+	return http.DefaultTransport
+}
+
+func retryable(request *http.Request) bool {
+	if request.Body != nil && request.Body != http.NoBody && request.GetBody == nil {
+		return false
+	}
+	switch request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	idempotent, _ := request.Context().Value(idempotentKey{}).(bool)
+	return idempotent
+}
+
+// cancelled is whether a call failed because the caller gave up on it. A
+// deadline passing is not, as the client's Timeout is applied as a deadline on
+// the request's context and the upstream was too slow to meet it.
+func cancelled(request *http.Request, err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(request.Context().Err(), context.Canceled)
+}
+
+func shouldRetry(response *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch response.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
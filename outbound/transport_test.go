@@ -0,0 +1,264 @@
+package outbound_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/blaise-cawi-portal/outbound"
+	"go.uber.org/zap"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (roundTrip roundTripFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return roundTrip(request)
+}
+
+type observation struct {
+	upstream string
+	outcome  string
+}
+
+type recordingObserver struct{ observations []observation }
+
+func (observer *recordingObserver) ObserveUpstream(upstream, outcome string, _ time.Duration) {
+	observer.observations = append(observer.observations, observation{upstream, outcome})
+}
+
+func respond(statusCode int) *http.Response {
+	return &http.Response{StatusCode: statusCode, Body: io.NopCloser(strings.NewReader(""))}
+}
+
+var _ = Describe("Transport", func() {
+	var (
+		responses []*http.Response
+		errs      []error
+		bodies    []string
+		waits     []time.Duration
+		transport *outbound.Transport
+		client    *http.Client
+	)
+
+	BeforeEach(func() {
+		responses = nil
+		errs = nil
+		bodies = nil
+		waits = nil
+		transport = &outbound.Transport{
+			Name: "bus",
+			Base: roundTripFunc(func(request *http.Request) (*http.Response, error) {
+				attempt := len(bodies)
+				body := ""
+				if request.Body != nil {
+					bodyBytes, _ := io.ReadAll(request.Body)
+					body = string(bodyBytes)
+				}
+				bodies = append(bodies, body)
+				if attempt < len(errs) && errs[attempt] != nil {
+					return nil, errs[attempt]
+				}
+				if attempt < len(responses) {
+					return responses[attempt], nil
+				}
+				return respond(http.StatusOK), nil
+			}),
+			MaxRetries:   2,
+			RetryBackoff: 100 * time.Millisecond,
+			Breaker:      &outbound.CircuitBreaker{Threshold: 2, Cooldown: time.Minute},
+			Logger:       zap.NewNop(),
+			Sleep: func(ctx context.Context, duration time.Duration) error {
+				waits = append(waits, duration)
+				return nil
+			},
+		}
+		client = &http.Client{Transport: transport}
+	})
+
+	It("retries idempotent requests that fail", func() {
+		responses = []*http.Response{respond(http.StatusServiceUnavailable), respond(http.StatusBadGateway)}
+
+		response, err := client.Get("http://bus/uacs/uac")
+		Expect(err).To(BeNil())
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+		Expect(bodies).To(HaveLen(3))
+	})
+
+	It("waits a jittered, growing backoff between retries", func() {
+		errs = []error{fmt.Errorf("connection reset"), fmt.Errorf("connection reset")}
+
+		_, _ = client.Get("http://bus/uacs/uac")
+		Expect(waits).To(HaveLen(2))
+		Expect(waits[0]).To(BeNumerically("<", 100*time.Millisecond))
+		Expect(waits[1]).To(BeNumerically("<", 200*time.Millisecond))
+	})
+
+	It("gives up after the maximum retries", func() {
+		responses = []*http.Response{
+			respond(http.StatusServiceUnavailable),
+			respond(http.StatusServiceUnavailable),
+			respond(http.StatusServiceUnavailable),
+		}
+
+		response, err := client.Get("http://bus/uacs/uac")
+		Expect(err).To(BeNil())
+		Expect(response.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(bodies).To(HaveLen(3))
+	})
+
+	It("does not retry client errors", func() {
+		responses = []*http.Response{respond(http.StatusNotFound)}
+
+		response, _ := client.Get("http://bus/uacs/uac")
+		Expect(response.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(bodies).To(HaveLen(1))
+	})
+
+	It("does not retry POSTs", func() {
+		responses = []*http.Response{respond(http.StatusServiceUnavailable)}
+
+		response, _ := client.Post("http://cati/dst2101a/default.aspx", "text/plain", bytes.NewReader([]byte("case")))
+		Expect(response.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(bodies).To(HaveLen(1))
+	})
+
+	It("retries POSTs marked idempotent with their body", func() {
+		responses = []*http.Response{respond(http.StatusServiceUnavailable)}
+
+		request, _ := http.NewRequest("POST", "http://bus/uacs/uac", bytes.NewReader([]byte(`{"uac":"123456789012"}`)))
+		request = request.WithContext(outbound.Idempotent(request.Context()))
+		response, err := client.Do(request)
+		Expect(err).To(BeNil())
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+		Expect(bodies).To(Equal([]string{`{"uac":"123456789012"}`, `{"uac":"123456789012"}`}))
+	})
+
+	Context("with an observer", func() {
+		var observer *recordingObserver
+
+		BeforeEach(func() {
+			observer = &recordingObserver{}
+			transport.Observer = observer
+		})
+
+		It("observes each call once, however many times it was retried", func() {
+			responses = []*http.Response{respond(http.StatusServiceUnavailable)}
+			_, _ = client.Get("http://bus/uacs/uac")
+			Expect(observer.observations).To(Equal([]observation{{"bus", "2xx"}}))
+		})
+
+		It("observes calls that fail", func() {
+			transport.MaxRetries = 0
+			errs = []error{fmt.Errorf("connection reset")}
+			responses = []*http.Response{nil, respond(http.StatusInternalServerError), respond(http.StatusInternalServerError)}
+			_, _ = client.Get("http://bus/uacs/uac")
+			_, _ = client.Get("http://bus/uacs/uac")
+			_, _ = client.Get("http://bus/uacs/uac")
+			Expect(observer.observations).To(Equal([]observation{
+				{"bus", "error"},
+				{"bus", "5xx"},
+				{"bus", "circuit_open"},
+			}))
+		})
+	})
+
+	Context("when the upstream keeps failing", func() {
+		BeforeEach(func() {
+			transport.MaxRetries = 0
+			responses = []*http.Response{respond(http.StatusInternalServerError), respond(http.StatusInternalServerError)}
+			_, _ = client.Get("http://bus/uacs/uac")
+			_, _ = client.Get("http://bus/uacs/uac")
+		})
+
+		It("opens the circuit breaker and fails fast", func() {
+			_, err := client.Get("http://bus/uacs/uac")
+			Expect(errors.Is(err, outbound.ErrCircuitOpen)).To(BeTrue())
+			Expect(bodies).To(HaveLen(2))
+		})
+	})
+
+	Context("when the caller cancels its calls", func() {
+		var observer *recordingObserver
+
+		BeforeEach(func() {
+			observer = &recordingObserver{}
+			transport.Observer = observer
+			transport.MaxRetries = 0
+		})
+
+		It("does not count them towards opening the circuit breaker", func() {
+			errs = []error{context.Canceled, context.Canceled, context.Canceled}
+			for range 3 {
+				_, err := client.Get("http://bus/uacs/uac")
+				Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+			}
+
+			Expect(transport.Breaker.Open()).To(BeFalse())
+			Expect(observer.observations).To(Equal([]observation{
+				{"bus", "cancelled"},
+				{"bus", "cancelled"},
+				{"bus", "cancelled"},
+			}))
+		})
+
+		It("does not count calls failing after the caller's context ended", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			errs = []error{fmt.Errorf("connection reset"), fmt.Errorf("connection reset")}
+			for range 2 {
+				request, _ := http.NewRequestWithContext(ctx, "GET", "http://bus/uacs/uac", nil)
+				_, _ = transport.RoundTrip(request)
+			}
+
+			Expect(transport.Breaker.Open()).To(BeFalse())
+		})
+
+		It("lets another trial call through when the trial call is cancelled", func() {
+			now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+			transport.Breaker.Clock = func() time.Time { return now }
+			errs = []error{fmt.Errorf("connection reset"), fmt.Errorf("connection reset"), context.Canceled}
+			_, _ = client.Get("http://bus/uacs/uac")
+			_, _ = client.Get("http://bus/uacs/uac")
+			Expect(transport.Breaker.Open()).To(BeTrue())
+
+			now = now.Add(time.Minute)
+			_, err := client.Get("http://bus/uacs/uac")
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+
+			response, err := client.Get("http://bus/uacs/uac")
+			Expect(err).To(BeNil())
+			Expect(response.StatusCode).To(Equal(http.StatusOK))
+			Expect(transport.Breaker.Open()).To(BeFalse())
+		})
+
+		It("still counts calls that time out", func() {
+			errs = []error{context.DeadlineExceeded, context.DeadlineExceeded}
+			_, _ = client.Get("http://bus/uacs/uac")
+			_, _ = client.Get("http://bus/uacs/uac")
+
+			Expect(transport.Breaker.Open()).To(BeTrue())
+		})
+	})
+})
+
+var _ = Describe("NewClient", func() {
+	It("applies the policy's timeout to the whole call", func() {
+		client := outbound.NewClient("rest-api", outbound.Policy{Timeout: 5 * time.Second}, nil, zap.NewNop())
+		Expect(client.Timeout).To(Equal(5 * time.Second))
+		Expect(client.Transport).To(BeAssignableToTypeOf(&outbound.Transport{}))
+	})
+
+	It("gives the transport the policy's observer", func() {
+		observer := &recordingObserver{}
+		client := outbound.NewClient("rest-api", outbound.Policy{Observer: observer}, nil, zap.NewNop())
+		Expect(client.Transport.(*outbound.Transport).Observer).To(Equal(observer))
+	})
+})
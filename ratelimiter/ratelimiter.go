@@ -0,0 +1,80 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ONSdigital/blaise-cawi-portal/kvstore"
+)
+
+// Generate mocks by running "go generate ./..."
+//
+//go:generate mockery --name LimiterInterface
+type LimiterInterface interface {
+	LockedOut(string) (time.Duration, error)
+	Fail(string) (time.Duration, error)
+	Reset(string) error
+}
+
+// Policy allows MaxAttempts failures within Window, after which every further
+// failure locks the key out for twice as long as the last, up to MaxLockout.
+type Policy struct {
+	MaxAttempts int
+	Window      time.Duration
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+}
+
+type Limiter struct {
+	Name   string
+	Store  kvstore.Store
+	Policy Policy
+}
+
+// LockedOut returns how long the key remains locked out for, or zero if it is not
+func (limiter *Limiter) LockedOut(key string) (time.Duration, error) {
+	return limiter.Store.TTL(limiter.lockoutKey(key))
+}
+
+// Fail records a failed attempt against the key and returns the lockout it incurred
+func (limiter *Limiter) Fail(key string) (time.Duration, error) {
+	attempts, err := limiter.Store.Incr(limiter.attemptsKey(key), limiter.Policy.Window)
+	if err != nil {
+		return 0, err
+	}
+	lockout := limiter.lockout(attempts)
+	if lockout == 0 {
+		return 0, nil
+	}
+	if err := limiter.Store.Set(limiter.lockoutKey(key), "1", lockout); err != nil {
+		return 0, err
+	}
+	return lockout, nil
+}
+
+func (limiter *Limiter) Reset(key string) error {
+	return limiter.Store.Del(limiter.attemptsKey(key), limiter.lockoutKey(key))
+}
+
+func (limiter *Limiter) lockout(attempts int64) time.Duration {
+	excess := attempts - int64(limiter.Policy.MaxAttempts)
+	if excess <= 0 {
+		return 0
+	}
+	lockout := limiter.Policy.BaseLockout
+	for i := int64(1); i < excess && lockout < limiter.Policy.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > limiter.Policy.MaxLockout {
+		return limiter.Policy.MaxLockout
+	}
+	return lockout
+}
+
+func (limiter *Limiter) attemptsKey(key string) string {
+	return fmt.Sprintf("login_attempts:%s:%s", limiter.Name, key)
+}
+
+func (limiter *Limiter) lockoutKey(key string) string {
+	return fmt.Sprintf("login_lockout:%s:%s", limiter.Name, key)
+}
@@ -0,0 +1,74 @@
+package ratelimiter_test
+
+import (
+	"time"
+
+	"github.com/ONSdigital/blaise-cawi-portal/kvstore"
+	"github.com/ONSdigital/blaise-cawi-portal/ratelimiter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Limiter", func() {
+	var (
+		now     time.Time
+		limiter *ratelimiter.Limiter
+	)
+
+	BeforeEach(func() {
+		now = time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+		limiter = &ratelimiter.Limiter{
+			Name:  "ip",
+			Store: &kvstore.MemoryStore{Clock: func() time.Time { return now }},
+			Policy: ratelimiter.Policy{
+				MaxAttempts: 3,
+				Window:      time.Hour,
+				BaseLockout: 30 * time.Second,
+				MaxLockout:  2 * time.Minute,
+			},
+		}
+	})
+
+	Context("when the key is under the maximum attempts", func() {
+		It("does not lock out", func() {
+			for i := 0; i < 3; i++ {
+				Expect(limiter.Fail("1.1.1.1")).To(Equal(time.Duration(0)))
+			}
+			Expect(limiter.LockedOut("1.1.1.1")).To(Equal(time.Duration(0)))
+		})
+	})
+
+	Context("when the key goes over the maximum attempts", func() {
+		BeforeEach(func() {
+			for i := 0; i < 3; i++ {
+				_, _ = limiter.Fail("1.1.1.1")
+			}
+		})
+
+		It("locks out for longer after each failure, up to the maximum lockout", func() {
+			Expect(limiter.Fail("1.1.1.1")).To(Equal(30 * time.Second))
+			Expect(limiter.Fail("1.1.1.1")).To(Equal(time.Minute))
+			Expect(limiter.Fail("1.1.1.1")).To(Equal(2 * time.Minute))
+			Expect(limiter.Fail("1.1.1.1")).To(Equal(2 * time.Minute))
+			Expect(limiter.LockedOut("1.1.1.1")).To(Equal(2 * time.Minute))
+		})
+
+		It("lifts the lockout once it has passed", func() {
+			_, _ = limiter.Fail("1.1.1.1")
+			now = now.Add(30 * time.Second)
+			Expect(limiter.LockedOut("1.1.1.1")).To(Equal(time.Duration(0)))
+		})
+
+		It("does not lock out other keys", func() {
+			_, _ = limiter.Fail("1.1.1.1")
+			Expect(limiter.LockedOut("2.2.2.2")).To(Equal(time.Duration(0)))
+		})
+
+		It("starts again when reset", func() {
+			_, _ = limiter.Fail("1.1.1.1")
+			Expect(limiter.Reset("1.1.1.1")).To(Succeed())
+			Expect(limiter.LockedOut("1.1.1.1")).To(Equal(time.Duration(0)))
+			Expect(limiter.Fail("1.1.1.1")).To(Equal(time.Duration(0)))
+		})
+	})
+})
@@ -0,0 +1,154 @@
+package readiness
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Probe checks a dependency can be used. The portal is not ready when a
+// critical dependency fails, other failures are only reported.
+type Probe struct {
+	Name     string
+	Critical bool
+	Check    func(context.Context) error
+}
+
+// Status is what a probe found. Errors can name internal hosts, so they are
+// logged rather than reported.
+type Status struct {
+	Healthy    bool   `json:"healthy"`
+	Critical   bool   `json:"critical"`
+	Error      string `json:"-"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+type Report struct {
+	Ready        bool              `json:"ready"`
+	CheckedAt    time.Time         `json:"checked_at"`
+	Dependencies map[string]Status `json:"dependencies"`
+}
+
+// Checker runs its probes concurrently, each bounded by Timeout, and reuses
+// their results for CacheTTL so that frequent readiness checks do not load
+// the dependencies. Failed probes are logged to Logger, when set.
+type Checker struct {
+	Probes   []Probe
+	Timeout  time.Duration
+	CacheTTL time.Duration
+	Clock    func() time.Time
+	Logger   *zap.Logger
+
+	mutex  sync.Mutex
+	report *Report
+}
+
+// Check returns the cached report, or probes the dependencies again once it
+// has expired. Concurrent checks wait for the same probes.
+func (checker *Checker) Check(ctx context.Context) Report {
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+
+	if checker.report != nil && checker.now().Sub(checker.report.CheckedAt) < checker.CacheTTL {
+		return *checker.report
+	}
+	report := checker.probe(ctx)
+	checker.report = &report
+	return report
+}
+
+func (checker *Checker) probe(ctx context.Context) Report {
+	// The probes finish even if the request that started them goes, so that
+	// their results can be cached for the next one
+	ctx = context.WithoutCancel(ctx)
+
+	statuses := make([]Status, len(checker.Probes))
+	var waitGroup sync.WaitGroup
+	for i, probe := range checker.Probes {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			statuses[i] = checker.run(ctx, probe)
+		}()
+	}
+	waitGroup.Wait()
+
+	report := Report{Ready: true, CheckedAt: checker.now(), Dependencies: map[string]Status{}}
+	for i, probe := range checker.Probes {
+		report.Dependencies[probe.Name] = statuses[i]
+		if probe.Critical && !statuses[i].Healthy {
+			report.Ready = false
+		}
+		if !statuses[i].Healthy && checker.Logger != nil {
+			checker.Logger.Warn("Readiness check failed",
+				zap.String("Dependency", probe.Name),
+				zap.Bool("Critical", probe.Critical),
+				zap.String("Error", statuses[i].Error),
+			)
+		}
+	}
+	return report
+}
+
+// run gives up on a probe at the timeout even if it does not stop when its
+// context is cancelled
+func (checker *Checker) run(ctx context.Context, probe Probe) Status {
+	ctx, cancel := context.WithTimeout(ctx, checker.Timeout)
+	defer cancel()
+
+	start := checker.now()
+	result := make(chan error, 1)
+	go func() {
+		result <- probe.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", checker.Timeout)
+	}
+
+	status := Status{
+		Healthy:    err == nil,
+		Critical:   probe.Critical,
+		DurationMs: checker.now().Sub(start).Milliseconds(),
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	return status
+}
+
+func (checker *Checker) now() time.Time {
+	if checker.Clock != nil {
+		return checker.Clock().UTC()
+	}
+	return time.Now().UTC()
+}
+
+// HTTPProbe checks an upstream answers requests to url without a server
+// error. Any other response, even a 404, shows the upstream is up. The
+// client should make a single attempt without a circuit breaker, so that
+// probes neither retry nor change how the portal's own calls are made.
+func HTTPProbe(client *http.Client, url string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return err
+		}
+		response, err := client.Do(request)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		if response.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("unexpected status %d", response.StatusCode)
+		}
+		return nil
+	}
+}
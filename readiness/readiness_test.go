@@ -0,0 +1,225 @@
+package readiness_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"github.com/ONSdigital/blaise-cawi-portal/readiness"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Checker", func() {
+	var (
+		checker *readiness.Checker
+		now     time.Time
+		calls   int32
+	)
+
+	counting := func(err error) func(context.Context) error {
+		return func(context.Context) error {
+			atomic.AddInt32(&calls, 1)
+			return err
+		}
+	}
+
+	BeforeEach(func() {
+		now = time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+		calls = 0
+		checker = &readiness.Checker{
+			Timeout:  50 * time.Millisecond,
+			CacheTTL: 10 * time.Second,
+			Clock:    func() time.Time { return now },
+		}
+	})
+
+	Context("when every dependency is healthy", func() {
+		BeforeEach(func() {
+			checker.Probes = []readiness.Probe{
+				{Name: "bus", Critical: true, Check: counting(nil)},
+				{Name: "redis", Critical: true, Check: counting(nil)},
+			}
+		})
+
+		It("is ready", func() {
+			report := checker.Check(context.Background())
+
+			Expect(report.Ready).To(BeTrue())
+			Expect(report.CheckedAt).To(Equal(now))
+			Expect(report.Dependencies).To(HaveLen(2))
+			Expect(report.Dependencies["bus"]).To(Equal(readiness.Status{Healthy: true, Critical: true}))
+		})
+	})
+
+	Context("when a critical dependency fails", func() {
+		BeforeEach(func() {
+			checker.Probes = []readiness.Probe{
+				{Name: "bus", Critical: true, Check: counting(errors.New("connection refused"))},
+				{Name: "redis", Critical: true, Check: counting(nil)},
+			}
+		})
+
+		It("is not ready and reports the failure", func() {
+			report := checker.Check(context.Background())
+
+			Expect(report.Ready).To(BeFalse())
+			Expect(report.Dependencies["bus"].Healthy).To(BeFalse())
+			Expect(report.Dependencies["bus"].Error).To(Equal("connection refused"))
+			Expect(report.Dependencies["redis"].Healthy).To(BeTrue())
+		})
+
+		It("logs the failure rather than reporting it", func() {
+			var observedZapCore zapcore.Core
+			var observedLogs *observer.ObservedLogs
+			observedZapCore, observedLogs = observer.New(zap.InfoLevel)
+			checker.Logger = zap.New(observedZapCore)
+
+			reportJSON, err := json.Marshal(checker.Check(context.Background()))
+			Expect(err).To(BeNil())
+			Expect(string(reportJSON)).ToNot(ContainSubstring("connection refused"))
+
+			Expect(observedLogs.Len()).To(Equal(1))
+			entry := observedLogs.All()[0]
+			Expect(entry.Message).To(Equal("Readiness check failed"))
+			Expect(entry.ContextMap()).To(Equal(map[string]interface{}{
+				"Dependency": "bus",
+				"Critical":   true,
+				"Error":      "connection refused",
+			}))
+		})
+	})
+
+	Context("when an optional dependency fails", func() {
+		BeforeEach(func() {
+			checker.Probes = []readiness.Probe{
+				{Name: "bus", Critical: true, Check: counting(nil)},
+				{Name: "audit", Critical: false, Check: counting(errors.New("unavailable"))},
+			}
+		})
+
+		It("is ready but reports the failure", func() {
+			report := checker.Check(context.Background())
+
+			Expect(report.Ready).To(BeTrue())
+			Expect(report.Dependencies["audit"]).To(Equal(readiness.Status{Error: "unavailable"}))
+		})
+	})
+
+	Context("when a probe does not finish in time", func() {
+		BeforeEach(func() {
+			checker.Clock = nil
+			checker.Probes = []readiness.Probe{
+				{Name: "cati", Critical: true, Check: func(context.Context) error {
+					time.Sleep(time.Second)
+					return nil
+				}},
+			}
+		})
+
+		It("gives up on it at the timeout", func() {
+			start := time.Now()
+			report := checker.Check(context.Background())
+
+			Expect(time.Since(start)).To(BeNumerically("<", 500*time.Millisecond))
+			Expect(report.Ready).To(BeFalse())
+			Expect(report.Dependencies["cati"].Error).To(Equal("timed out after 50ms"))
+		})
+	})
+
+	Context("with several slow probes", func() {
+		BeforeEach(func() {
+			checker.Clock = nil
+			checker.Timeout = time.Second
+			slow := func(context.Context) error {
+				time.Sleep(100 * time.Millisecond)
+				return nil
+			}
+			checker.Probes = []readiness.Probe{
+				{Name: "bus", Critical: true, Check: slow},
+				{Name: "cati", Critical: true, Check: slow},
+				{Name: "redis", Critical: true, Check: slow},
+			}
+		})
+
+		It("runs them concurrently", func() {
+			start := time.Now()
+			report := checker.Check(context.Background())
+
+			Expect(time.Since(start)).To(BeNumerically("<", 250*time.Millisecond))
+			Expect(report.Ready).To(BeTrue())
+		})
+	})
+
+	Describe("caching", func() {
+		BeforeEach(func() {
+			checker.Probes = []readiness.Probe{
+				{Name: "bus", Critical: true, Check: counting(nil)},
+			}
+		})
+
+		It("reuses results until they expire", func() {
+			first := checker.Check(context.Background())
+			now = now.Add(9 * time.Second)
+			Expect(checker.Check(context.Background())).To(Equal(first))
+			Expect(atomic.LoadInt32(&calls)).To(Equal(int32(1)))
+
+			now = now.Add(time.Second)
+			Expect(checker.Check(context.Background()).CheckedAt).To(Equal(now))
+			Expect(atomic.LoadInt32(&calls)).To(Equal(int32(2)))
+		})
+
+		It("finishes the probes when the request is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			report := checker.Check(ctx)
+
+			Expect(report.Ready).To(BeTrue())
+		})
+	})
+})
+
+var _ = Describe("HTTPProbe", func() {
+	var (
+		upstream *httptest.Server
+		status   int
+	)
+
+	BeforeEach(func() {
+		upstream = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			writer.WriteHeader(status)
+		}))
+	})
+
+	AfterEach(func() {
+		upstream.Close()
+	})
+
+	It("passes when the upstream answers", func() {
+		status = http.StatusNotFound
+
+		Expect(readiness.HTTPProbe(upstream.Client(), upstream.URL)(context.Background())).To(Succeed())
+	})
+
+	It("fails on a server error", func() {
+		status = http.StatusBadGateway
+
+		err := readiness.HTTPProbe(upstream.Client(), upstream.URL)(context.Background())
+		Expect(err).To(MatchError("unexpected status 502"))
+	})
+
+	It("fails when the upstream cannot be reached", func() {
+		upstream.Close()
+
+		Expect(readiness.HTTPProbe(upstream.Client(), upstream.URL)(context.Background())).ToNot(Succeed())
+	})
+})
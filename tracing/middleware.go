@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware makes a server span for each request, starting a new trace.
+// Requests come from the public, so a trace the request's headers carry is
+// only linked to, rather than continued, and its sampling decision and any
+// baggage are ignored. The caller's trace headers are removed, so requests
+// proxied to Blaise do not pass them on either. Spans are named by route
+// rather than path, so access codes and case IDs in paths are not recorded
+// in span names.
+func Middleware(context *gin.Context) {
+	route := context.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	options := []trace.SpanStartOption{
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(context.Request.Method),
+			semconv.HTTPRoute(route),
+		),
+	}
+	remote := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(
+		context.Request.Context(), propagation.HeaderCarrier(context.Request.Header)))
+	if remote.IsValid() {
+		options = append(options, trace.WithLinks(trace.Link{SpanContext: remote}))
+	}
+	for _, header := range []string{"traceparent", "tracestate", "baggage"} {
+		context.Request.Header.Del(header)
+	}
+	ctx, span := Start(context.Request.Context(), fmt.Sprintf("%s %s", context.Request.Method, route), options...)
+	defer span.End()
+	context.Request = context.Request.WithContext(ctx)
+
+	context.Next()
+
+	status := context.Writer.Status()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	for _, err := range context.Errors {
+		span.RecordError(err.Err)
+	}
+}
@@ -0,0 +1,197 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/ONSdigital/blaise-cawi-portal/tracing"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+var _ = Describe("Tracing", func() {
+	var recorder *tracetest.SpanRecorder
+
+	BeforeEach(func() {
+		recorder = tracetest.NewSpanRecorder()
+		tracing.Register(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	})
+
+	AfterEach(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+
+	Describe("Middleware", func() {
+		var (
+			httpRouter   *gin.Engine
+			httpRecorder *httptest.ResponseRecorder
+		)
+
+		BeforeEach(func() {
+			httpRouter = gin.New()
+			httpRouter.Use(tracing.Middleware)
+			httpRouter.GET("/:instrumentName/", func(context *gin.Context) {
+				context.Status(http.StatusOK)
+			})
+			httpRouter.GET("/broken", func(context *gin.Context) {
+				_ = context.Error(errors.New("broken"))
+				context.Status(http.StatusInternalServerError)
+			})
+			httpRecorder = httptest.NewRecorder()
+		})
+
+		It("names server spans by route", func() {
+			req, _ := http.NewRequest("GET", "/dst2101a/", nil)
+			httpRouter.ServeHTTP(httpRecorder, req)
+
+			spans := recorder.Ended()
+			Expect(spans).To(HaveLen(1))
+			Expect(spans[0].Name()).To(Equal("GET /:instrumentName/"))
+			Expect(spans[0].SpanKind()).To(Equal(trace.SpanKindServer))
+			Expect(spans[0].Attributes()).To(ContainElement(semconv.HTTPResponseStatusCode(http.StatusOK)))
+			Expect(spans[0].Status().Code).To(Equal(codes.Unset))
+		})
+
+		It("starts a new trace, linked to the trace the request carries", func() {
+			req, _ := http.NewRequest("GET", "/dst2101a/", nil)
+			req.Header.Set("traceparent", traceParent)
+			httpRouter.ServeHTTP(httpRecorder, req)
+
+			spans := recorder.Ended()
+			Expect(spans[0].SpanContext().TraceID().String()).ToNot(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+			Expect(spans[0].Parent().IsValid()).To(BeFalse())
+			Expect(spans[0].Links()).To(HaveLen(1))
+			Expect(spans[0].Links()[0].SpanContext.TraceID().String()).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+			Expect(spans[0].Links()[0].SpanContext.SpanID().String()).To(Equal("00f067aa0ba902b7"))
+		})
+
+		It("ignores the sampling decision the request carries", func() {
+			tracing.Register(sdktrace.NewTracerProvider(
+				sdktrace.WithSpanProcessor(recorder),
+				sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.NeverSample())),
+			))
+			req, _ := http.NewRequest("GET", "/dst2101a/", nil)
+			req.Header.Set("traceparent", traceParent)
+			httpRouter.ServeHTTP(httpRecorder, req)
+
+			Expect(recorder.Ended()).To(BeEmpty())
+		})
+
+		It("does not pass on the baggage the request carries", func() {
+			var header http.Header
+			httpRouter.GET("/forward", func(context *gin.Context) {
+				header = http.Header{}
+				otel.GetTextMapPropagator().Inject(context.Request.Context(), propagation.HeaderCarrier(header))
+			})
+			req, _ := http.NewRequest("GET", "/forward", nil)
+			req.Header.Set("traceparent", traceParent)
+			req.Header.Set("baggage", "user=123456789012")
+			httpRouter.ServeHTTP(httpRecorder, req)
+
+			Expect(header.Get("baggage")).To(BeEmpty())
+			Expect(header.Get("traceparent")).ToNot(ContainSubstring("4bf92f3577b34da6a3ce929d0e0e4736"))
+		})
+
+		It("removes the caller's trace headers from the request", func() {
+			var header http.Header
+			httpRouter.GET("/forward", func(context *gin.Context) {
+				header = context.Request.Header
+			})
+			req, _ := http.NewRequest("GET", "/forward", nil)
+			req.Header.Set("traceparent", traceParent)
+			req.Header.Set("tracestate", "vendor=value")
+			req.Header.Set("baggage", "user=123456789012")
+			httpRouter.ServeHTTP(httpRecorder, req)
+
+			Expect(header).ToNot(HaveKey("Traceparent"))
+			Expect(header).ToNot(HaveKey("Tracestate"))
+			Expect(header).ToNot(HaveKey("Baggage"))
+		})
+
+		It("marks server errors", func() {
+			req, _ := http.NewRequest("GET", "/broken", nil)
+			httpRouter.ServeHTTP(httpRecorder, req)
+
+			spans := recorder.Ended()
+			Expect(spans[0].Status().Code).To(Equal(codes.Error))
+			Expect(spans[0].Events()).To(HaveLen(1))
+		})
+
+		It("does not name spans after paths that were not routed", func() {
+			req, _ := http.NewRequest("GET", "/123456789012/unknown/path", nil)
+			httpRouter.ServeHTTP(httpRecorder, req)
+
+			Expect(recorder.Ended()[0].Name()).To(Equal("GET unmatched"))
+		})
+	})
+
+	Describe("Transport", func() {
+		It("propagates the trace to the upstream", func() {
+			var received string
+			upstream := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				received = request.Header.Get("traceparent")
+			}))
+			defer upstream.Close()
+
+			ctx, span := tracing.Start(context.Background(), "parent")
+			request, _ := http.NewRequestWithContext(ctx, "GET", upstream.URL, nil)
+			client := &http.Client{Transport: tracing.Transport(nil)}
+			response, err := client.Do(request)
+			Expect(err).To(BeNil())
+			response.Body.Close()
+			span.End()
+
+			Expect(received).To(ContainSubstring(span.SpanContext().TraceID().String()))
+			spans := recorder.Ended()
+			Expect(spans).To(HaveLen(2))
+			Expect(spans[0].SpanKind()).To(Equal(trace.SpanKindClient))
+			Expect(spans[0].Parent().SpanID()).To(Equal(span.SpanContext().SpanID()))
+		})
+	})
+
+	Describe("End", func() {
+		It("marks spans that failed", func() {
+			_, span := tracing.Start(context.Background(), "failing")
+			tracing.End(span, errors.New("bus unavailable"))
+
+			spans := recorder.Ended()
+			Expect(spans[0].Status().Code).To(Equal(codes.Error))
+			Expect(spans[0].Status().Description).To(Equal("bus unavailable"))
+		})
+
+		It("leaves spans that succeeded unmarked", func() {
+			_, span := tracing.Start(context.Background(), "working")
+			tracing.End(span, nil)
+
+			Expect(recorder.Ended()[0].Status().Code).To(Equal(codes.Unset))
+		})
+	})
+})
+
+var _ = Describe("NewProvider", func() {
+	It("exports to stdout", func() {
+		provider, err := tracing.NewProvider(context.Background(), "stdout", 1)
+		Expect(err).To(BeNil())
+		Expect(provider.Shutdown(context.Background())).To(Succeed())
+	})
+
+	It("rejects unknown exporters", func() {
+		_, err := tracing.NewProvider(context.Background(), "jaeger", 1)
+		Expect(err).To(MatchError(`unknown trace exporter "jaeger"`))
+	})
+})
@@ -23,3 +23,23 @@ func GetRequestSource(context *gin.Context) []zap.Field {
 
 	return requestSource
 }
+
+// GetClientIP returns the client IP reported by the trusted platform, falling
+// back to the connecting address when there isn't one
+func GetClientIP(context *gin.Context) string {
+	clientIP := context.ClientIP()
+	if clientIP == "" {
+		clientIP = context.Request.RemoteAddr
+	}
+	clientIP = strings.ReplaceAll(clientIP, "\n", "")
+	return strings.ReplaceAll(clientIP, "\r", "")
+}
+
+// CSPNonceKey is where the request's Content-Security-Policy nonce is kept
+const CSPNonceKey = "csp_nonce"
+
+// CSPNonce returns the nonce inline scripts need to run under the request's
+// Content-Security-Policy, or "" when it has none
+func CSPNonce(context *gin.Context) string {
+	return context.GetString(CSPNonceKey)
+}
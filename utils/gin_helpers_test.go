@@ -47,3 +47,51 @@ var _ = Describe("GetRequestSource", func() {
 		})
 	})
 })
+
+var _ = Describe("GetClientIP", func() {
+	var (
+		req     *http.Request
+		context *gin.Context
+		engine  *gin.Engine
+	)
+
+	BeforeEach(func() {
+		req, _ = http.NewRequest("GET", "http://localhost:8000", nil)
+		req.RemoteAddr = "1.1.1.1:1234"
+
+		context, engine = gin.CreateTestContext(httptest.NewRecorder())
+		engine.AppEngine = true
+	})
+
+	Context("When there is no platform client IP", func() {
+		It("Returns the remote IP", func() {
+			context.Request = req
+			Expect(utils.GetClientIP(context)).To(Equal("1.1.1.1"))
+		})
+	})
+
+	Context("When the platform provides a client IP", func() {
+		It("Returns the platform client IP", func() {
+			req.Header.Add("X-Appengine-Remote-Addr", "2.2.2.2")
+			context.Request = req
+			Expect(utils.GetClientIP(context)).To(Equal("2.2.2.2"))
+		})
+	})
+})
+
+var _ = Describe("CSPNonce", func() {
+	var context *gin.Context
+
+	BeforeEach(func() {
+		context, _ = gin.CreateTestContext(httptest.NewRecorder())
+	})
+
+	It("returns the request's nonce", func() {
+		context.Set(utils.CSPNonceKey, "bm9uY2U=")
+		Expect(utils.CSPNonce(context)).To(Equal("bm9uY2U="))
+	})
+
+	It("returns nothing when the request has no nonce", func() {
+		Expect(utils.CSPNonce(context)).To(Equal(""))
+	})
+})
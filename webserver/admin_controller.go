@@ -0,0 +1,93 @@
+package webserver
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/ONSdigital/blaise-cawi-portal/authenticate"
+	"github.com/ONSdigital/blaise-cawi-portal/blaiserestapi"
+	"github.com/ONSdigital/blaise-cawi-portal/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var tokenIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// AdminController serves operational endpoints for support staff. They are
+// only registered when a token is configured, and every request must present
+// it as a bearer token.
+type AdminController struct {
+	Token                   string
+	JWTCrypto               authenticate.JWTCryptoInterface
+	InstrumentSettingsCache blaiserestapi.InstrumentSettingsCacheInterface
+	Logger                  *zap.Logger
+}
+
+func (adminController *AdminController) AddRoutes(httpRouter *gin.Engine) {
+	if adminController.Token == "" {
+		return
+	}
+	adminGroup := httpRouter.Group("/admin")
+	adminGroup.Use(adminController.Authorised)
+	{
+		adminGroup.POST("/sessions/:token_id/revoke", adminController.RevokeSessionEndpoint)
+		if adminController.InstrumentSettingsCache != nil {
+			adminGroup.GET("/instrument-settings-cache", adminController.InstrumentSettingsCacheEndpoint)
+			adminGroup.DELETE("/instrument-settings-cache/:instrumentName", adminController.InvalidateInstrumentSettingsEndpoint)
+		}
+	}
+}
+
+func (adminController *AdminController) Authorised(context *gin.Context) {
+	if !bearerTokenValid(context, adminController.Token) {
+		adminController.Logger.Warn("Unauthorised admin request", utils.GetRequestSource(context)...)
+		context.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	context.Next()
+}
+
+// bearerTokenValid checks the request presents token as its bearer token
+func bearerTokenValid(context *gin.Context, token string) bool {
+	presented := strings.TrimPrefix(context.GetHeader("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1
+}
+
+// RevokeSessionEndpoint denies a session token by the TokenID it was logged with
+func (adminController *AdminController) RevokeSessionEndpoint(context *gin.Context) {
+	tokenID := context.Param("token_id")
+	if !tokenIDPattern.MatchString(tokenID) {
+		context.Status(http.StatusBadRequest)
+		return
+	}
+	if err := adminController.JWTCrypto.RevokeTokenID(context.Request.Context(), tokenID); err != nil {
+		adminController.Logger.Error("Failed to revoke JWT", append(utils.GetRequestSource(context),
+			zap.String("TokenID", tokenID),
+			zap.Error(err),
+		)...)
+		context.Status(http.StatusInternalServerError)
+		return
+	}
+	adminController.Logger.Info("Revoked JWT", append(utils.GetRequestSource(context),
+		zap.String("TokenID", tokenID),
+	)...)
+	context.Status(http.StatusNoContent)
+}
+
+// InstrumentSettingsCacheEndpoint reports how the instrument settings cache is performing
+func (adminController *AdminController) InstrumentSettingsCacheEndpoint(context *gin.Context) {
+	context.JSON(http.StatusOK, adminController.InstrumentSettingsCache.Stats())
+}
+
+// InvalidateInstrumentSettingsEndpoint makes the next login for an instrument
+// fetch its settings from the REST API, e.g. after it has been reinstalled
+func (adminController *AdminController) InvalidateInstrumentSettingsEndpoint(context *gin.Context) {
+	instrumentName := context.Param("instrumentName")
+	adminController.InstrumentSettingsCache.Invalidate(instrumentName)
+	adminController.Logger.Info("Invalidated cached instrument settings", append(utils.GetRequestSource(context),
+		zap.String("InstrumentName", instrumentName),
+	)...)
+	context.Status(http.StatusNoContent)
+}
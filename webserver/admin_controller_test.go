@@ -0,0 +1,147 @@
+package webserver_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/ONSdigital/blaise-cawi-portal/authenticate/mocks"
+	"github.com/ONSdigital/blaise-cawi-portal/blaiserestapi"
+	blaiserestapimocks "github.com/ONSdigital/blaise-cawi-portal/blaiserestapi/mocks"
+	"github.com/ONSdigital/blaise-cawi-portal/webserver"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Admin Controller", func() {
+	var (
+		httpRouter                  *gin.Engine
+		httpRecorder                *httptest.ResponseRecorder
+		mockJWTCrypto               *mocks.JWTCryptoInterface
+		mockInstrumentSettingsCache *blaiserestapimocks.InstrumentSettingsCacheInterface
+		adminController             *webserver.AdminController
+		authorization               string
+		method                      string
+		path                        string
+		tokenID                     = "0123456789abcdef0123456789abcdef"
+	)
+
+	BeforeEach(func() {
+		httpRouter = gin.Default()
+		mockJWTCrypto = &mocks.JWTCryptoInterface{}
+		mockInstrumentSettingsCache = &blaiserestapimocks.InstrumentSettingsCacheInterface{}
+		adminController = &webserver.AdminController{
+			Token:                   "admin-token",
+			JWTCrypto:               mockJWTCrypto,
+			InstrumentSettingsCache: mockInstrumentSettingsCache,
+			Logger:                  zap.NewNop(),
+		}
+		authorization = "Bearer admin-token"
+		method = "POST"
+		path = fmt.Sprintf("/admin/sessions/%s/revoke", tokenID)
+	})
+
+	JustBeforeEach(func() {
+		adminController.AddRoutes(httpRouter)
+		httpRecorder = httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", authorization)
+		httpRouter.ServeHTTP(httpRecorder, req)
+	})
+
+	Describe("POST /admin/sessions/:token_id/revoke", func() {
+		Context("with the admin token", func() {
+			BeforeEach(func() {
+				mockJWTCrypto.On("RevokeTokenID", mock.Anything, tokenID).Return(nil)
+			})
+
+			It("revokes the token", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusNoContent))
+				mockJWTCrypto.AssertCalled(GinkgoT(), "RevokeTokenID", mock.Anything, tokenID)
+			})
+		})
+
+		Context("when the token cannot be revoked", func() {
+			BeforeEach(func() {
+				mockJWTCrypto.On("RevokeTokenID", mock.Anything, tokenID).Return(fmt.Errorf("redis down"))
+			})
+
+			It("returns an error", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusInternalServerError))
+			})
+		})
+
+		Context("with the wrong admin token", func() {
+			BeforeEach(func() {
+				authorization = "Bearer wrong-token"
+			})
+
+			It("returns unauthorized", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusUnauthorized))
+				mockJWTCrypto.AssertNotCalled(GinkgoT(), "RevokeTokenID", mock.Anything, tokenID)
+			})
+		})
+
+		Context("when no admin token is configured", func() {
+			BeforeEach(func() {
+				adminController.Token = ""
+				authorization = "Bearer "
+			})
+
+			It("is not routed", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusNotFound))
+			})
+		})
+	})
+
+	Describe("GET /admin/instrument-settings-cache", func() {
+		BeforeEach(func() {
+			method = "GET"
+			path = "/admin/instrument-settings-cache"
+			mockInstrumentSettingsCache.On("Stats").Return(blaiserestapi.CacheStats{Entries: 2, Hits: 10, Misses: 3})
+		})
+
+		It("returns the cache stats", func() {
+			Expect(httpRecorder.Code).To(Equal(http.StatusOK))
+			Expect(httpRecorder.Body.String()).To(MatchJSON(`{"entries":2,"hits":10,"misses":3,"coalesced":0,"stale":0,"errors":0,"evicted":0}`))
+		})
+
+		Context("when the cache is disabled", func() {
+			BeforeEach(func() {
+				adminController.InstrumentSettingsCache = nil
+			})
+
+			It("is not routed", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusNotFound))
+			})
+		})
+	})
+
+	Describe("DELETE /admin/instrument-settings-cache/:instrumentName", func() {
+		BeforeEach(func() {
+			method = "DELETE"
+			path = "/admin/instrument-settings-cache/dst2101a"
+			mockInstrumentSettingsCache.On("Invalidate", "dst2101a").Return()
+		})
+
+		It("invalidates the instrument's settings", func() {
+			Expect(httpRecorder.Code).To(Equal(http.StatusNoContent))
+			mockInstrumentSettingsCache.AssertCalled(GinkgoT(), "Invalidate", "dst2101a")
+		})
+
+		Context("with the wrong admin token", func() {
+			BeforeEach(func() {
+				authorization = "Bearer wrong-token"
+			})
+
+			It("returns unauthorized", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusUnauthorized))
+				mockInstrumentSettingsCache.AssertNotCalled(GinkgoT(), "Invalidate", "dst2101a")
+			})
+		})
+	})
+})
@@ -6,6 +6,7 @@ import (
 
 	"github.com/ONSdigital/blaise-cawi-portal/authenticate"
 	"github.com/ONSdigital/blaise-cawi-portal/languagemanager"
+	"github.com/ONSdigital/blaise-cawi-portal/utils"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	csrf "github.com/srbry/gin-csrf"
@@ -15,7 +16,7 @@ import (
 type AuthController struct {
 	Auth            authenticate.AuthInterface
 	Logger          *zap.Logger
-	UacKind         string
+	UacKinds        authenticate.UacKinds
 	CSRFManager     csrf.CSRFManager
 	LanguageManager languagemanager.LanguageManagerInterface
 }
@@ -29,11 +30,17 @@ func (authController *AuthController) AddRoutes(httpRouter *gin.Engine) {
 		authGroup.GET("/logout", authController.LogoutEndpoint)
 		authGroup.GET("/logged-in", authController.LoggedInEndpoint)
 		authGroup.GET("/timed-out", authController.TimedOutEndpoint)
+		authGroup.GET("/select-case", authController.Auth.AuthenticatedWithUac, authController.CaseSelectionEndpoint)
+		authGroup.POST("/select-case", authController.Auth.AuthenticatedWithUac, authController.PostCaseSelectionEndpoint)
 	}
 }
 
 func (authController *AuthController) LoginEndpoint(context *gin.Context) {
 	hasSession, claim := authController.Auth.HasSession(context)
+	if hasSession && claim.UacInfo.Household() {
+		context.Redirect(http.StatusTemporaryRedirect, authenticate.CASE_SELECTION_URL)
+		return
+	}
 	if hasSession {
 		context.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("/%s/", claim.UacInfo.InstrumentName))
 		return
@@ -49,9 +56,10 @@ func (authController *AuthController) LoginEndpoint(context *gin.Context) {
 	}
 
 	context.HTML(http.StatusOK, "login.tmpl", gin.H{
-		"uac16":      authController.isUac16(),
+		"uac_kinds":  authController.UacKinds,
 		"csrf_token": authController.CSRFManager.GetToken(context),
 		"welsh":      authController.LanguageManager.IsWelsh(context),
+		"csp_nonce":  utils.CSPNonce(context),
 	})
 }
 
@@ -61,6 +69,16 @@ func (authController *AuthController) PostLoginEndpoint(context *gin.Context) {
 	authController.Auth.Login(context, session)
 }
 
+func (authController *AuthController) CaseSelectionEndpoint(context *gin.Context) {
+	authController.Auth.CaseSelection(context)
+}
+
+func (authController *AuthController) PostCaseSelectionEndpoint(context *gin.Context) {
+	session := sessions.DefaultMany(context, "user_session")
+
+	authController.Auth.SelectCase(context, session)
+}
+
 func (authController *AuthController) LogoutEndpoint(context *gin.Context) {
 	session := sessions.DefaultMany(context, "user_session")
 
@@ -87,12 +105,26 @@ func (authController *AuthController) TimedOutEndpoint(context *gin.Context) {
 		timeout = authenticate.DefaultAuthTimeout
 	}
 
+	signedInElsewhere := authController.Auth.SignedInElsewhere(context)
+	// The page can be asked for at any time, so a session whose token is still
+	// live is ended as if the respondent signed out, not as a timeout
+	sessionEnd := authenticate.SessionTimedOut
+	if live, _ := authController.Auth.HasSession(context); live {
+		sessionEnd = authenticate.SessionQuit
+	}
+	if err := authController.Auth.EndSession(context, session, sessionEnd); err != nil {
+		authController.Logger.Error("Failed to end timed out session", zap.Error(err))
+	}
+	if signedInElsewhere {
+		context.HTML(http.StatusOK, "signed_in_elsewhere.tmpl", gin.H{
+			"welsh": authController.LanguageManager.IsWelsh(context),
+		})
+		return
+	}
+
 	context.HTML(http.StatusOK, "timeout.tmpl", gin.H{
-		"timeout": timeout,
-		"welsh":   authController.LanguageManager.IsWelsh(context),
+		"timeout":      timeout,
+		"max_lifetime": context.Query("reason") == "max-lifetime",
+		"welsh":        authController.LanguageManager.IsWelsh(context),
 	})
 }
-
-func (authController *AuthController) isUac16() bool {
-	return authController.UacKind == "uac16"
-}
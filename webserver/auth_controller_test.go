@@ -38,7 +38,7 @@ var _ = Describe("Auth Controller", func() {
 		authController      = &webserver.AuthController{
 			Auth:            mockAuth,
 			CSRFManager:     csrfManager,
-			UacKind:         "uac",
+			UacKinds:        authenticate.UacKinds{authenticate.Uac12},
 			LanguageManager: languageManagerMock,
 		}
 		instrumentName  = "foobar"
@@ -46,7 +46,7 @@ var _ = Describe("Auth Controller", func() {
 		observedLogs    *observer.ObservedLogs
 		observedLogger  *zap.Logger
 		observedZapCore zapcore.Core
-		config          = &webserver.Config{UacKind: "uac16"}
+		config          = &webserver.Config{UacKind: authenticate.UacKinds{authenticate.Uac16}}
 	)
 
 	BeforeEach(func() {
@@ -140,6 +140,52 @@ var _ = Describe("Auth Controller", func() {
 		})
 	})
 
+	Describe("GET /auth/login with a household session", func() {
+		It("redirects to the case selection page", func() {
+			mockAuth.On("HasSession", mock.Anything).Return(true, &authenticate.UACClaims{UacInfo: busapi.UacInfo{
+				Cases: []busapi.UacCase{
+					{InstrumentName: instrumentName, CaseID: caseID},
+					{InstrumentName: instrumentName, CaseID: "other"},
+				},
+			}}, nil)
+
+			httpRecorder := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/auth/login", nil)
+			httpRouter.ServeHTTP(httpRecorder, req)
+
+			Expect(httpRecorder.Code).To(Equal(http.StatusTemporaryRedirect))
+			Expect(httpRecorder.Header().Get("Location")).To(Equal(authenticate.CASE_SELECTION_URL))
+		})
+	})
+
+	Describe("/auth/select-case", func() {
+		BeforeEach(func() {
+			mockAuth.On("AuthenticatedWithUac", mock.Anything).Return()
+			mockAuth.On("CaseSelection", mock.Anything).Return()
+			mockAuth.On("SelectCase", mock.Anything, mock.Anything).Return()
+		})
+
+		It("shows the case selection page", func() {
+			httpRecorder := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/auth/select-case", nil)
+			httpRouter.ServeHTTP(httpRecorder, req)
+
+			mockAuth.AssertNumberOfCalls(GinkgoT(), "AuthenticatedWithUac", 1)
+			mockAuth.AssertNumberOfCalls(GinkgoT(), "CaseSelection", 1)
+		})
+
+		It("requires a CSRF token to choose a case", func() {
+			languageManagerMock.On("IsWelsh", mock.Anything).Return(false)
+			httpRecorder := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/auth/select-case", strings.NewReader("case=1"))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			httpRouter.ServeHTTP(httpRecorder, req)
+
+			Expect(httpRecorder.Code).To(Equal(http.StatusForbidden))
+			mockAuth.AssertNotCalled(GinkgoT(), "SelectCase", mock.Anything, mock.Anything)
+		})
+	})
+
 	Describe("POST /auth/login", func() {
 		var (
 			httpRecorder *httptest.ResponseRecorder
@@ -254,8 +300,8 @@ var _ = Describe("Auth Controller", func() {
 
 			Context("Login with a 12 digit UAC kind", func() {
 				BeforeEach(func() {
-					authController.UacKind = "uac"
-					config.UacKind = "uac"
+					authController.UacKinds = authenticate.UacKinds{authenticate.Uac12}
+					config.UacKind = authenticate.UacKinds{authenticate.Uac12}
 				})
 
 				It("states a 12-digit access code is required", func() {
@@ -266,8 +312,8 @@ var _ = Describe("Auth Controller", func() {
 
 			Context("Login with a 16 character UAC kind", func() {
 				BeforeEach(func() {
-					authController.UacKind = "uac16"
-					config.UacKind = "uac16"
+					authController.UacKinds = authenticate.UacKinds{authenticate.Uac16}
+					config.UacKind = authenticate.UacKinds{authenticate.Uac16}
 				})
 
 				It("states a 16-character access code is required", func() {
@@ -333,13 +379,25 @@ var _ = Describe("Auth Controller", func() {
 
 	Describe("Get /auth/timed-out", func() {
 		var (
-			httpRecorder *httptest.ResponseRecorder
+			httpRecorder      *httptest.ResponseRecorder
+			signedInElsewhere bool
+			live              bool
+			timedOutPath      string
 		)
 
+		BeforeEach(func() {
+			signedInElsewhere = false
+			live = false
+			timedOutPath = "/auth/timed-out"
+		})
+
 		JustBeforeEach(func() {
 			languageManagerMock.On("SetWelsh", mock.Anything, mock.Anything).Return()
+			mockAuth.On("SignedInElsewhere", mock.Anything).Return(signedInElsewhere)
+			mockAuth.On("HasSession", mock.Anything).Return(live, nil)
+			mockAuth.On("EndSession", mock.Anything, mock.Anything, mock.Anything).Return(nil)
 			httpRecorder = httptest.NewRecorder()
-			req, _ := http.NewRequest("GET", "/auth/timed-out", nil)
+			req, _ := http.NewRequest("GET", timedOutPath, nil)
 			httpRouter.ServeHTTP(httpRecorder, req)
 		})
 
@@ -355,6 +413,23 @@ var _ = Describe("Auth Controller", func() {
 				Expect(body).To(ContainSubstring(`This is because you've been inactive for 15 minutes and your session has timed out to protect your information.`))
 				Expect(body).To(ContainSubstring(`You need to <a href="/">sign back in</a> to continue your study.`))
 			})
+
+			It("ends the session as timed out", func() {
+				mockAuth.AssertCalled(GinkgoT(), "EndSession", mock.Anything, mock.Anything, authenticate.SessionTimedOut)
+			})
+		})
+
+		Context("when the session's token has not expired", func() {
+			BeforeEach(func() {
+				live = true
+				languageManagerMock.On("IsWelsh", mock.Anything).Return(false)
+			})
+
+			It("ends the session as if the respondent signed out", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusOK))
+				mockAuth.AssertCalled(GinkgoT(), "EndSession", mock.Anything, mock.Anything, authenticate.SessionQuit)
+				mockAuth.AssertNotCalled(GinkgoT(), "EndSession", mock.Anything, mock.Anything, authenticate.SessionTimedOut)
+			})
 		})
 
 		Context("in welsh", func() {
@@ -370,5 +445,35 @@ var _ = Describe("Auth Controller", func() {
 				Expect(body).To(ContainSubstring(`Bydd angen i chi <a href="/">fewngofnodi eto</a> i barhau â'ch astudiaeth.`))
 			})
 		})
+
+		Context("when the session reached its maximum lifetime", func() {
+			BeforeEach(func() {
+				timedOutPath = "/auth/timed-out?reason=max-lifetime"
+				languageManagerMock.On("IsWelsh", mock.Anything).Return(false)
+			})
+
+			It("explains the session reached its time limit", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusOK))
+				body := httpRecorder.Body.String()
+				Expect(body).To(ContainSubstring(`Sorry, you need to sign in again`))
+				Expect(body).To(ContainSubstring(`This is because your session has reached its time limit to protect your information.`))
+				Expect(body).ToNot(ContainSubstring(`inactive for`))
+			})
+		})
+
+		Context("when the session was replaced by a sign in on another device", func() {
+			BeforeEach(func() {
+				signedInElsewhere = true
+				languageManagerMock.On("IsWelsh", mock.Anything).Return(false)
+			})
+
+			It("returns the signed in elsewhere page", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusOK))
+				body := httpRecorder.Body.String()
+				Expect(body).To(ContainSubstring(`You have signed in on another device`))
+				Expect(body).ToNot(ContainSubstring(`Sorry, you need to sign in again`))
+				mockAuth.AssertCalled(GinkgoT(), "EndSession", mock.Anything, mock.Anything, authenticate.SessionTimedOut)
+			})
+		})
 	})
 })
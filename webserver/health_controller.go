@@ -3,6 +3,7 @@ package webserver
 import (
 	"net/http"
 
+	"github.com/ONSdigital/blaise-cawi-portal/readiness"
 	"github.com/gin-gonic/gin"
 )
 
@@ -11,12 +12,18 @@ type Health struct {
 	Version string `json:"version,omitempty"`
 }
 
+// HealthController serves /health, which only shows the portal is running,
+// and /ready, which checks the portal's dependencies can be used
 type HealthController struct {
+	Readiness *readiness.Checker
 }
 
 func (healthController *HealthController) AddRoutes(httpRouter *gin.Engine) {
 	httpRouter.GET("/health", healthController.HealthEndpoint)
 	httpRouter.GET("/cawi-portal/:version/health", healthController.HealthEndpoint)
+	if healthController.Readiness != nil {
+		httpRouter.GET("/ready", healthController.ReadyEndpoint)
+	}
 	httpRouter.GET("/_ah/*command", func(context *gin.Context) {
 		command := context.Param("command")
 		context.JSON(http.StatusOK, command)
@@ -27,3 +34,15 @@ func (healthController *HealthController) HealthEndpoint(context *gin.Context) {
 	version := context.Param("version")
 	context.JSON(http.StatusOK, Health{Healthy: true, Version: version})
 }
+
+// ReadyEndpoint reports each dependency's status, with a 503 when a critical
+// dependency cannot be used
+func (healthController *HealthController) ReadyEndpoint(context *gin.Context) {
+	report := healthController.Readiness.Check(context.Request.Context())
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	context.Header("Cache-Control", "no-store")
+	context.JSON(status, report)
+}
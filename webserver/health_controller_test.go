@@ -0,0 +1,103 @@
+package webserver_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/ONSdigital/blaise-cawi-portal/readiness"
+	"github.com/ONSdigital/blaise-cawi-portal/webserver"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Health Controller", func() {
+	var (
+		httpRouter       *gin.Engine
+		httpRecorder     *httptest.ResponseRecorder
+		healthController *webserver.HealthController
+		redisErr         error
+	)
+
+	BeforeEach(func() {
+		httpRouter = gin.Default()
+		redisErr = nil
+		healthController = &webserver.HealthController{
+			Readiness: &readiness.Checker{
+				Probes: []readiness.Probe{
+					{Name: "redis", Critical: true, Check: func(context.Context) error { return redisErr }},
+				},
+				Timeout: time.Second,
+			},
+		}
+		httpRecorder = httptest.NewRecorder()
+	})
+
+	JustBeforeEach(func() {
+		healthController.AddRoutes(httpRouter)
+	})
+
+	Describe("GET /health", func() {
+		BeforeEach(func() {
+			redisErr = errors.New("connection refused")
+		})
+
+		It("reports the portal is running regardless of its dependencies", func() {
+			req, _ := http.NewRequest("GET", "/health", nil)
+			httpRouter.ServeHTTP(httpRecorder, req)
+
+			Expect(httpRecorder.Code).To(Equal(http.StatusOK))
+			Expect(httpRecorder.Body.String()).To(Equal(`{"healthy":true}`))
+		})
+	})
+
+	Describe("GET /ready", func() {
+		var report readiness.Report
+
+		JustBeforeEach(func() {
+			req, _ := http.NewRequest("GET", "/ready", nil)
+			httpRouter.ServeHTTP(httpRecorder, req)
+			Expect(json.Unmarshal(httpRecorder.Body.Bytes(), &report)).To(Succeed())
+		})
+
+		Context("when the dependencies are healthy", func() {
+			It("returns ok with each dependency's status", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusOK))
+				Expect(httpRecorder.Header().Get("Cache-Control")).To(Equal("no-store"))
+				Expect(report.Ready).To(BeTrue())
+				Expect(report.Dependencies["redis"].Healthy).To(BeTrue())
+			})
+		})
+
+		Context("when a critical dependency fails", func() {
+			BeforeEach(func() {
+				redisErr = errors.New("connection refused")
+			})
+
+			It("returns service unavailable", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(report.Ready).To(BeFalse())
+				Expect(report.Dependencies["redis"].Healthy).To(BeFalse())
+				Expect(httpRecorder.Body.String()).ToNot(ContainSubstring("connection refused"))
+			})
+		})
+	})
+
+	Context("without a readiness checker", func() {
+		BeforeEach(func() {
+			healthController.Readiness = nil
+		})
+
+		It("does not serve /ready", func() {
+			req, _ := http.NewRequest("GET", "/ready", nil)
+			httpRouter.ServeHTTP(httpRecorder, req)
+
+			Expect(httpRecorder.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+})
@@ -3,6 +3,7 @@ package webserver
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime"
@@ -10,13 +11,21 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"time"
 	"unicode"
 
+	"github.com/ONSdigital/blaise-cawi-portal/audit"
 	"github.com/ONSdigital/blaise-cawi-portal/authenticate"
 	"github.com/ONSdigital/blaise-cawi-portal/blaise"
 	"github.com/ONSdigital/blaise-cawi-portal/languagemanager"
+	"github.com/ONSdigital/blaise-cawi-portal/metrics"
+	"github.com/ONSdigital/blaise-cawi-portal/outbound"
+	"github.com/ONSdigital/blaise-cawi-portal/tracing"
+	"github.com/ONSdigital/blaise-cawi-portal/utils"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"golang.org/x/net/html"
 )
@@ -29,11 +38,17 @@ type InstrumentController struct {
 	HttpClient      *http.Client
 	Debug           bool
 	LanguageManager languagemanager.LanguageManagerInterface
+	// Which other instruments a UAC for an instrument may access
+	LinkedInstruments authenticate.LinkedInstrumentRules
+	Auditor           *audit.Auditor
+	Metrics           *metrics.Metrics
+	// Further script-src sources Blaise's pages need, on top of the portal's
+	ScriptSources []string
 }
 
 func (instrumentController *InstrumentController) AddRoutes(httpRouter *gin.Engine) {
 	instrumentRouter := httpRouter.Group("/:instrumentName")
-	instrumentRouter.Use(instrumentController.Auth.AuthenticatedWithUac)
+	instrumentRouter.Use(instrumentController.contentSecurityPolicy, instrumentController.Auth.AuthenticatedWithUac)
 	{
 		instrumentRouter.GET("/", instrumentController.openCase)
 		// Example path /dst2101a/resources/js/jskdjasjdlkasjld.js
@@ -49,6 +64,13 @@ func (instrumentController *InstrumentController) AddRoutes(httpRouter *gin.Engi
 	httpRouter.GET("/:instrumentName/logout", instrumentController.logoutEndpoint)
 }
 
+// contentSecurityPolicy gives every Blaise page, opened or proxied, the same
+// policy, which also allows ScriptSources
+func (instrumentController *InstrumentController) contentSecurityPolicy(context *gin.Context) {
+	context.Header("Content-Security-Policy", ContentSecurityPolicy(utils.CSPNonce(context), instrumentController.ScriptSources...))
+	context.Next()
+}
+
 func sanitizeLogInput(input string) string {
 	escapedInput := html.EscapeString(input)
 	escapedInput = strings.ReplaceAll(escapedInput, "\n", "")
@@ -65,17 +87,23 @@ func sanitizeLogInput(input string) string {
 func (instrumentController *InstrumentController) instrumentAuth(context *gin.Context) (*authenticate.UACClaims, error) {
 	session := sessions.DefaultMany(context, "user_session")
 	jwtToken := session.Get(authenticate.JWT_TOKEN_KEY)
-	uacClaim, err := instrumentController.JWTCrypto.DecryptJWT(jwtToken)
+	uacClaim, err := instrumentController.JWTCrypto.DecryptJWT(context.Request.Context(), jwtToken)
 	if err != nil {
 		instrumentController.Logger.Error("Error decrypting JWT", zap.Error(err))
 		instrumentController.Auth.NotAuthWithError(context, instrumentController.LanguageManager.LanguageError(authenticate.INTERNAL_SERVER_ERR, context))
 		return nil, err
 	}
+	if uacClaim.CaseSelectionRequired() {
+		context.Redirect(http.StatusFound, authenticate.CASE_SELECTION_URL)
+		context.Abort()
+		return nil, fmt.Errorf("Case selection required")
+	}
 	instrumentName := context.Param("instrumentName")
 	sanitizedInstrumentName := sanitizeLogInput(instrumentName)
-	if !uacClaim.AuthenticatedForInstrument(instrumentName) {
+	if !uacClaim.AuthenticatedForInstrument(instrumentName, instrumentController.LinkedInstruments) {
 		instrumentController.Logger.Info("Not authenticated for instrument",
 			append(uacClaim.LogFields(), zap.String("InstrumentName", sanitizedInstrumentName))...)
+		instrumentController.auditForbidden(context, uacClaim, "Not authenticated for instrument")
 		authenticate.Forbidden(context, instrumentController.LanguageManager.IsWelsh(context))
 		return nil, fmt.Errorf("Forbidden")
 	}
@@ -90,15 +118,34 @@ func (instrumentController *InstrumentController) openCase(context *gin.Context)
 	if err != nil {
 		return
 	}
-	resp, err := http.PostForm(
+	defer instrumentController.observeProxy(context, "open", time.Now())
+	ctx, span := tracing.Start(context.Request.Context(), "CATI open case",
+		trace.WithAttributes(attribute.String("instrument.name", uacClaim.UacInfo.InstrumentName)))
+	defer span.End()
+	req, err := http.NewRequestWithContext(ctx, "POST",
 		fmt.Sprintf("%s/%s/default.aspx", instrumentController.CatiUrl, uacClaim.UacInfo.InstrumentName),
-		blaise.CasePayload(uacClaim.UacInfo.CaseID, instrumentController.LanguageManager.IsWelsh(context)).Form(),
+		strings.NewReader(blaise.CasePayload(uacClaim.UacInfo.CaseID, instrumentController.LanguageManager.IsWelsh(context)).Form().Encode()),
 	)
 	if err != nil {
 		instrumentController.Logger.Error("Error launching blaise study", append(uacClaim.LogFields(), zap.Error(err))...)
 		InternalServerError(context, instrumentController.LanguageManager.IsWelsh(context))
 		return
 	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := instrumentController.HttpClient.Do(req)
+	if err != nil {
+		tracing.Fail(span, err)
+	}
+	if errors.Is(err, outbound.ErrCircuitOpen) {
+		instrumentController.Logger.Warn("Error launching blaise study, CATI unavailable", append(uacClaim.LogFields(), zap.Error(err))...)
+		authenticate.ServiceUnavailable(context, instrumentController.LanguageManager.IsWelsh(context))
+		return
+	}
+	if err != nil {
+		instrumentController.Logger.Error("Error launching blaise study", append(uacClaim.LogFields(), zap.Error(err))...)
+		InternalServerError(context, instrumentController.LanguageManager.IsWelsh(context))
+		return
+	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -111,6 +158,7 @@ func (instrumentController *InstrumentController) openCase(context *gin.Context)
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		tracing.Fail(span, fmt.Errorf("unexpected status %d from CATI", resp.StatusCode))
 		instrumentController.Logger.Error("Error launching blaise study, invalid status code",
 			append(uacClaim.LogFields(),
 				zap.Int("RespStatusCode", resp.StatusCode),
@@ -122,7 +170,7 @@ func (instrumentController *InstrumentController) openCase(context *gin.Context)
 
 	if getContentType(resp) == "text/html" {
 		var buf bytes.Buffer
-		injectedBody, err := InjectScript(body)
+		injectedBody, err := InjectScript(body, utils.CSPNonce(context))
 		if err == nil {
 			err = html.Render(&buf, injectedBody)
 			if err == nil {
@@ -147,6 +195,7 @@ func (instrumentController *InstrumentController) proxyWithInstrumentAuth(contex
 	}
 	path := context.Param("path")
 	resource := context.Param("resource")
+	defer instrumentController.observeProxy(context, proxyPathClass(context), time.Now())
 	if isStartInterviewUrl(path, resource) {
 		if instrumentController.startInterviewAuth(context, uacClaim) {
 			return
@@ -179,6 +228,7 @@ func (instrumentController *InstrumentController) startInterviewAuth(context *gi
 		sanitizedCaseID := sanitizeLogInput(startInterview.RuntimeParameters.KeyValue)
 		instrumentController.Logger.Info("Not authenticated to start interview for case",
 			append(uacClaim.LogFields(), zap.String("CaseID", sanitizedCaseID))...)
+		instrumentController.auditForbidden(context, uacClaim, "Not authenticated to start interview for case")
 		authenticate.Forbidden(context, instrumentController.LanguageManager.IsWelsh(context))
 		return true
 	}
@@ -186,6 +236,12 @@ func (instrumentController *InstrumentController) startInterviewAuth(context *gi
 	return false
 }
 
+func (instrumentController *InstrumentController) auditForbidden(context *gin.Context, uacClaim *authenticate.UACClaims, reason string) {
+	event := authenticate.AuditEvent(audit.Forbidden, uacClaim)
+	event.Reason = reason
+	authenticate.Audit(instrumentController.Auditor, context, event, uacClaim.UacInfo.CaseID)
+}
+
 func (instrumentController *InstrumentController) proxy(context *gin.Context, uacClaim *authenticate.UACClaims) {
 	remote, err := url.Parse(instrumentController.CatiUrl)
 	if err != nil {
@@ -196,13 +252,27 @@ func (instrumentController *InstrumentController) proxy(context *gin.Context, ua
 
 	proxy := httputil.NewSingleHostReverseProxy(remote)
 
+	var transport http.RoundTripper
 	if instrumentController.Debug {
-		proxy.Transport = &debugTransport{Logger: instrumentController.Logger}
+		transport = &debugTransport{Logger: instrumentController.Logger}
+	}
+	proxy.Transport = tracing.Transport(transport)
+	// Only the portal's policy applies, rather than it and any Blaise sets
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		resp.Header.Del("Content-Security-Policy")
+		return nil
 	}
 
 	proxy.ServeHTTP(context.Writer, context.Request)
 }
 
+// observeProxy records a request the respondent is authenticated for, so the
+// instrument names recorded are only ones they can access
+func (instrumentController *InstrumentController) observeProxy(context *gin.Context, pathClass string, start time.Time) {
+	instrumentController.Metrics.ProxyRequest(strings.ToLower(context.Param("instrumentName")), pathClass,
+		context.Writer.Status(), time.Since(start))
+}
+
 func (instrumentController *InstrumentController) logoutEndpoint(context *gin.Context) {
 	session := sessions.DefaultMany(context, "user_session")
 	instrumentController.Auth.Logout(context, session)
@@ -219,6 +289,17 @@ func isAPICall(context *gin.Context) bool {
 		strings.Contains(path, "/api/") || strings.Contains(resource, "/api/")
 }
 
+// proxyPathClass groups proxied paths into a few kinds for metrics
+func proxyPathClass(context *gin.Context) string {
+	switch {
+	case isStartInterviewUrl(context.Param("path"), context.Param("resource")):
+		return "start_interview"
+	case isAPICall(context):
+		return "api"
+	}
+	return "resource"
+}
+
 type debugTransport struct {
 	Logger *zap.Logger
 }
@@ -232,15 +313,21 @@ func (debugTransport *debugTransport) RoundTrip(r *http.Request) (*http.Response
 	return http.DefaultTransport.RoundTrip(r)
 }
 
-func InjectScript(body []byte) (*html.Node, error) {
-	fmt.Println("Inject Script")
+// InjectScript adds the check-session script to the end of the page's body.
+// When the Content-Security-Policy has a nonce, it is given to that script and
+// to the page's own inline scripts, which would otherwise be blocked.
+func InjectScript(body []byte, nonce string) (*html.Node, error) {
 	doc, err := html.Parse(bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
+	injected := false
 	var crawler func(*html.Node)
 	crawler = func(node *html.Node) {
-		if node.Type == html.ElementNode && node.Data == "body" {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			crawler(child)
+		}
+		if node.Type == html.ElementNode && node.Data == "body" && !injected {
 			scriptNode := &html.Node{
 				Type: html.ElementNode,
 				Data: "script",
@@ -248,11 +335,11 @@ func InjectScript(body []byte) (*html.Node, error) {
 					{Key: "src", Val: "/assets/js/check-session.js"},
 				},
 			}
+			if nonce != "" {
+				scriptNode.Attr = append(scriptNode.Attr, html.Attribute{Key: "nonce", Val: nonce})
+			}
 			node.AppendChild(scriptNode)
-			return
-		}
-		for child := node.FirstChild; child != nil; child = child.NextSibling {
-			crawler(child)
+			injected = true
 		}
 	}
 	crawler(doc)
@@ -2,6 +2,7 @@ package webserver_test
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"html/template"
@@ -9,11 +10,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"time"
 
+	"github.com/ONSdigital/blaise-cawi-portal/audit"
 	"github.com/ONSdigital/blaise-cawi-portal/authenticate"
 	"github.com/ONSdigital/blaise-cawi-portal/authenticate/mocks"
 	"github.com/ONSdigital/blaise-cawi-portal/busapi"
 	languageManagerMocks "github.com/ONSdigital/blaise-cawi-portal/languagemanager/mocks"
+	"github.com/ONSdigital/blaise-cawi-portal/outbound"
+	"github.com/ONSdigital/blaise-cawi-portal/utils"
 	"github.com/ONSdigital/blaise-cawi-portal/webserver"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
@@ -25,6 +30,7 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"go.uber.org/zap/zaptest/observer"
+	"golang.org/x/net/html"
 )
 
 // A response recorder that supports streams (for efficent proxying)
@@ -92,6 +98,7 @@ var _ = Describe("Open Case", func() {
 		instrumentController.LanguageManager = languageManagerMock
 		mockJWTCrypto = &mocks.JWTCryptoInterface{}
 		instrumentController.JWTCrypto = mockJWTCrypto
+		instrumentController.ScriptSources = nil
 	})
 
 	Describe("Open a case in Blaise", func() {
@@ -111,7 +118,7 @@ var _ = Describe("Open Case", func() {
 						httpmock.ResponderFromResponse(mockResponse))
 
 					mockAuth.On("AuthenticatedWithUac", mock.Anything).Return()
-					mockJWTCrypto.On("DecryptJWT", mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
+					mockJWTCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
 						InstrumentName: instrumentName,
 						CaseID:         caseID,
 					}}, nil)
@@ -127,6 +134,50 @@ var _ = Describe("Open Case", func() {
 					Expect(httpRecorder.Body.String()).To(Equal(`<html><head></head><body><script src="/assets/js/check-session.js"></script></body></html>`))
 				})
 			})
+
+			Context("and the page has a Content-Security-Policy", func() {
+				BeforeEach(func() {
+					httpRouter = gin.Default()
+					httpRouter.Use(sessions.SessionsMany([]string{"session", "user_session", "session_validation", "language_session"}, cookie.NewStore([]byte("secret"))))
+					httpRouter.Use(func(context *gin.Context) {
+						context.Set(utils.CSPNonceKey, "bm9uY2U=")
+					})
+					instrumentController.ScriptSources = []string{"'sha256-YmxhaXNl'"}
+					instrumentController.AddRoutes(httpRouter)
+				})
+
+				JustBeforeEach(func() {
+					languageManagerMock.On("IsWelsh", mock.Anything).Return(false)
+					mockResponse := &http.Response{
+						StatusCode: 200,
+						Header: http.Header{
+							"Content-Type": {"text/html"},
+						},
+						Body: io.NopCloser(strings.NewReader(responseInfo)),
+					}
+					httpmock.RegisterResponder("POST", fmt.Sprintf("%s/%s/default.aspx", catiUrl, instrumentName),
+						httpmock.ResponderFromResponse(mockResponse))
+					mockAuth.On("AuthenticatedWithUac", mock.Anything).Return()
+					mockJWTCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
+						InstrumentName: instrumentName,
+						CaseID:         caseID,
+					}}, nil)
+
+					httpRecorder = CreateTestResponseRecorder()
+					req, _ := http.NewRequest("GET", fmt.Sprintf("/%s/", instrumentName), nil)
+					httpRouter.ServeHTTP(httpRecorder, req)
+				})
+
+				It("gives the check-session script the request's nonce", func() {
+					Expect(httpRecorder.Code).To(Equal(http.StatusOK))
+					Expect(httpRecorder.Body.String()).To(Equal(`<html><head></head><body><script src="/assets/js/check-session.js" nonce="bm9uY2U="></script></body></html>`))
+				})
+
+				It("allows the page's scripts by the configured sources", func() {
+					Expect(httpRecorder.Header().Get("Content-Security-Policy")).To(ContainSubstring(
+						"script-src 'self' https://cdn.ons.gov.uk 'nonce-bm9uY2U=' 'sha256-YmxhaXNl';"))
+				})
+			})
 		})
 
 		Context("Launching Blaise in Cawi mode for a different instrument", func() {
@@ -140,7 +191,7 @@ var _ = Describe("Open Case", func() {
 						httpmock.NewStringResponder(200, responseInfo))
 
 					mockAuth.On("AuthenticatedWithUac", mock.Anything).Return()
-					mockJWTCrypto.On("DecryptJWT", mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
+					mockJWTCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
 						InstrumentName: instrumentName,
 						CaseID:         caseID,
 					}}, nil)
@@ -175,7 +226,7 @@ var _ = Describe("Open Case", func() {
 						httpmock.NewStringResponder(200, responseInfo))
 
 					mockAuth.On("AuthenticatedWithUac", mock.Anything).Return()
-					mockJWTCrypto.On("DecryptJWT", mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
+					mockJWTCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
 						InstrumentName: instrumentName,
 						CaseID:         caseID,
 					}}, nil)
@@ -198,6 +249,83 @@ var _ = Describe("Open Case", func() {
 					Expect(observedLogs.All()[0].ContextMap()["InstrumentName"]).To(Equal("fwibble"))
 					Expect(observedLogs.All()[0].Level).To(Equal(zap.InfoLevel))
 				})
+
+				Context("When auditing", func() {
+					var sink *audit.MemorySink
+
+					BeforeEach(func() {
+						sink = &audit.MemorySink{}
+						instrumentController.Auditor = &audit.Auditor{Sink: sink, Key: []byte("audit-key")}
+					})
+
+					AfterEach(func() {
+						instrumentController.Auditor = nil
+					})
+
+					It("records the request as forbidden", func() {
+						Expect(instrumentController.Auditor.Flush(context.Background())).To(Succeed())
+						events := sink.Events()
+						Expect(events).To(HaveLen(1))
+						Expect(events[0].Type).To(Equal(audit.Forbidden))
+						Expect(events[0].Reason).To(Equal("Not authenticated for instrument"))
+						Expect(events[0].InstrumentName).To(Equal(instrumentName))
+						Expect(events[0].CaseIDHash).To(Equal(instrumentController.Auditor.Hash(caseID)))
+					})
+				})
+			})
+		})
+
+		Context("Launching Blaise in Cawi mode before a household has chosen a case", func() {
+			JustBeforeEach(func() {
+				mockAuth.On("AuthenticatedWithUac", mock.Anything).Return()
+				mockJWTCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
+					Cases: []busapi.UacCase{
+						{InstrumentName: instrumentName, CaseID: caseID},
+						{InstrumentName: instrumentName, CaseID: "householdCaseID"},
+					},
+				}}, nil)
+
+				httpRecorder = CreateTestResponseRecorder()
+				req, _ := http.NewRequest("GET", fmt.Sprintf("/%s/", instrumentName), nil)
+				httpRouter.ServeHTTP(httpRecorder, req)
+			})
+
+			It("Redirects to the case selection page", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusFound))
+				Expect(httpRecorder.Header().Get("Location")).To(Equal(authenticate.CASE_SELECTION_URL))
+			})
+		})
+
+		Context("Launching Blaise in Cawi mode for a linked instrument", func() {
+			BeforeEach(func() {
+				instrumentController.LinkedInstruments = authenticate.MustLinkedInstrumentRules(
+					authenticate.LinkedInstrumentRule{From: `^foo(bar)$`, To: `^fwib${1}$`},
+				)
+			})
+
+			AfterEach(func() {
+				instrumentController.LinkedInstruments = nil
+			})
+
+			JustBeforeEach(func() {
+				languageManagerMock.On("IsWelsh", mock.Anything).Return(false)
+				httpmock.RegisterResponder("POST", fmt.Sprintf("%s/%s/default.aspx", catiUrl, instrumentName),
+					httpmock.NewStringResponder(200, responseInfo))
+
+				mockAuth.On("AuthenticatedWithUac", mock.Anything).Return()
+				mockJWTCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
+					InstrumentName: instrumentName,
+					CaseID:         caseID,
+				}}, nil)
+
+				httpRecorder = CreateTestResponseRecorder()
+				req, _ := http.NewRequest("GET", fmt.Sprintf("/%s/", "fwibbar"), nil)
+				httpRouter.ServeHTTP(httpRecorder, req)
+			})
+
+			It("Returns a 200 response", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusOK))
+				Expect(observedLogs.FilterMessage("Not authenticated for instrument").Len()).To(Equal(0))
 			})
 		})
 
@@ -206,7 +334,7 @@ var _ = Describe("Open Case", func() {
 				languageManagerMock.On("LanguageError", mock.Anything, mock.Anything).Return("We were unable to process your request, please try again")
 				mockAuth.On("AuthenticatedWithUac", mock.Anything).Return()
 				mockAuth.On("NotAuthWithError", mock.Anything, mock.Anything).Return()
-				mockJWTCrypto.On("DecryptJWT", mock.Anything).Return(nil, errors.New("No JWT"))
+				mockJWTCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(nil, errors.New("No JWT"))
 
 				httpRecorder = CreateTestResponseRecorder()
 				req, _ := http.NewRequest("GET", fmt.Sprintf("/%s/", instrumentName), nil)
@@ -230,7 +358,7 @@ var _ = Describe("Open Case", func() {
 					httpmock.NewJsonResponderOrPanic(500, "Sad face"))
 
 				mockAuth.On("AuthenticatedWithUac", mock.Anything).Return()
-				mockJWTCrypto.On("DecryptJWT", mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
+				mockJWTCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
 					InstrumentName: instrumentName,
 					CaseID:         caseID,
 				}}, nil)
@@ -253,6 +381,43 @@ var _ = Describe("Open Case", func() {
 				Expect(observedLogs.All()[0].Level).To(Equal(zap.ErrorLevel))
 			})
 		})
+		Context("the circuit breaker for Blaise is open", func() {
+			BeforeEach(func() {
+				breaker := &outbound.CircuitBreaker{Threshold: 1, Cooldown: time.Minute}
+				breaker.Failure()
+				instrumentController.HttpClient = &http.Client{Transport: &outbound.Transport{Name: "cati", Breaker: breaker, Logger: zap.NewNop()}}
+			})
+
+			AfterEach(func() {
+				instrumentController.HttpClient = &http.Client{}
+			})
+
+			JustBeforeEach(func() {
+				languageManagerMock.On("IsWelsh", mock.Anything).Return(false)
+				httpmock.RegisterResponder("POST", fmt.Sprintf("%s/%s/default.aspx", catiUrl, instrumentName),
+					httpmock.NewStringResponder(200, responseInfo))
+
+				mockAuth.On("AuthenticatedWithUac", mock.Anything).Return()
+				mockJWTCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
+					InstrumentName: instrumentName,
+					CaseID:         caseID,
+				}}, nil)
+
+				httpRecorder = CreateTestResponseRecorder()
+				req, _ := http.NewRequest("GET", fmt.Sprintf("/%s/", instrumentName), nil)
+				httpRouter.ServeHTTP(httpRecorder, req)
+			})
+
+			It("returns the service unavailable page without calling Blaise", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(httpRecorder.Body.String()).To(ContainSubstring("Sorry, the service is unavailable at the moment"))
+				Expect(httpmock.GetTotalCallCount()).To(Equal(0))
+
+				Expect(observedLogs.Len()).To(Equal(1))
+				Expect(observedLogs.All()[0].Message).To(Equal("Error launching blaise study, CATI unavailable"))
+				Expect(observedLogs.All()[0].Level).To(Equal(zap.WarnLevel))
+			})
+		})
 	})
 
 	Describe("Proxy get requests to blaise", func() {
@@ -262,7 +427,7 @@ var _ = Describe("Open Case", func() {
 					httpmock.NewStringResponder(200, responseInfo))
 
 				mockAuth.On("AuthenticatedWithUac", mock.Anything).Return()
-				mockJWTCrypto.On("DecryptJWT", mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
+				mockJWTCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
 					InstrumentName: instrumentName,
 					CaseID:         caseID,
 				}}, nil)
@@ -280,13 +445,41 @@ var _ = Describe("Open Case", func() {
 			})
 		})
 
+		Context("Blaise sets its own Content-Security-Policy", func() {
+			JustBeforeEach(func() {
+				httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s/fwibble/dwibble", catiUrl, instrumentName),
+					func(req *http.Request) (*http.Response, error) {
+						resp := httpmock.NewStringResponse(200, responseInfo)
+						resp.Header.Set("Content-Type", "text/html")
+						resp.Header.Set("Content-Security-Policy", "script-src 'self' 'unsafe-inline'")
+						return resp, nil
+					})
+
+				mockAuth.On("AuthenticatedWithUac", mock.Anything).Return()
+				mockJWTCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
+					InstrumentName: instrumentName,
+					CaseID:         caseID,
+				}}, nil)
+
+				httpRecorder = CreateTestResponseRecorder()
+				req, _ := http.NewRequest("GET", fmt.Sprintf("/%s/fwibble/dwibble", instrumentName), nil)
+				httpRouter.ServeHTTP(httpRecorder, req)
+			})
+
+			It("serves the page with the portal's policy only", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusOK))
+				Expect(httpRecorder.Header().Values("Content-Security-Policy")).To(HaveLen(1))
+				Expect(httpRecorder.Header().Get("Content-Security-Policy")).To(ContainSubstring("script-src 'self' https://cdn.ons.gov.uk 'nonce-"))
+			})
+		})
+
 		Context("Making a request for a blaise resource gets proxied to the blaise server for short urls", func() {
 			JustBeforeEach(func() {
 				httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s/fwibble", catiUrl, instrumentName),
 					httpmock.NewStringResponder(200, responseInfo))
 
 				mockAuth.On("AuthenticatedWithUac", mock.Anything).Return()
-				mockJWTCrypto.On("DecryptJWT", mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
+				mockJWTCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
 					InstrumentName: instrumentName,
 					CaseID:         caseID,
 				}}, nil)
@@ -309,7 +502,7 @@ var _ = Describe("Open Case", func() {
 					httpmock.NewStringResponder(200, responseInfo))
 
 				mockAuth.On("AuthenticatedWithUac", mock.Anything).Return()
-				mockJWTCrypto.On("DecryptJWT", mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
+				mockJWTCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
 					InstrumentName: instrumentName,
 					CaseID:         caseID,
 				}}, nil)
@@ -335,7 +528,7 @@ var _ = Describe("Open Case", func() {
 					httpmock.NewStringResponder(200, responseInfo))
 
 				mockAuth.On("AuthenticatedWithUac", mock.Anything).Return()
-				mockJWTCrypto.On("DecryptJWT", mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
+				mockJWTCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
 					InstrumentName: instrumentName,
 					CaseID:         caseID,
 				}}, nil)
@@ -354,16 +547,24 @@ var _ = Describe("Open Case", func() {
 		})
 
 		Context("Making a request to start interview via POST to Blaise server", func() {
-			var requestedCaseID string
+			var (
+				requestedCaseID string
+				cases           []busapi.UacCase
+			)
+
+			AfterEach(func() {
+				cases = nil
+			})
 
 			JustBeforeEach(func() {
 				httpmock.RegisterResponder("POST", fmt.Sprintf("%s/%s/api/application/start_interview", catiUrl, instrumentName),
 					httpmock.NewStringResponder(200, responseInfo))
 
 				mockAuth.On("AuthenticatedWithUac", mock.Anything).Return()
-				mockJWTCrypto.On("DecryptJWT", mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
+				mockJWTCrypto.On("DecryptJWT", mock.Anything, mock.Anything).Return(&authenticate.UACClaims{UacInfo: busapi.UacInfo{
 					InstrumentName: instrumentName,
 					CaseID:         caseID,
+					Cases:          cases,
 				}}, nil)
 
 				requestBody = bytes.NewReader([]byte(fmt.Sprintf(`{
@@ -389,6 +590,39 @@ var _ = Describe("Open Case", func() {
 				})
 			})
 
+			Context("When the UAC covers a household", func() {
+				BeforeEach(func() {
+					cases = []busapi.UacCase{
+						{InstrumentName: instrumentName, CaseID: caseID},
+						{InstrumentName: instrumentName, CaseID: "householdCaseID"},
+						{InstrumentName: "otherInstrument", CaseID: "otherCaseID"},
+					}
+				})
+
+				Context("and the case is another of the household's", func() {
+					BeforeEach(func() {
+						requestedCaseID = "householdCaseID"
+					})
+
+					It("Returns a 200 response and some data", func() {
+						Expect(httpRecorder.Code).To(Equal(http.StatusOK))
+						Expect(httpRecorder.Body.String()).To(ContainSubstring(responseInfo))
+					})
+				})
+
+				Context("and the case is the household's for another instrument", func() {
+					BeforeEach(func() {
+						languageManagerMock.On("IsWelsh", mock.Anything).Return(false)
+						requestedCaseID = "otherCaseID"
+					})
+
+					It("Returns a 403", func() {
+						Expect(httpRecorder.Code).To(Equal(http.StatusForbidden))
+						Expect(observedLogs.FilterMessage("Not authenticated to start interview for case").Len()).To(Equal(1))
+					})
+				})
+			})
+
 			Context("When the case ID does not have authorisation", func() {
 				BeforeEach(func() {
 					languageManagerMock.On("IsWelsh", mock.Anything).Return(false)
@@ -455,3 +689,31 @@ var _ = Describe("GET /:instrumentName/logout", func() {
 		mockAuth.AssertNumberOfCalls(GinkgoT(), "Logout", 1)
 	})
 })
+
+var _ = Describe("InjectScript", func() {
+	render := func(body string, nonce string) string {
+		doc, err := webserver.InjectScript([]byte(body), nonce)
+		Expect(err).To(BeNil())
+		var rendered bytes.Buffer
+		Expect(html.Render(&rendered, doc)).To(Succeed())
+		return rendered.String()
+	}
+
+	It("only gives the check-session script the nonce", func() {
+		Expect(render(`<html><head><script>init()</script></head><body><script>start()</script></body></html>`, "bm9uY2U=")).To(Equal(
+			`<html><head><script>init()</script></head><body><script>start()</script><script src="/assets/js/check-session.js" nonce="bm9uY2U="></script></body></html>`,
+		))
+	})
+
+	It("leaves the page's external scripts alone", func() {
+		Expect(render(`<html><head><script src="/blaise.js"></script></head><body></body></html>`, "bm9uY2U=")).To(Equal(
+			`<html><head><script src="/blaise.js"></script></head><body><script src="/assets/js/check-session.js" nonce="bm9uY2U="></script></body></html>`,
+		))
+	})
+
+	It("adds no nonce when there is none", func() {
+		Expect(render(`<html><head><script>init()</script></head><body></body></html>`, "")).To(Equal(
+			`<html><head><script>init()</script></head><body><script src="/assets/js/check-session.js"></script></body></html>`,
+		))
+	})
+})
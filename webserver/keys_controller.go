@@ -0,0 +1,23 @@
+package webserver
+
+import (
+	"net/http"
+
+	"github.com/ONSdigital/blaise-cawi-portal/authenticate"
+	"github.com/gin-gonic/gin"
+)
+
+type KeysController struct {
+	JWTCrypto authenticate.JWTCryptoInterface
+}
+
+func (keysController *KeysController) AddRoutes(httpRouter *gin.Engine) {
+	httpRouter.GET("/.well-known/jwks.json", keysController.JWKSEndpoint)
+}
+
+// JWKSEndpoint publishes the public keys session tokens can be verified with,
+// so other services can check them without sharing a secret
+func (keysController *KeysController) JWKSEndpoint(context *gin.Context) {
+	context.Header("Cache-Control", "public, max-age=300")
+	context.JSON(http.StatusOK, keysController.JWTCrypto.PublicKeySet())
+}
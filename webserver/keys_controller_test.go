@@ -0,0 +1,45 @@
+package webserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/ONSdigital/blaise-cawi-portal/authenticate"
+	"github.com/ONSdigital/blaise-cawi-portal/authenticate/mocks"
+	"github.com/ONSdigital/blaise-cawi-portal/webserver"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Keys Controller", func() {
+	var (
+		httpRouter     *gin.Engine
+		mockJWTCrypto  *mocks.JWTCryptoInterface
+		keysController *webserver.KeysController
+	)
+
+	BeforeEach(func() {
+		httpRouter = gin.Default()
+		mockJWTCrypto = &mocks.JWTCryptoInterface{}
+		keysController = &webserver.KeysController{JWTCrypto: mockJWTCrypto}
+		keysController.AddRoutes(httpRouter)
+	})
+
+	Describe("/.well-known/jwks.json", func() {
+		It("returns the public key set", func() {
+			mockJWTCrypto.On("PublicKeySet").Return(authenticate.JSONWebKeySet{
+				Keys: []authenticate.JSONWebKey{{KeyType: "EC", KeyID: "2021-03", Algorithm: "ES256", Use: "sig", Curve: "P-256", X: "x", Y: "y"}},
+			})
+
+			httpRecorder := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+			httpRouter.ServeHTTP(httpRecorder, req)
+
+			Expect(httpRecorder.Code).To(Equal(http.StatusOK))
+			Expect(httpRecorder.Header().Get("Cache-Control")).To(Equal("public, max-age=300"))
+			Expect(httpRecorder.Body.String()).To(MatchJSON(`{"keys":[{"kty":"EC","kid":"2021-03","alg":"ES256","use":"sig","crv":"P-256","x":"x","y":"y"}]}`))
+		})
+	})
+})
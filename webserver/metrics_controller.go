@@ -0,0 +1,35 @@
+package webserver
+
+import (
+	"net/http"
+
+	"github.com/ONSdigital/blaise-cawi-portal/metrics"
+	"github.com/ONSdigital/blaise-cawi-portal/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// MetricsController serves Prometheus metrics. Like the admin endpoints, it is
+// only registered when a token is configured, and scrapes must present it as
+// a bearer token, so the metrics are never public.
+type MetricsController struct {
+	Token   string
+	Metrics *metrics.Metrics
+	Logger  *zap.Logger
+}
+
+func (metricsController *MetricsController) AddRoutes(httpRouter *gin.Engine) {
+	if metricsController.Token == "" || metricsController.Metrics == nil {
+		return
+	}
+	httpRouter.GET("/metrics", metricsController.Authorised, gin.WrapH(metricsController.Metrics.Handler()))
+}
+
+func (metricsController *MetricsController) Authorised(context *gin.Context) {
+	if !bearerTokenValid(context, metricsController.Token) {
+		metricsController.Logger.Warn("Unauthorised metrics request", utils.GetRequestSource(context)...)
+		context.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	context.Next()
+}
@@ -0,0 +1,74 @@
+package webserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/ONSdigital/blaise-cawi-portal/metrics"
+	"github.com/ONSdigital/blaise-cawi-portal/webserver"
+	"go.uber.org/zap"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics Controller", func() {
+	var (
+		httpRouter        *gin.Engine
+		httpRecorder      *httptest.ResponseRecorder
+		metricsController *webserver.MetricsController
+		authorization     string
+	)
+
+	BeforeEach(func() {
+		httpRouter = gin.Default()
+		portalMetrics := metrics.New()
+		portalMetrics.LoginAttempt(metrics.LoginSuccess, "")
+		metricsController = &webserver.MetricsController{
+			Token:   "metrics-token",
+			Metrics: portalMetrics,
+			Logger:  zap.NewNop(),
+		}
+		authorization = "Bearer metrics-token"
+	})
+
+	JustBeforeEach(func() {
+		metricsController.AddRoutes(httpRouter)
+		httpRecorder = httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Authorization", authorization)
+		httpRouter.ServeHTTP(httpRecorder, req)
+	})
+
+	Describe("GET /metrics", func() {
+		Context("with the metrics token", func() {
+			It("returns the metrics", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusOK))
+				Expect(httpRecorder.Body.String()).To(ContainSubstring(`cawi_portal_login_attempts_total{outcome="success",reason=""} 1`))
+			})
+		})
+
+		Context("with the wrong metrics token", func() {
+			BeforeEach(func() {
+				authorization = "Bearer wrong-token"
+			})
+
+			It("returns unauthorized", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusUnauthorized))
+				Expect(httpRecorder.Body.String()).ToNot(ContainSubstring("cawi_portal"))
+			})
+		})
+
+		Context("when no metrics token is configured", func() {
+			BeforeEach(func() {
+				metricsController.Token = ""
+				authorization = "Bearer "
+			})
+
+			It("is not routed", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusNotFound))
+			})
+		})
+	})
+})
@@ -1,12 +1,33 @@
 package webserver
 
 import (
+	"errors"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
 
+	"github.com/ONSdigital/blaise-cawi-portal/cspreport"
+	"github.com/ONSdigital/blaise-cawi-portal/ratelimiter"
+	"github.com/ONSdigital/blaise-cawi-portal/utils"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
-type SecurityController struct{}
+const (
+	CSPReportPath     = "/security/csp-report"
+	cspReportEndpoint = "csp-endpoint"
+	maxCSPReportBytes = 64 * 1024
+)
+
+type SecurityController struct {
+	Logger *zap.Logger
+	// Aggregates the CSP violation reports sent to CSPReportPath, which is
+	// only served when it is set
+	CSPReports *cspreport.Aggregator
+	// Limits the reports each client IP can send, when set
+	CSPReportLimiter ratelimiter.LimiterInterface
+}
 
 func (securityController *SecurityController) AddRoutes(httpRouter *gin.Engine) {
 	httpRouter.Use(func(context *gin.Context) {
@@ -14,4 +35,60 @@ func (securityController *SecurityController) AddRoutes(httpRouter *gin.Engine)
 			context.AbortWithStatus(http.StatusMethodNotAllowed)
 		}
 	})
+	if securityController.CSPReports != nil {
+		httpRouter.POST(CSPReportPath, securityController.CSPReportEndpoint)
+	}
+}
+
+// CSPReportEndpoint counts the violations in a report sent by a browser
+// enforcing the Content-Security-Policy
+func (securityController *SecurityController) CSPReportEndpoint(context *gin.Context) {
+	if securityController.rateLimited(context) {
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(context.Writer, context.Request.Body, maxCSPReportBytes))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		context.AbortWithStatus(http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	violations, err := cspreport.Parse(context.ContentType(), body)
+	if err != nil {
+		securityController.Logger.Debug("Invalid CSP report", append(utils.GetRequestSource(context), zap.Error(err))...)
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	for _, violation := range violations {
+		securityController.CSPReports.Record(violation)
+	}
+	context.Status(http.StatusNoContent)
+}
+
+// rateLimited counts the report against the client IP, refusing it once the
+// IP has sent too many. Reports are accepted if the limiter fails.
+func (securityController *SecurityController) rateLimited(context *gin.Context) bool {
+	if securityController.CSPReportLimiter == nil {
+		return false
+	}
+	clientIP := utils.GetClientIP(context)
+	lockout, err := securityController.CSPReportLimiter.LockedOut(clientIP)
+	if err == nil && lockout == 0 {
+		lockout, err = securityController.CSPReportLimiter.Fail(clientIP)
+	}
+	if err != nil {
+		securityController.Logger.Error("Failed to rate limit CSP reports", append(utils.GetRequestSource(context), zap.Error(err))...)
+		return false
+	}
+	if lockout > 0 {
+		context.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockout.Seconds()))))
+		context.AbortWithStatus(http.StatusTooManyRequests)
+		return true
+	}
+	return false
 }
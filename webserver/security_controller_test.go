@@ -1,10 +1,23 @@
 package webserver_test
 
 import (
+	"errors"
+	"fmt"
+	"html/template"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/ONSdigital/blaise-cawi-portal/cspreport"
+	ratelimiterMocks "github.com/ONSdigital/blaise-cawi-portal/ratelimiter/mocks"
+	"github.com/ONSdigital/blaise-cawi-portal/utils"
 	"github.com/ONSdigital/blaise-cawi-portal/webserver"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 
 	"github.com/gin-gonic/gin"
 	. "github.com/onsi/ginkgo"
@@ -39,3 +52,178 @@ var _ = Describe("Security Controller", func() {
 		Entry("long path", "/foo/bar/baz"),
 	)
 })
+
+var _ = Describe("Content Security Policy", func() {
+	var httpRouter *gin.Engine
+
+	nonceRegexp := regexp.MustCompile(`'nonce-([A-Za-z0-9_-]+)'`)
+
+	get := func() *httptest.ResponseRecorder {
+		httpRecorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/missing", nil)
+		httpRouter.ServeHTTP(httpRecorder, req)
+		return httpRecorder
+	}
+
+	BeforeEach(func() {
+		httpRouter = gin.Default()
+		httpRouter.SetFuncMap(template.FuncMap{
+			"WrapWelsh": webserver.WrapWelsh,
+		})
+		httpRouter.LoadHTMLGlob("../templates/*")
+		httpRouter.Use(webserver.ContentSecurityPolicyMiddleware)
+		httpRouter.NoRoute(func(context *gin.Context) {
+			context.HTML(http.StatusOK, "not_found.tmpl", gin.H{"welsh": false, "csp_nonce": utils.CSPNonce(context)})
+		})
+	})
+
+	It("does not allow inline scripts without the nonce", func() {
+		policy := get().Header().Get("Content-Security-Policy")
+
+		Expect(policy).To(ContainSubstring("script-src 'self' https://cdn.ons.gov.uk 'nonce-"))
+		Expect(policy).To(ContainSubstring("object-src 'none'"))
+		Expect(nonceRegexp.FindStringSubmatch(policy)).ToNot(BeNil())
+		Expect(policy).ToNot(MatchRegexp(`(default|script)-src[^;]*'unsafe-inline'`))
+	})
+
+	It("asks browsers to report violations", func() {
+		httpRecorder := get()
+
+		Expect(httpRecorder.Header().Get("Content-Security-Policy")).To(HaveSuffix("report-uri /security/csp-report; report-to csp-endpoint"))
+		Expect(httpRecorder.Header().Get("Reporting-Endpoints")).To(Equal(`csp-endpoint="/security/csp-report"`))
+	})
+
+	It("gives the page's inline scripts the nonce", func() {
+		httpRecorder := get()
+		nonce := nonceRegexp.FindStringSubmatch(httpRecorder.Header().Get("Content-Security-Policy"))[1]
+
+		Expect(httpRecorder.Body.String()).To(ContainSubstring(fmt.Sprintf(`<script nonce="%s">`, nonce)))
+		Expect(httpRecorder.Body.String()).ToNot(ContainSubstring("<script>"))
+	})
+
+	It("uses a new nonce for each request", func() {
+		first := nonceRegexp.FindStringSubmatch(get().Header().Get("Content-Security-Policy"))[1]
+		second := nonceRegexp.FindStringSubmatch(get().Header().Get("Content-Security-Policy"))[1]
+
+		Expect(first).ToNot(Equal(second))
+	})
+})
+
+var _ = Describe("CSP reports", func() {
+	var (
+		httpRouter         *gin.Engine
+		httpRecorder       *httptest.ResponseRecorder
+		mockLimiter        *ratelimiterMocks.LimiterInterface
+		observedLogs       *observer.ObservedLogs
+		securityController *webserver.SecurityController
+		contentType        string
+		body               string
+	)
+
+	BeforeEach(func() {
+		var observedZapCore zapcore.Core
+		observedZapCore, observedLogs = observer.New(zap.InfoLevel)
+		mockLimiter = &ratelimiterMocks.LimiterInterface{}
+		securityController = &webserver.SecurityController{
+			Logger:           zap.New(observedZapCore),
+			CSPReports:       &cspreport.Aggregator{Logger: zap.New(observedZapCore), Interval: time.Minute, MaxViolations: 100},
+			CSPReportLimiter: mockLimiter,
+		}
+		httpRouter = gin.Default()
+		securityController.AddRoutes(httpRouter)
+		contentType = "application/csp-report"
+		body = `{"csp-report": {"document-uri": "https://portal.example/auth/login", "blocked-uri": "inline", "effective-directive": "script-src-elem"}}`
+	})
+
+	JustBeforeEach(func() {
+		httpRecorder = httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/security/csp-report", strings.NewReader(body))
+		req.RemoteAddr = "203.0.113.7:1234"
+		req.Header.Set("Content-Type", contentType)
+		httpRouter.ServeHTTP(httpRecorder, req)
+	})
+
+	Context("within the rate limit", func() {
+		BeforeEach(func() {
+			mockLimiter.On("LockedOut", "203.0.113.7").Return(time.Duration(0), nil)
+			mockLimiter.On("Fail", "203.0.113.7").Return(time.Duration(0), nil)
+		})
+
+		It("counts the violation", func() {
+			Expect(httpRecorder.Code).To(Equal(http.StatusNoContent))
+
+			securityController.CSPReports.Flush()
+			logged := observedLogs.FilterMessage("CSP violations").All()
+			Expect(logged).To(HaveLen(1))
+			Expect(logged[0].ContextMap()["BlockedURI"]).To(Equal("inline"))
+			Expect(logged[0].ContextMap()["Count"]).To(Equal(int64(1)))
+		})
+
+		Context("with a malformed report", func() {
+			BeforeEach(func() {
+				body = `{"csp-report":`
+			})
+
+			It("returns bad request", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("with a report that is not JSON", func() {
+			BeforeEach(func() {
+				contentType = "text/plain"
+			})
+
+			It("returns bad request", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("with a report that is too large", func() {
+			BeforeEach(func() {
+				body = strings.Repeat(" ", 65*1024)
+			})
+
+			It("returns request entity too large", func() {
+				Expect(httpRecorder.Code).To(Equal(http.StatusRequestEntityTooLarge))
+			})
+		})
+	})
+
+	Context("when the client IP has sent too many reports", func() {
+		BeforeEach(func() {
+			mockLimiter.On("LockedOut", "203.0.113.7").Return(90*time.Second, nil)
+		})
+
+		It("refuses the report", func() {
+			Expect(httpRecorder.Code).To(Equal(http.StatusTooManyRequests))
+			Expect(httpRecorder.Header().Get("Retry-After")).To(Equal("90"))
+			mockLimiter.AssertNotCalled(GinkgoT(), "Fail", mock.Anything)
+
+			securityController.CSPReports.Flush()
+			Expect(observedLogs.FilterMessage("CSP violations").All()).To(BeEmpty())
+		})
+	})
+
+	Context("when the report takes the client IP over the limit", func() {
+		BeforeEach(func() {
+			mockLimiter.On("LockedOut", "203.0.113.7").Return(time.Duration(0), nil)
+			mockLimiter.On("Fail", "203.0.113.7").Return(time.Minute, nil)
+		})
+
+		It("refuses the report", func() {
+			Expect(httpRecorder.Code).To(Equal(http.StatusTooManyRequests))
+		})
+	})
+
+	Context("when the rate limit cannot be checked", func() {
+		BeforeEach(func() {
+			mockLimiter.On("LockedOut", "203.0.113.7").Return(time.Duration(0), errors.New("redis unavailable"))
+		})
+
+		It("accepts the report", func() {
+			Expect(httpRecorder.Code).To(Equal(http.StatusNoContent))
+			Expect(observedLogs.FilterMessage("Failed to rate limit CSP reports").All()).To(HaveLen(1))
+		})
+	})
+})
@@ -0,0 +1,106 @@
+package webserver_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ONSdigital/blaise-cawi-portal/webserver"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server", func() {
+	var (
+		server   *webserver.Server
+		listener net.Listener
+		release  chan struct{}
+		started  chan struct{}
+	)
+
+	BeforeEach(func() {
+		server = &webserver.Server{Config: &webserver.Config{
+			Port:               "0",
+			ServerReadTimeout:  time.Second,
+			ServerWriteTimeout: time.Second,
+			ShutdownTimeout:    time.Second,
+		}}
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		release = make(chan struct{})
+		started = make(chan struct{})
+	})
+
+	handler := func() http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			close(started)
+			<-release
+			_, _ = writer.Write([]byte("finished"))
+		})
+	}
+
+	Describe("HTTPServer", func() {
+		It("applies the configured timeouts", func() {
+			httpServer := server.HTTPServer(handler())
+
+			Expect(httpServer.Addr).To(Equal(":0"))
+			Expect(httpServer.ReadTimeout).To(Equal(time.Second))
+			Expect(httpServer.WriteTimeout).To(Equal(time.Second))
+		})
+	})
+
+	Describe("Serve", func() {
+		It("finishes in-flight requests when stopped", func() {
+			ctx, stop := context.WithCancel(context.Background())
+			served := make(chan error, 1)
+			go func() {
+				served <- server.Serve(ctx, server.HTTPServer(handler()), listener)
+			}()
+
+			body := make(chan string, 1)
+			go func() {
+				defer GinkgoRecover()
+				response, err := http.Get("http://" + listener.Addr().String())
+				Expect(err).To(BeNil())
+				defer response.Body.Close()
+				content, _ := io.ReadAll(response.Body)
+				body <- string(content)
+			}()
+			Eventually(started).Should(BeClosed())
+
+			stop()
+			Consistently(served, 100*time.Millisecond).ShouldNot(Receive())
+			close(release)
+
+			Eventually(body).Should(Receive(Equal("finished")))
+			Eventually(served).Should(Receive(BeNil()))
+			_, err := net.Dial("tcp", listener.Addr().String())
+			Expect(err).ToNot(BeNil())
+		})
+
+		It("gives up on requests that outlast the shutdown timeout", func() {
+			server.Config.ShutdownTimeout = 50 * time.Millisecond
+			ctx, stop := context.WithCancel(context.Background())
+			served := make(chan error, 1)
+			go func() {
+				served <- server.Serve(ctx, server.HTTPServer(handler()), listener)
+			}()
+			go func() {
+				response, err := http.Get("http://" + listener.Addr().String())
+				if err == nil {
+					response.Body.Close()
+				}
+			}()
+			Eventually(started).Should(BeClosed())
+
+			stop()
+
+			Eventually(served).Should(Receive(MatchError(context.DeadlineExceeded)))
+			close(release)
+		})
+	})
+})
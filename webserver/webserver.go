@@ -2,15 +2,28 @@ package webserver
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
+	"sort"
+	"time"
 
+	"github.com/ONSdigital/blaise-cawi-portal/audit"
 	"github.com/ONSdigital/blaise-cawi-portal/authenticate"
 	"github.com/ONSdigital/blaise-cawi-portal/blaiserestapi"
 	"github.com/ONSdigital/blaise-cawi-portal/busapi"
+	"github.com/ONSdigital/blaise-cawi-portal/cspreport"
+	"github.com/ONSdigital/blaise-cawi-portal/kvstore"
 	"github.com/ONSdigital/blaise-cawi-portal/languagemanager"
+	"github.com/ONSdigital/blaise-cawi-portal/metrics"
+	"github.com/ONSdigital/blaise-cawi-portal/outbound"
+	"github.com/ONSdigital/blaise-cawi-portal/ratelimiter"
+	"github.com/ONSdigital/blaise-cawi-portal/readiness"
+	"github.com/ONSdigital/blaise-cawi-portal/tracing"
 	"github.com/ONSdigital/blaise-cawi-portal/utils"
 	"github.com/blendle/zapdriver"
 	"github.com/gin-contrib/secure"
@@ -20,6 +33,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/kelseyhightower/envconfig"
 	csrf "github.com/srbry/gin-csrf"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"google.golang.org/api/idtoken"
@@ -28,13 +42,42 @@ import (
 const CDN = "https://cdn.ons.gov.uk"
 
 var (
-	srcHosts              = fmt.Sprintf("'self' %s", CDN)
-	defaultSRC            = fmt.Sprintf("default-src %s 'unsafe-inline'", srcHosts)
-	fontSRC               = fmt.Sprintf("font-src %s data:", srcHosts)
-	imgSRC                = fmt.Sprintf("img-src %s data:", srcHosts)
-	contentSecurityPolicy = fmt.Sprintf("%s; %s; %s", defaultSRC, fontSRC, imgSRC)
+	srcHosts   = fmt.Sprintf("'self' %s", CDN)
+	defaultSRC = fmt.Sprintf("default-src %s", srcHosts)
+	styleSRC   = fmt.Sprintf("style-src %s 'unsafe-inline'", srcHosts)
+	fontSRC    = fmt.Sprintf("font-src %s data:", srcHosts)
+	imgSRC     = fmt.Sprintf("img-src %s data:", srcHosts)
 )
 
+// ContentSecurityPolicy only lets scripts run from the portal, the CDN, any
+// scriptSources given, or inline with the request's nonce. Styles may still be
+// inline, as the portal's and Blaise's pages use style attributes. Browsers
+// report violations to CSPReportPath.
+func ContentSecurityPolicy(nonce string, scriptSources ...string) string {
+	scriptSRC := fmt.Sprintf("script-src %s 'nonce-%s'", srcHosts, nonce)
+	for _, source := range scriptSources {
+		scriptSRC = fmt.Sprintf("%s %s", scriptSRC, source)
+	}
+	reporting := fmt.Sprintf("report-uri %s; report-to %s", CSPReportPath, cspReportEndpoint)
+	return fmt.Sprintf("%s; %s; %s; %s; %s; object-src 'none'; base-uri 'self'; %s", defaultSRC, scriptSRC, styleSRC, fontSRC, imgSRC, reporting)
+}
+
+// ContentSecurityPolicyMiddleware sets the Content-Security-Policy with a new
+// nonce for each request, which templates get as csp_nonce
+func ContentSecurityPolicyMiddleware(context *gin.Context) {
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		_ = context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	// URL safe, so templates do not escape it
+	nonce := base64.RawURLEncoding.EncodeToString(nonceBytes)
+	context.Set(utils.CSPNonceKey, nonce)
+	context.Header("Content-Security-Policy", ContentSecurityPolicy(nonce))
+	context.Header("Reporting-Endpoints", fmt.Sprintf(`%s="%s"`, cspReportEndpoint, CSPReportPath))
+	context.Next()
+}
+
 type Config struct {
 	RedisSessionDB   string `default:"localhost:6379" split_words:"true"`
 	SessionSecret    string `required:"true" split_words:"true"`
@@ -46,9 +89,114 @@ type Config struct {
 	BlaiseRestApi    string `required:"true" split_words:"true"`
 	Serverpark       string `default:"gusty"`
 	Port             string `default:"8080"`
-	UacKind          string `default:"uac" split_words:"true"`
 	DevMode          bool   `default:"false" split_words:"true"`
 	Debug            bool   `default:"false"`
+
+	// A comma separated list of the access code kinds to accept, e.g. "uac,uac16"
+	UacKind authenticate.UacKinds `default:"uac" split_words:"true"`
+	// Validate access code check characters locally before calling BUS
+	UacCheckCharacters bool `default:"false" split_words:"true"`
+
+	// Identifies JWTSecret in the kid header of the tokens it signs
+	JWTKeyId string `default:"default" envconfig:"JWT_KEY_ID"`
+	// Rotated out secrets still accepted for verification, as "keyid:secret,keyid:secret"
+	JWTVerificationKeys map[string]string `envconfig:"JWT_VERIFICATION_KEYS"`
+	// PEM encoded ECDSA or RSA private key to sign tokens with instead of JWTSecret, identified by JWTSigningKeyId
+	JWTSigningKeyFile string `envconfig:"JWT_SIGNING_KEY_FILE"`
+	JWTSigningKeyId   string `default:"signing" envconfig:"JWT_SIGNING_KEY_ID"`
+	// Public keys still accepted for verification, as "keyid:path,keyid:path"
+	JWTPublicKeyFiles map[string]string `envconfig:"JWT_PUBLIC_KEY_FILES"`
+	// Keys the hash of the access code stored in session tokens, defaults to JWTSecret
+	UACHashSecret string `envconfig:"UAC_HASH_SECRET"`
+	// How long a session can last however active it is, 0 for no limit
+	SessionMaxLifetime time.Duration `default:"12h" split_words:"true"`
+	// Overrides SessionMaxLifetime by instrument name prefix, as "prefix:duration,prefix:duration"
+	SessionMaxLifetimes map[string]time.Duration `split_words:"true"`
+	// How long a token revoked by an admin is denied for
+	JWTRevocationTTL time.Duration `default:"24h" envconfig:"JWT_REVOCATION_TTL"`
+
+	// What happens when an access code with an active session signs in again: "allow", "reject" or "replace"
+	SessionPolicy authenticate.SessionPolicy `default:"replace" split_words:"true"`
+
+	// How long instrument settings are cached for, 0 to disable the cache
+	InstrumentSettingsCacheTtl time.Duration `default:"5m" envconfig:"INSTRUMENT_SETTINGS_CACHE_TTL"`
+	// How old cached instrument settings can be and still be served while they are refreshed
+	InstrumentSettingsStaleTtl time.Duration `default:"1h" envconfig:"INSTRUMENT_SETTINGS_STALE_TTL"`
+	// How long questionnaire statuses and survey days are cached for, 0 to not cache them
+	QuestionnaireStatusCacheTtl time.Duration `default:"30s" envconfig:"QUESTIONNAIRE_STATUS_CACHE_TTL"`
+	// How many instruments' settings, statuses and survey days are cached at most
+	InstrumentSettingsCacheMaxEntries int `default:"1000" envconfig:"INSTRUMENT_SETTINGS_CACHE_MAX_ENTRIES"`
+
+	// When each instrument can be signed in to, as a JSON list of
+	// {"instrument": pattern, "opens": RFC 3339 time, "closes": RFC 3339 time}
+	InstrumentAvailability authenticate.AvailabilityWindows `split_words:"true"`
+
+	// Which other instruments a UAC for an instrument may access, as a JSON list
+	// of {"from": regexp, "to": regexp}, where to can refer to from's groups as
+	// $1. Defaults to letting DIA "a" UACs access DIA "b" instruments
+	LinkedInstruments authenticate.LinkedInstrumentRules `split_words:"true"`
+
+	// Only allow sign in on the questionnaire's survey days
+	RequireSurveyDay bool `default:"false" split_words:"true"`
+
+	// Where authentication audit events are written: "stdout", "file:<path>" or
+	// the URL of a webhook. Auditing is disabled when it is not set
+	AuditSink string `split_words:"true"`
+	// Keys the hashes in audit events and their chain, defaults to UACHashSecret, then JWTSecret
+	AuditKey string `split_words:"true"`
+	// Bearer token sent to an audit webhook
+	AuditWebhookToken   string        `split_words:"true"`
+	AuditWebhookTimeout time.Duration `default:"5s" split_words:"true"`
+
+	// Bearer token for the /admin endpoints, which are disabled when it is not set
+	AdminToken string `split_words:"true"`
+	// Bearer token for the /metrics endpoint, which is disabled when it is not set
+	MetricsToken string `split_words:"true"`
+
+	// Where OpenTelemetry spans are exported: "otlp", configured by the
+	// standard OTEL_EXPORTER_OTLP_* variables, or "stdout". Tracing is
+	// disabled when it is not set
+	TraceExporter string `split_words:"true"`
+	// Share of the traces started by the portal that are sampled
+	TraceSampleRatio float64 `default:"1" split_words:"true"`
+
+	// How often the CSP violations reported by browsers are logged, and how
+	// many reports each client IP can send a minute
+	CSPReportInterval     time.Duration `default:"1m" envconfig:"CSP_REPORT_INTERVAL"`
+	CSPReportMaxPerMinute int           `default:"20" envconfig:"CSP_REPORT_MAX_PER_MINUTE"`
+	// Further script-src sources for Blaise pages, such as the hashes of their
+	// inline scripts, 'sha256-...', so that they can run without the nonce
+	CSPBlaiseScriptSources []string `envconfig:"CSP_BLAISE_SCRIPT_SOURCES"`
+
+	// Bound reading requests, writing responses, and keeping idle connections
+	// open. The write timeout must allow for proxied CATI requests
+	ServerReadTimeout       time.Duration `default:"30s" split_words:"true"`
+	ServerReadHeaderTimeout time.Duration `default:"10s" split_words:"true"`
+	ServerWriteTimeout      time.Duration `default:"60s" split_words:"true"`
+	ServerIdleTimeout       time.Duration `default:"120s" split_words:"true"`
+	// How long in-flight requests are given to finish when the portal is stopped
+	ShutdownTimeout time.Duration `default:"25s" split_words:"true"`
+
+	// Bound each dependency probe made for /ready, and how long their results are reused
+	ReadyTimeout  time.Duration `default:"2s" split_words:"true"`
+	ReadyCacheTtl time.Duration `default:"10s" envconfig:"READY_CACHE_TTL"`
+
+	LoginMaxAttempts      int           `default:"5" split_words:"true"`
+	LoginMaxAttemptsPerIP int           `default:"50" envconfig:"LOGIN_MAX_ATTEMPTS_PER_IP"`
+	LoginAttemptWindow    time.Duration `default:"1h" split_words:"true"`
+	LoginLockout          time.Duration `default:"30s" split_words:"true"`
+	LoginMaxLockout       time.Duration `default:"15m" split_words:"true"`
+
+	// Bound each call to an upstream, including its retries
+	BusTimeout           time.Duration `default:"10s" split_words:"true"`
+	BlaiseRestApiTimeout time.Duration `default:"10s" split_words:"true"`
+	CatiTimeout          time.Duration `default:"30s" split_words:"true"`
+	// Retries for idempotent calls that fail, and the backoff they are jittered within
+	OutboundMaxRetries   int           `default:"2" split_words:"true"`
+	OutboundRetryBackoff time.Duration `default:"200ms" split_words:"true"`
+	// Consecutive failures that stop calls to an upstream, and for how long, 0 to disable
+	CircuitBreakerThreshold int           `default:"5" split_words:"true"`
+	CircuitBreakerCooldown  time.Duration `default:"30s" split_words:"true"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -56,6 +204,9 @@ func LoadConfig() (*Config, error) {
 	if err := envconfig.Process("", &config); err != nil {
 		return nil, err
 	}
+	if config.LinkedInstruments == nil {
+		config.LinkedInstruments = authenticate.DefaultLinkedInstrumentRules
+	}
 	return &config, nil
 }
 
@@ -101,10 +252,11 @@ func CSRFErrorFunc(csrfManager csrf.CSRFManager, config *Config, logger *zap.Log
 			errorMessage = "Request timed out, please try again"
 		}
 		context.HTML(http.StatusForbidden, "login.tmpl", gin.H{
-			"uac16":      config.UacKind == "uac16",
+			"uac_kinds":  config.UacKind,
 			"info":       errorMessage,
 			"csrf_token": csrfManager.GetToken(context),
 			"welsh":      isWelsh,
+			"csp_nonce":  utils.CSPNonce(context),
 		})
 		context.Abort()
 	}
@@ -144,6 +296,135 @@ func UserSessionStore(config *Config) (sessions.Store, error) {
 	return store, nil
 }
 
+// KeyValueStore keeps portal state such as login attempt counters alongside
+// the user sessions in Redis, or in memory when running in dev mode
+func KeyValueStore(config *Config, store sessions.Store) (kvstore.Store, error) {
+	if config.DevMode {
+		return &kvstore.MemoryStore{}, nil
+	}
+	err, rediStore := redis.GetRedisStore(store)
+	if err != nil {
+		return nil, err
+	}
+	return &kvstore.RedisStore{Pool: rediStore.Pool, Prefix: "cawi_portal_"}, nil
+}
+
+// NewJWTCrypto loads any asymmetric JWT keys from disk. Tokens are signed with
+// JWTSecret unless a signing key file is configured.
+func NewJWTCrypto(config *Config) (*authenticate.JWTCrypto, error) {
+	jwtCrypto := &authenticate.JWTCrypto{
+		JWTSecret:              config.JWTSecret,
+		KeyID:                  config.JWTKeyId,
+		VerificationKeys:       config.JWTVerificationKeys,
+		UACHashSecret:          config.UACHashSecret,
+		RevocationTTL:          config.JWTRevocationTTL,
+		MaxLifetime:            config.SessionMaxLifetime,
+		InstrumentMaxLifetimes: config.SessionMaxLifetimes,
+	}
+	if config.JWTSigningKeyFile != "" {
+		signingKey, err := authenticate.LoadJWTKey(config.JWTSigningKeyId, config.JWTSigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if signingKey.SignKey == nil {
+			return nil, fmt.Errorf("%s does not contain a private key", config.JWTSigningKeyFile)
+		}
+		jwtCrypto.SigningKey = signingKey
+	}
+	for keyID, path := range config.JWTPublicKeyFiles {
+		publicKey, err := authenticate.LoadJWTKey(keyID, path)
+		if err != nil {
+			return nil, err
+		}
+		jwtCrypto.PublicKeys = append(jwtCrypto.PublicKeys, publicKey)
+	}
+	sort.Slice(jwtCrypto.PublicKeys, func(i, j int) bool {
+		return jwtCrypto.PublicKeys[i].ID < jwtCrypto.PublicKeys[j].ID
+	})
+	return jwtCrypto, nil
+}
+
+// NewAuditor returns the auditor for the configured sink, or nil when
+// auditing is disabled
+func NewAuditor(config *Config, logger *zap.Logger, portalMetrics *metrics.Metrics) (*audit.Auditor, error) {
+	if config.AuditSink == "" {
+		return nil, nil
+	}
+	client := outbound.NewClient("audit", OutboundPolicy(config, config.AuditWebhookTimeout, nil), nil, logger)
+	sink, err := audit.NewSink(config.AuditSink, client, config.AuditWebhookToken)
+	if err != nil {
+		return nil, err
+	}
+	key := config.AuditKey
+	if key == "" {
+		key = config.UACHashSecret
+	}
+	if key == "" {
+		key = config.JWTSecret
+	}
+	return &audit.Auditor{
+		Sink:         sink,
+		Key:          []byte(key),
+		Logger:       logger,
+		Metrics:      portalMetrics,
+		WriteTimeout: config.AuditWebhookTimeout,
+	}, nil
+}
+
+func LoginLimiters(config *Config, store kvstore.Store) (*ratelimiter.Limiter, *ratelimiter.Limiter) {
+	policy := ratelimiter.Policy{
+		MaxAttempts: config.LoginMaxAttempts,
+		Window:      config.LoginAttemptWindow,
+		BaseLockout: config.LoginLockout,
+		MaxLockout:  config.LoginMaxLockout,
+	}
+	ipPolicy := policy
+	ipPolicy.MaxAttempts = config.LoginMaxAttemptsPerIP
+	return &ratelimiter.Limiter{Name: "ip", Store: store, Policy: ipPolicy},
+		&ratelimiter.Limiter{Name: "session", Store: store, Policy: policy}
+}
+
+// CSPReportLimiter allows each client IP CSPReportMaxPerMinute CSP reports a
+// minute, then locks it out for longer the more it sends
+func CSPReportLimiter(config *Config, store kvstore.Store) *ratelimiter.Limiter {
+	return &ratelimiter.Limiter{Name: "csp_report", Store: store, Policy: ratelimiter.Policy{
+		MaxAttempts: config.CSPReportMaxPerMinute,
+		Window:      time.Minute,
+		BaseLockout: time.Minute,
+		MaxLockout:  15 * time.Minute,
+	}}
+}
+
+// OutboundPolicy is how calls to an upstream are made, each upstream having its
+// own timeout, and observer for the calls when they are measured
+func OutboundPolicy(config *Config, timeout time.Duration, observer outbound.Observer) outbound.Policy {
+	return outbound.Policy{
+		Timeout:          timeout,
+		MaxRetries:       config.OutboundMaxRetries,
+		RetryBackoff:     config.OutboundRetryBackoff,
+		BreakerThreshold: config.CircuitBreakerThreshold,
+		BreakerCooldown:  config.CircuitBreakerCooldown,
+		Observer:         observer,
+	}
+}
+
+// NewTracerProvider returns the tracer provider for the configured exporter,
+// or nil when tracing is disabled
+func NewTracerProvider(config *Config) (*sdktrace.TracerProvider, error) {
+	if config.TraceExporter == "" {
+		return nil, nil
+	}
+	return tracing.NewProvider(context.Background(), config.TraceExporter, config.TraceSampleRatio)
+}
+
+// NewMetrics returns the metrics to collect, or nil when they are not served
+func NewMetrics(config *Config) *metrics.Metrics {
+	if config.MetricsToken == "" {
+		return nil
+	}
+	return metrics.New()
+}
+
 func WrapWelsh(welsh bool) gin.H {
 	return gin.H{
 		"welsh": welsh,
@@ -152,6 +433,86 @@ func WrapWelsh(welsh bool) gin.H {
 
 type Server struct {
 	Config *Config
+
+	logger         *zap.Logger
+	tracerProvider *sdktrace.TracerProvider
+	redisStore     *kvstore.RedisStore
+	cspReports     *cspreport.Aggregator
+	stopCSPReports context.CancelFunc
+	auditor        *audit.Auditor
+}
+
+// HTTPServer returns the server handler is served with, on the configured
+// port and with the configured timeouts
+func (server *Server) HTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%s", server.Config.Port),
+		Handler:           handler,
+		ReadTimeout:       server.Config.ServerReadTimeout,
+		ReadHeaderTimeout: server.Config.ServerReadHeaderTimeout,
+		WriteTimeout:      server.Config.ServerWriteTimeout,
+		IdleTimeout:       server.Config.ServerIdleTimeout,
+	}
+}
+
+// Serve serves requests from listener with httpServer until ctx is done, then
+// stops accepting connections and gives in-flight requests ShutdownTimeout to
+// finish before shutting down
+func (server *Server) Serve(ctx context.Context, httpServer *http.Server, listener net.Listener) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		_ = server.Shutdown(context.Background())
+		return err
+	case <-ctx.Done():
+	}
+
+	if server.logger != nil {
+		server.logger.Info("Shutting down, draining in-flight requests", zap.Duration("timeout", server.Config.ShutdownTimeout))
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), server.Config.ShutdownTimeout)
+	defer cancel()
+	err := httpServer.Shutdown(shutdownCtx)
+	if shutdownErr := server.Shutdown(shutdownCtx); err == nil {
+		err = shutdownErr
+	}
+	return err
+}
+
+// Shutdown writes any audit events still queued, exports any spans that have
+// not been exported yet, stops logging CSP violations every interval and logs
+// those counted since they were last logged, closes the Redis pool and
+// flushes the logger
+func (server *Server) Shutdown(ctx context.Context) error {
+	var err error
+	if server.auditor != nil {
+		err = server.auditor.Flush(ctx)
+	}
+	if server.stopCSPReports != nil {
+		server.stopCSPReports()
+	}
+	if server.cspReports != nil {
+		server.cspReports.Flush()
+	}
+	if server.tracerProvider != nil {
+		if shutdownErr := server.tracerProvider.Shutdown(ctx); err == nil {
+			err = shutdownErr
+		}
+	}
+	if server.redisStore != nil {
+		if closeErr := server.redisStore.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if server.logger != nil {
+		// Syncing stdout fails on some platforms, which is not worth reporting
+		_ = server.logger.Sync()
+	}
+	return err
 }
 
 func (server *Server) SetupRouter() *gin.Engine {
@@ -159,23 +520,46 @@ func (server *Server) SetupRouter() *gin.Engine {
 	if err != nil {
 		log.Fatalf("Error setting up logger: %s", err)
 	}
+	server.logger = logger
+	tracerProvider, err := NewTracerProvider(server.Config)
+	if err != nil {
+		logger.Fatal("Error setting up tracing", zap.Error(err))
+	}
+	if tracerProvider != nil {
+		tracing.Register(tracerProvider)
+		server.tracerProvider = tracerProvider
+	}
+
 	httpRouter := gin.Default()
-	httpClient := &http.Client{}
+	httpRouter.Use(tracing.Middleware)
+	portalMetrics := NewMetrics(server.Config)
+	httpClient := outbound.NewClient("cati", OutboundPolicy(server.Config, server.Config.CatiTimeout, portalMetrics), tracing.Transport(nil), logger)
 
 	securityConfig := secure.DefaultConfig()
-	securityConfig.ContentSecurityPolicy = contentSecurityPolicy
+	// Set for each request, with its nonce, by ContentSecurityPolicyMiddleware
+	securityConfig.ContentSecurityPolicy = ""
 
 	if server.Config.DevMode {
 		securityConfig.IsDevelopment = true
 	}
 
 	httpRouter.Use(secure.New(securityConfig))
+	httpRouter.Use(ContentSecurityPolicyMiddleware)
 
 	store, err := UserSessionStore(server.Config)
 	if err != nil {
 		log.Fatalf("Could not connect to session database: %s", err)
 	}
 
+	keyValueStore, err := KeyValueStore(server.Config, store)
+	if err != nil {
+		log.Fatalf("Could not set up key value store: %s", err)
+	}
+	ipLimiter, sessionLimiter := LoginLimiters(server.Config, keyValueStore)
+	if portalMetrics != nil {
+		store = &metrics.SessionStore{Store: store, Metrics: portalMetrics}
+	}
+
 	cookieStore := cookie.NewStore([]byte(server.Config.SessionSecret), []byte(server.Config.EncryptionSecret))
 	cookieStore.Options(sessions.Options{
 		Path:     "/",
@@ -226,15 +610,38 @@ func (server *Server) SetupRouter() *gin.Engine {
 	if err != nil {
 		logger.Fatal("Error creating bus client", zap.Error(err))
 	}
+	busTransport := client.Transport
+	client = outbound.NewClient("bus", OutboundPolicy(server.Config, server.Config.BusTimeout, portalMetrics), tracing.Transport(client.Transport), logger)
 
-	jwtCrypto := &authenticate.JWTCrypto{
-		JWTSecret: server.Config.JWTSecret,
+	jwtCrypto, err := NewJWTCrypto(server.Config)
+	if err != nil {
+		logger.Fatal("Error loading JWT keys", zap.Error(err))
 	}
+	jwtCrypto.Revocations = &authenticate.RevocationList{Store: keyValueStore}
 
-	blaiseRestApi := &blaiserestapi.BlaiseRestApi{
+	auditor, err := NewAuditor(server.Config, logger, portalMetrics)
+	if err != nil {
+		logger.Fatal("Error setting up audit sink", zap.Error(err))
+	}
+	server.auditor = auditor
+
+	restApiClient := outbound.NewClient("blaise-rest-api", OutboundPolicy(server.Config, server.Config.BlaiseRestApiTimeout, portalMetrics), tracing.Transport(nil), logger)
+	var blaiseRestApi blaiserestapi.BlaiseRestApiInterface = &blaiserestapi.BlaiseRestApi{
 		BaseUrl:    server.Config.BlaiseRestApi,
 		Serverpark: server.Config.Serverpark,
-		Client:     &http.Client{},
+		Client:     restApiClient,
+	}
+	var instrumentSettingsCache blaiserestapi.InstrumentSettingsCacheInterface
+	if server.Config.InstrumentSettingsCacheTtl > 0 {
+		cachingBlaiseRestApi := &blaiserestapi.CachingBlaiseRestApi{
+			BlaiseRestApi: blaiseRestApi,
+			TTL:           server.Config.InstrumentSettingsCacheTtl,
+			StatusTTL:     server.Config.QuestionnaireStatusCacheTtl,
+			StaleTTL:      server.Config.InstrumentSettingsStaleTtl,
+			MaxEntries:    server.Config.InstrumentSettingsCacheMaxEntries,
+		}
+		blaiseRestApi = cachingBlaiseRestApi
+		instrumentSettingsCache = cachingBlaiseRestApi
 	}
 
 	languageManager := &languagemanager.Manager{SessionName: "language_session"}
@@ -248,35 +655,96 @@ func (server *Server) SetupRouter() *gin.Engine {
 			BaseUrl: server.Config.BusUrl,
 			Client:  client,
 		},
-		UacKind:         server.Config.UacKind,
-		CSRFManager:     csrfManager,
-		LanguageManager: languageManager,
+		UacKinds:            server.Config.UacKind,
+		CheckUacCharacters:  server.Config.UacCheckCharacters,
+		CSRFManager:         csrfManager,
+		LanguageManager:     languageManager,
+		IPLimiter:           ipLimiter,
+		SessionLimiter:      sessionLimiter,
+		SessionPolicy:       server.Config.SessionPolicy,
+		AvailabilityWindows: server.Config.InstrumentAvailability,
+		RequireSurveyDay:    server.Config.RequireSurveyDay,
+		Auditor:             auditor,
+		Metrics:             portalMetrics,
+	}
+	if server.Config.SessionPolicy != authenticate.SessionPolicyAllow {
+		auth.ActiveSessions = &authenticate.ActiveSessions{Store: keyValueStore}
 	}
 
 	authController := &AuthController{
 		Auth:            auth,
 		Logger:          logger,
-		UacKind:         server.Config.UacKind,
+		UacKinds:        server.Config.UacKind,
 		CSRFManager:     csrfManager,
 		LanguageManager: languageManager,
 	}
 
-	securityController := &SecurityController{}
+	cspReports := &cspreport.Aggregator{
+		Logger:        logger,
+		Interval:      server.Config.CSPReportInterval,
+		MaxViolations: 100,
+	}
+	cspReportsCtx, stopCSPReports := context.WithCancel(context.Background())
+	go cspReports.Run(cspReportsCtx)
+	server.cspReports = cspReports
+	server.stopCSPReports = stopCSPReports
+	securityController := &SecurityController{
+		Logger:           logger,
+		CSPReports:       cspReports,
+		CSPReportLimiter: CSPReportLimiter(server.Config, keyValueStore),
+	}
 
 	securityController.AddRoutes(httpRouter)
 
 	authController.AddRoutes(httpRouter)
 	instrumentController := &InstrumentController{
-		Auth:            auth,
-		JWTCrypto:       jwtCrypto,
-		Logger:          logger,
-		CatiUrl:         server.Config.CatiUrl,
-		HttpClient:      httpClient,
-		LanguageManager: languageManager,
+		Auth:              auth,
+		JWTCrypto:         jwtCrypto,
+		Logger:            logger,
+		CatiUrl:           server.Config.CatiUrl,
+		HttpClient:        httpClient,
+		LanguageManager:   languageManager,
+		LinkedInstruments: server.Config.LinkedInstruments,
+		Auditor:           auditor,
+		Metrics:           portalMetrics,
+		ScriptSources:     server.Config.CSPBlaiseScriptSources,
 	}
 	instrumentController.AddRoutes(httpRouter)
-	healthController := &HealthController{}
+	// Probes use plain clients rather than the outbound ones, so that they are
+	// not retried, cannot open or be refused by a circuit breaker and are not
+	// counted in the upstream metrics
+	probeClient := &http.Client{}
+	readinessChecker := &readiness.Checker{
+		Probes: []readiness.Probe{
+			{Name: "bus", Critical: true, Check: readiness.HTTPProbe(&http.Client{Transport: busTransport}, server.Config.BusUrl)},
+			{Name: "blaise-rest-api", Critical: true, Check: readiness.HTTPProbe(probeClient, server.Config.BlaiseRestApi)},
+			{Name: "cati", Critical: true, Check: readiness.HTTPProbe(probeClient, server.Config.CatiUrl)},
+		},
+		Timeout:  server.Config.ReadyTimeout,
+		CacheTTL: server.Config.ReadyCacheTtl,
+		Logger:   logger,
+	}
+	if redisStore, ok := keyValueStore.(*kvstore.RedisStore); ok {
+		readinessChecker.Probes = append(readinessChecker.Probes, readiness.Probe{Name: "redis", Critical: true, Check: redisStore.Ping})
+		server.redisStore = redisStore
+	}
+	healthController := &HealthController{Readiness: readinessChecker}
 	healthController.AddRoutes(httpRouter)
+	keysController := &KeysController{JWTCrypto: jwtCrypto}
+	keysController.AddRoutes(httpRouter)
+	adminController := &AdminController{
+		Token:                   server.Config.AdminToken,
+		JWTCrypto:               jwtCrypto,
+		InstrumentSettingsCache: instrumentSettingsCache,
+		Logger:                  logger,
+	}
+	adminController.AddRoutes(httpRouter)
+	metricsController := &MetricsController{
+		Token:   server.Config.MetricsToken,
+		Metrics: portalMetrics,
+		Logger:  logger,
+	}
+	metricsController.AddRoutes(httpRouter)
 
 	httpRouter.GET("/", authController.LoginEndpoint)
 
@@ -290,7 +758,10 @@ func (server *Server) SetupRouter() *gin.Engine {
 	})
 
 	httpRouter.NoRoute(func(context *gin.Context) {
-		context.HTML(http.StatusOK, "not_found.tmpl", gin.H{"welsh": languageManager.IsWelsh(context)})
+		context.HTML(http.StatusOK, "not_found.tmpl", gin.H{
+			"welsh":     languageManager.IsWelsh(context),
+			"csp_nonce": utils.CSPNonce(context),
+		})
 	})
 
 	return httpRouter